@@ -1,6 +1,7 @@
 package accesslist
 
 import (
+	"github.com/ethereum/go-ethereum/common"
 	cmap "github.com/orcaman/concurrent-map/v2"
 )
 
@@ -34,11 +35,20 @@ func (rs *ReserveSet) set(addrStr, hashStr string, Tid uint) {
 	innerMap.Set(hashStr, Tid)
 }
 
+// reserveHash reserves a balance delta as a balance write,
+// so deltas to the same account are not reordered within a round
+func reserveHash(hash common.Hash) string {
+	if hash == BALANCEDELTA {
+		hash = BALANCE
+	}
+	return hash.Hex()
+}
+
 func (rs *ReserveSet) Reserve(set ALTuple, Tid uint) {
 	for addr, state := range set {
 		for hash := range state {
 			addrStr := addr.Hex()
-			hashStr := hash.Hex()
+			hashStr := reserveHash(hash)
 			reservId, exist := rs.get(addrStr, hashStr)
 			if !exist || Tid < reservId {
 				rs.set(addrStr, hashStr, Tid)
@@ -51,7 +61,7 @@ func (rs *ReserveSet) HasConflict(Tid uint, set ALTuple) bool {
 	for addr, state := range set {
 		for hash := range state {
 			addrStr := addr.Hex()
-			hashStr := hash.Hex()
+			hashStr := reserveHash(hash)
 			reservId, exist := rs.get(addrStr, hashStr)
 			if exist && reservId < Tid {
 				return true
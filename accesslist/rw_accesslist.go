@@ -13,6 +13,9 @@ var (
 	BALANCE  = common.Hash(sha256.Sum256([]byte("balance")))
 	NONCE    = common.Hash(sha256.Sum256([]byte("nonce")))
 	ALIVE    = common.Hash(sha256.Sum256([]byte("alive")))
+	// BALANCEDELTA is a value transfer recorded as a balance delta (core.TransferDelta),
+	// deltas commute, so they conflict with BALANCE but not with each other
+	BALANCEDELTA = common.Hash(sha256.Sum256([]byte("balanceDelta")))
 )
 
 type State map[common.Hash]struct{}
@@ -56,20 +59,31 @@ func (RWSets RWSet) AddWriteSet(addr common.Address, hash common.Hash) {
 	RWSets.WriteSet.Add(addr, hash)
 }
 
+// conflictWith reports whether an access to (addr, hash) conflicts with an access in tuple
+func (tuple ALTuple) conflictWith(addr common.Address, hash common.Hash) bool {
+	switch hash {
+	case BALANCE:
+		return tuple.Contains(addr, BALANCE) || tuple.Contains(addr, BALANCEDELTA)
+	case BALANCEDELTA:
+		return tuple.Contains(addr, BALANCE)
+	}
+	return tuple.Contains(addr, hash)
+}
+
 func (RWSets RWSet) HasConflict(other RWSet) bool {
 	for addr, state := range RWSets.ReadSet {
 		for hash := range state {
-			if other.WriteSet.Contains(addr, hash) {
+			if other.WriteSet.conflictWith(addr, hash) {
 				return true
 			}
 		}
 	}
 	for addr, state := range RWSets.WriteSet {
 		for hash := range state {
-			if other.WriteSet.Contains(addr, hash) {
+			if other.WriteSet.conflictWith(addr, hash) {
 				return true
 			}
-			if other.ReadSet.Contains(addr, hash) {
+			if other.ReadSet.conflictWith(addr, hash) {
 				return true
 			}
 		}
@@ -78,29 +92,26 @@ func (RWSets RWSet) HasConflict(other RWSet) bool {
 }
 
 func (RWSets RWSet) Equal(other RWSet) bool {
-	if len(RWSets.ReadSet) != len(other.ReadSet) {
-		return false
-	}
-	if len(RWSets.WriteSet) != len(other.WriteSet) {
-		return false
-	}
+	// same number of addresses doesn't mean the same number of slots, so compare both ways
+	return RWSets.Covers(other) && other.Covers(RWSets)
+}
 
-	for addr, state := range RWSets.ReadSet {
+// Covers reports whether every read and write of other is also in RWSets
+func (RWSets RWSet) Covers(other RWSet) bool {
+	for addr, state := range other.ReadSet {
 		for hash := range state {
-			if !other.ReadSet.Contains(addr, hash) {
+			if !RWSets.ReadSet.Contains(addr, hash) {
 				return false
 			}
 		}
 	}
-
-	for addr, state := range RWSets.WriteSet {
+	for addr, state := range other.WriteSet {
 		for hash := range state {
-			if !other.WriteSet.Contains(addr, hash) {
+			if !RWSets.WriteSet.Contains(addr, hash) {
 				return false
 			}
 		}
 	}
-
 	return true
 }
 
@@ -116,6 +127,8 @@ func DecodeHash(hash common.Hash) string {
 		return "codeHash"
 	case NONCE:
 		return "nonce"
+	case BALANCEDELTA:
+		return "balanceDelta"
 	default:
 		return hash.Hex()
 	}
@@ -133,6 +146,8 @@ func encodeHash(str string) common.Hash {
 		return CODEHASH
 	case "nonce":
 		return NONCE
+	case "balanceDelta":
+		return BALANCEDELTA
 	default:
 		return common.HexToHash(str)
 	}
@@ -0,0 +1,143 @@
+package coloring
+
+import (
+	conflictgraph "interact/conflictGraph"
+	"sort"
+)
+
+// Coloring colors the conflict graph in one pass, the txs of a color are conflict-free and make a round.
+// A tx must get a greater color than the previous tx of its sender (prev), so that the rounds keep the nonce order
+type Coloring func(g *conflictgraph.UndirectedGraph, prev map[uint]uint) [][]uint
+
+// Greedy is the Welsh-Powell coloring, the vertices are colored by decreasing degree
+// with the least color none of their neighbours has
+func Greedy(g *conflictgraph.UndirectedGraph, prev map[uint]uint) [][]uint {
+	ids := sortedIds(g)
+	sort.SliceStable(ids, func(i, j int) bool {
+		return len(g.AdjacencyMap[ids[i]]) > len(g.AdjacencyMap[ids[j]])
+	})
+	color := make(map[uint]int, len(ids))
+	// a tx waits for the previous tx of its sender, which is earlier in the block
+	pending := make([]uint, 0)
+	for len(ids) > 0 {
+		for _, id := range ids {
+			if p, ok := prev[id]; ok && !colored(color, p) {
+				pending = append(pending, id)
+				continue
+			}
+			color[id] = leastColor(g, color, prev, id)
+		}
+		ids, pending = pending, make([]uint, 0)
+	}
+	return rounds(color)
+}
+
+// DSatur colors the vertex with the most colors among its neighbours first,
+// the one with the highest degree on ties
+func DSatur(g *conflictgraph.UndirectedGraph, prev map[uint]uint) [][]uint {
+	ids := sortedIds(g)
+	color := make(map[uint]int, len(ids))
+	saturation := make(map[uint]map[int]struct{}, len(ids))
+	for _, id := range ids {
+		saturation[id] = make(map[int]struct{})
+	}
+	for len(color) < len(ids) {
+		best, found := uint(0), false
+		for _, id := range ids {
+			if colored(color, id) {
+				continue
+			}
+			if p, ok := prev[id]; ok && !colored(color, p) {
+				continue
+			}
+			if !found || len(saturation[id]) > len(saturation[best]) ||
+				(len(saturation[id]) == len(saturation[best]) && len(g.AdjacencyMap[id]) > len(g.AdjacencyMap[best])) {
+				best, found = id, true
+			}
+		}
+		color[best] = leastColor(g, color, prev, best)
+		for _, neighborid := range g.AdjacencyMap[best] {
+			saturation[neighborid][color[best]] = struct{}{}
+		}
+	}
+	return rounds(color)
+}
+
+// Ordered respects the block order, the vertices are colored in tx order
+// with the least color greater than all their earlier neighbours have,
+// so a tx runs after all the earlier txs conflicting with it, the previous tx of its sender included
+func Ordered(g *conflictgraph.UndirectedGraph, prev map[uint]uint) [][]uint {
+	color := make(map[uint]int, len(g.Vertices))
+	for _, id := range sortedIds(g) {
+		c := 0
+		for _, neighborid := range g.AdjacencyMap[id] {
+			if neighborid < id && color[neighborid]+1 > c {
+				c = color[neighborid] + 1
+			}
+		}
+		color[id] = c
+	}
+	return rounds(color)
+}
+
+func sortedIds(g *conflictgraph.UndirectedGraph) []uint {
+	ids := make([]uint, 0, len(g.Vertices))
+	for id := range g.Vertices {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func colored(color map[uint]int, id uint) bool {
+	_, ok := color[id]
+	return ok
+}
+
+// leastColor returns the least color of id none of its colored neighbours has,
+// and greater than the color of the previous tx of its sender
+func leastColor(g *conflictgraph.UndirectedGraph, color map[uint]int, prev map[uint]uint, id uint) int {
+	used := make(map[int]struct{})
+	for _, neighborid := range g.AdjacencyMap[id] {
+		if c, ok := color[neighborid]; ok {
+			used[c] = struct{}{}
+		}
+	}
+	c := 0
+	if p, ok := prev[id]; ok {
+		c = color[p] + 1
+	}
+	for {
+		if _, ok := used[c]; !ok {
+			return c
+		}
+		c++
+	}
+}
+
+// rounds groups the txs by color in color order, skipping the colors nobody has
+func rounds(color map[uint]int) [][]uint {
+	numColors := 0
+	for _, c := range color {
+		if c+1 > numColors {
+			numColors = c + 1
+		}
+	}
+	byColor := make([][]uint, numColors)
+	for id, c := range color {
+		byColor[c] = append(byColor[c], id)
+	}
+	ans := make([][]uint, 0, numColors)
+	for _, round := range byColor {
+		if len(round) == 0 {
+			continue
+		}
+		sort.Slice(round, func(i, j int) bool {
+			return round[i] < round[j]
+		})
+		ans = append(ans, round)
+	}
+	return ans
+}
@@ -0,0 +1,70 @@
+package coloring
+
+import (
+	conflictgraph "interact/conflictGraph"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func NewGraph() *conflictgraph.UndirectedGraph {
+	G := conflictgraph.NewUndirectedGraph()
+	for i := 0; i < 10; i++ {
+		G.AddVertex(common.Hash{}, uint(i))
+	}
+	G.AddEdge(0, 1)
+	G.AddEdge(0, 2)
+
+	G.AddEdge(1, 2)
+	G.AddEdge(1, 3)
+
+	G.AddEdge(2, 3)
+
+	G.AddEdge(3, 8)
+	G.AddEdge(3, 4)
+
+	G.AddEdge(4, 5)
+	G.AddEdge(4, 7)
+
+	G.AddEdge(5, 6)
+	G.AddEdge(6, 7)
+
+	G.AddEdge(8, 9)
+
+	return G
+}
+
+func TestColoring(t *testing.T) {
+	// 9 is the next tx of the sender of 0
+	prev := map[uint]uint{9: 0}
+	for name, coloring := range map[string]Coloring{"Greedy": Greedy, "DSatur": DSatur, "Ordered": Ordered} {
+		graph := NewGraph()
+		rounds := coloring(graph, prev)
+		roundOf := make(map[uint]int)
+		for r, round := range rounds {
+			if len(round) == 0 {
+				t.Fatalf("%s: empty round %d", name, r)
+			}
+			for _, id := range round {
+				roundOf[id] = r
+			}
+		}
+		if len(roundOf) != len(graph.Vertices) {
+			t.Fatalf("%s: %d txs colored, want %d", name, len(roundOf), len(graph.Vertices))
+		}
+		for id, neighbors := range graph.AdjacencyMap {
+			for _, neighborid := range neighbors {
+				if roundOf[id] == roundOf[neighborid] {
+					t.Fatalf("%s: conflicting txs %d and %d in round %d", name, id, neighborid, roundOf[id])
+				}
+				if name == "Ordered" && id < neighborid && roundOf[id] > roundOf[neighborid] {
+					t.Fatalf("%s: tx %d runs before the earlier tx %d", name, neighborid, id)
+				}
+			}
+		}
+		if roundOf[9] <= roundOf[0] {
+			t.Fatalf("%s: tx 9 in round %d, its sender's previous tx 0 in round %d", name, roundOf[9], roundOf[0])
+		}
+		t.Log(name, "Rounds:", len(rounds))
+	}
+}
@@ -0,0 +1,98 @@
+package conflictgraph
+
+import "math/bits"
+
+// Bitset is a set of dense vertex indices, or of TxIds, one bit each
+type Bitset []uint64
+
+func NewBitset(n int) Bitset {
+	return make(Bitset, (n+63)/64)
+}
+
+// Grow returns b large enough to hold i
+func (b Bitset) Grow(i int) Bitset {
+	if i/64 < len(b) {
+		return b
+	}
+	grown := make(Bitset, i/64+1)
+	copy(grown, b)
+	return grown
+}
+
+func (b Bitset) Set(i int)   { b[i/64] |= 1 << (i % 64) }
+func (b Bitset) Clear(i int) { b[i/64] &^= 1 << (i % 64) }
+
+func (b Bitset) Has(i int) bool {
+	return i/64 < len(b) && b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b Bitset) Clone() Bitset {
+	c := make(Bitset, len(b))
+	copy(c, b)
+	return c
+}
+
+func (b Bitset) And(o Bitset) {
+	for k := range b {
+		b[k] &= o[k]
+	}
+}
+
+func (b Bitset) AndNot(o Bitset) {
+	for k := range b {
+		b[k] &^= o[k]
+	}
+}
+
+func (b Bitset) Or(o Bitset) {
+	for k := range b {
+		b[k] |= o[k]
+	}
+}
+
+func (b Bitset) Count() int {
+	count := 0
+	for _, word := range b {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// AndCount is the size of the intersection of b and o
+func (b Bitset) AndCount(o Bitset) int {
+	count := 0
+	for k := range b {
+		count += bits.OnesCount64(b[k] & o[k])
+	}
+	return count
+}
+
+func (b Bitset) Empty() bool {
+	for _, word := range b {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// First returns the least member, -1 if b is empty
+func (b Bitset) First() int {
+	for k, word := range b {
+		if word != 0 {
+			return k*64 + bits.TrailingZeros64(word)
+		}
+	}
+	return -1
+}
+
+// ForEach visits the members in increasing order, f may clear the members it hasn't visited yet
+func (b Bitset) ForEach(f func(int)) {
+	for k := range b {
+		for word := b[k]; word != 0; word &= b[k] {
+			i := bits.TrailingZeros64(word)
+			word &^= 1 << i
+			f(k*64 + i)
+		}
+	}
+}
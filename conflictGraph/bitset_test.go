@@ -0,0 +1,127 @@
+package conflictgraph
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// members lists a reference set in increasing order
+func members(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for i, ok := range set {
+		if ok {
+			ids = append(ids, i)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func bitsetMembers(b Bitset) []int {
+	ids := make([]int, 0)
+	b.ForEach(func(i int) {
+		ids = append(ids, i)
+	})
+	return ids
+}
+
+func TestBitset(t *testing.T) {
+	b := NewBitset(130)
+	if len(b) != 3 || !b.Empty() || b.First() != -1 {
+		t.Fatalf("new bitset of 130: %d words, empty %v, first %d", len(b), b.Empty(), b.First())
+	}
+	// the ends of the words
+	for _, i := range []int{0, 63, 64, 127, 129} {
+		b.Set(i)
+	}
+	if got := bitsetMembers(b); !reflect.DeepEqual(got, []int{0, 63, 64, 127, 129}) {
+		t.Fatalf("members %v", got)
+	}
+	if b.Count() != 5 || b.First() != 0 || !b.Has(64) || b.Has(65) || b.Has(1000) {
+		t.Fatalf("count %d, first %d, has 64 %v, has 65 %v, has 1000 %v", b.Count(), b.First(), b.Has(64), b.Has(65), b.Has(1000))
+	}
+	b.Clear(0)
+	b.Clear(0)
+	if b.First() != 63 || b.Count() != 4 {
+		t.Fatalf("first %d, count %d after clearing 0", b.First(), b.Count())
+	}
+
+	c := b.Clone()
+	c.Set(1)
+	if b.Has(1) {
+		t.Fatal("the clone shares the words")
+	}
+	grown := b.Grow(200)
+	if len(grown) != 4 || !grown.Has(129) || grown.Has(200) {
+		t.Fatalf("grown to %d words, has 129 %v", len(grown), grown.Has(129))
+	}
+	if same := b.Grow(100); &same[0] != &b[0] {
+		t.Fatal("grew a bitset already large enough")
+	}
+}
+
+func TestBitsetOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const n = 200
+	for round := 0; round < 100; round++ {
+		a, b := NewBitset(n), NewBitset(n)
+		ra, rb := make(map[int]bool), make(map[int]bool)
+		for k := 0; k < r.Intn(n); k++ {
+			i, j := r.Intn(n), r.Intn(n)
+			a.Set(i)
+			ra[i] = true
+			b.Set(j)
+			rb[j] = true
+		}
+
+		and, andNot, or := make(map[int]bool), make(map[int]bool), make(map[int]bool)
+		for i := 0; i < n; i++ {
+			and[i] = ra[i] && rb[i]
+			andNot[i] = ra[i] && !rb[i]
+			or[i] = ra[i] || rb[i]
+		}
+		if a.AndCount(b) != len(members(and)) {
+			t.Fatalf("round %d: and count %d, want %d", round, a.AndCount(b), len(members(and)))
+		}
+		for _, tt := range []struct {
+			name string
+			op   func(Bitset, Bitset)
+			want map[int]bool
+		}{
+			{"and", Bitset.And, and},
+			{"and not", Bitset.AndNot, andNot},
+			{"or", Bitset.Or, or},
+		} {
+			got := a.Clone()
+			tt.op(got, b)
+			if want := members(tt.want); !reflect.DeepEqual(bitsetMembers(got), want) || got.Count() != len(want) {
+				t.Fatalf("round %d %s: %v, want %v", round, tt.name, bitsetMembers(got), want)
+			}
+		}
+	}
+}
+
+func TestBitsetForEachClear(t *testing.T) {
+	b := NewBitset(200)
+	for i := 0; i < 200; i++ {
+		b.Set(i)
+	}
+	// visiting i clears its multiples, what is visited is the primes
+	visited := make([]int, 0)
+	b.Clear(0)
+	b.Clear(1)
+	b.ForEach(func(i int) {
+		visited = append(visited, i)
+		for j := 2 * i; j < 200; j += i {
+			b.Clear(j)
+		}
+	})
+	if len(visited) != 46 || visited[0] != 2 || visited[len(visited)-1] != 199 {
+		t.Fatalf("visited %v, want the 46 primes below 200", visited)
+	}
+	if !reflect.DeepEqual(bitsetMembers(b), visited) {
+		t.Fatalf("left %v, want the visited members", bitsetMembers(b))
+	}
+}
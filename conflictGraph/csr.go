@@ -0,0 +1,174 @@
+package conflictgraph
+
+import "sort"
+
+// CSR is a compressed sparse row snapshot of a conflict graph. The vertices not deleted get dense indices
+// in TxId order, and the neighbours of vertex i are Edges[Offsets[i]:Offsets[i+1]], in increasing order.
+// For a directed graph these are the successors, and InDegree counts the predecessors
+type CSR struct {
+	Ids      []uint // dense index -> TxId
+	Offsets  []int
+	Edges    []int
+	InDegree []int
+
+	index map[uint]int
+}
+
+// NewCSR snapshots the vertices of g not deleted and the edges between them
+func NewCSR(g *UndirectedGraph) *CSR {
+	c := newCSRVertices(g.Vertices)
+	for i, id := range c.Ids {
+		for _, neighborId := range g.AdjacencyMap[id] {
+			if j, ok := c.index[neighborId]; ok {
+				c.Edges = append(c.Edges, j)
+			}
+		}
+		c.closeRow(i)
+	}
+	c.InDegree = make([]int, len(c.Ids))
+	for i := range c.Ids {
+		c.InDegree[i] = c.Degree(i)
+	}
+	return c
+}
+
+// NewDirectedCSR snapshots the vertices of g not deleted and the edges between them
+func NewDirectedCSR(g *DirectedGraph) *CSR {
+	c := newCSRVertices(g.Vertices)
+	c.InDegree = make([]int, len(c.Ids))
+	for i, id := range c.Ids {
+		for neighborId := range g.AdjacencyMap[id] {
+			if j, ok := c.index[neighborId]; ok {
+				c.Edges = append(c.Edges, j)
+				c.InDegree[j]++
+			}
+		}
+		c.closeRow(i)
+	}
+	return c
+}
+
+func newCSRVertices(vertices map[uint]*Vertex) *CSR {
+	ids := make([]uint, 0, len(vertices))
+	for id, v := range vertices {
+		if !v.IsDeleted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	c := &CSR{
+		Ids:     ids,
+		Offsets: make([]int, 1, len(ids)+1),
+		Edges:   make([]int, 0),
+		index:   make(map[uint]int, len(ids)),
+	}
+	for i, id := range ids {
+		c.index[id] = i
+	}
+	return c
+}
+
+// closeRow sorts the neighbours of vertex i, the last row appended to Edges
+func (c *CSR) closeRow(i int) {
+	row := c.Edges[c.Offsets[i]:]
+	sort.Ints(row)
+	c.Offsets = append(c.Offsets, len(c.Edges))
+}
+
+func (c *CSR) Len() int { return len(c.Ids) }
+
+// Index returns the dense index of a TxId
+func (c *CSR) Index(id uint) (int, bool) {
+	i, ok := c.index[id]
+	return i, ok
+}
+
+func (c *CSR) Neighbors(i int) []int {
+	return c.Edges[c.Offsets[i]:c.Offsets[i+1]]
+}
+
+func (c *CSR) Degree(i int) int {
+	return c.Offsets[i+1] - c.Offsets[i]
+}
+
+func (c *CSR) HasEdge(i, j int) bool {
+	row := c.Neighbors(i)
+	k := sort.SearchInts(row, j)
+	return k < len(row) && row[k] == j
+}
+
+// Adjacency returns the neighbours of each vertex as a bitset
+func (c *CSR) Adjacency() []Bitset {
+	adj := make([]Bitset, c.Len())
+	for i := range adj {
+		adj[i] = NewBitset(c.Len())
+		for _, j := range c.Neighbors(i) {
+			adj[i].Set(j)
+		}
+	}
+	return adj
+}
+
+// Components returns the connected components in dense indices, by least member, each in increasing order
+func (c *CSR) Components() [][]int {
+	visited := NewBitset(c.Len())
+	components := make([][]int, 0)
+	for i := 0; i < c.Len(); i++ {
+		if visited.Has(i) {
+			continue
+		}
+		visited.Set(i)
+		component := []int{i}
+		for k := 0; k < len(component); k++ {
+			for _, j := range c.Neighbors(component[k]) {
+				if !visited.Has(j) {
+					visited.Set(j)
+					component = append(component, j)
+				}
+			}
+		}
+		sort.Ints(component)
+		components = append(components, component)
+	}
+	return components
+}
+
+// Layers returns the in-degree layers of a directed snapshot in dense indices,
+// i.e. the vertices without predecessors, then those whose predecessors are all in earlier layers, and so on
+func (c *CSR) Layers() [][]int {
+	inDegree := make([]int, c.Len())
+	copy(inDegree, c.InDegree)
+	layer := make([]int, 0)
+	for i, d := range inDegree {
+		if d == 0 {
+			layer = append(layer, i)
+		}
+	}
+	layers := make([][]int, 0)
+	for len(layer) > 0 {
+		layers = append(layers, layer)
+		next := make([]int, 0)
+		for _, i := range layer {
+			for _, j := range c.Neighbors(i) {
+				inDegree[j]--
+				if inDegree[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		sort.Ints(next)
+		layer = next
+	}
+	return layers
+}
+
+// TxIds maps dense indices back to TxIds
+func (c *CSR) TxIds(indices []int) []uint {
+	ids := make([]uint, len(indices))
+	for k, i := range indices {
+		ids[k] = c.Ids[i]
+	}
+	return ids
+}
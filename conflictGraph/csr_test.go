@@ -0,0 +1,166 @@
+package conflictgraph
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// sparseGraph has the TxIds 10, 20, .., 70 with 40 deleted, the edges 10-30, 30-40, 40-50, 20-70, 60 alone
+func sparseGraph() *UndirectedGraph {
+	g := NewUndirectedGraph()
+	for id := uint(70); id >= 10; id -= 10 {
+		g.AddVertex(common.Hash{}, id)
+	}
+	g.AddEdge(30, 10)
+	g.AddEdge(30, 40)
+	g.AddEdge(40, 50)
+	g.AddEdge(70, 20)
+	// an edge added again, in either direction, is kept once
+	g.AddEdge(10, 30)
+	g.AddEdge(70, 20)
+	g.Vertices[40].IsDeleted = true
+	return g
+}
+
+func TestCSR(t *testing.T) {
+	c := NewCSR(sparseGraph())
+	if want := []uint{10, 20, 30, 50, 60, 70}; !reflect.DeepEqual(c.Ids, want) || c.Len() != len(want) {
+		t.Fatalf("ids %v, want %v", c.Ids, want)
+	}
+	if i, ok := c.Index(50); !ok || i != 3 {
+		t.Fatalf("index of 50 is %d %v, want 3", i, ok)
+	}
+	if _, ok := c.Index(40); ok {
+		t.Fatal("the deleted vertex has an index")
+	}
+	// the edges to the deleted vertex are dropped
+	neighbors := [][]int{{2}, {5}, {0}, {}, {}, {1}}
+	for i, want := range neighbors {
+		if got := append([]int{}, c.Neighbors(i)...); !reflect.DeepEqual(got, want) || c.Degree(i) != len(want) || c.InDegree[i] != len(want) {
+			t.Fatalf("vertex %d: neighbours %v degree %d in-degree %d, want %v", i, got, c.Degree(i), c.InDegree[i], want)
+		}
+	}
+	if !c.HasEdge(0, 2) || !c.HasEdge(2, 0) || c.HasEdge(0, 1) || c.HasEdge(3, 4) {
+		t.Fatal("HasEdge disagrees with the edges")
+	}
+	adj := c.Adjacency()
+	for i := range neighbors {
+		if got := bitsetMembers(adj[i]); !reflect.DeepEqual(got, neighbors[i]) {
+			t.Fatalf("adjacency of %d is %v, want %v", i, got, neighbors[i])
+		}
+	}
+	if got, want := c.Components(), [][]int{{0, 2}, {1, 5}, {3}, {4}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("components %v, want %v", got, want)
+	}
+	if got, want := c.TxIds([]int{1, 5}), []uint{20, 70}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tx ids %v, want %v", got, want)
+	}
+}
+
+func TestDirectedCSR(t *testing.T) {
+	// 1 -> 3, 1 -> 5, 3 -> 5, 5 -> 7 and 9 alone
+	g := NewDirectedGraph()
+	for _, id := range []uint{9, 7, 5, 3, 1} {
+		g.AddVertex(common.Hash{}, id)
+	}
+	g.AddEdge(5, 7)
+	g.AddEdge(1, 5)
+	g.AddEdge(1, 3)
+	g.AddEdge(3, 5)
+	c := NewDirectedCSR(g)
+	if want := []uint{1, 3, 5, 7, 9}; !reflect.DeepEqual(c.Ids, want) {
+		t.Fatalf("ids %v, want %v", c.Ids, want)
+	}
+	if got := c.Neighbors(0); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("successors of 1 are %v, want the indices of 3 and 5", got)
+	}
+	if want := []int{0, 1, 2, 1, 0}; !reflect.DeepEqual(c.InDegree, want) {
+		t.Fatalf("in-degrees %v, want %v", c.InDegree, want)
+	}
+	if got, want := c.Layers(), [][]int{{0, 4}, {1}, {2}, {3}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(g.Clone(), g) || g.Vertices[5].Degree != 2 {
+		t.Fatal("the snapshot changed the graph")
+	}
+}
+
+// bfsComponents is the reference of Components on the maps of g
+func bfsComponents(g *UndirectedGraph) [][]uint {
+	ids := make([]uint, 0)
+	for id, v := range g.Vertices {
+		if !v.IsDeleted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	seen := make(map[uint]bool)
+	components := make([][]uint, 0)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		component := []uint{id}
+		for k := 0; k < len(component); k++ {
+			for _, n := range g.AdjacencyMap[component[k]] {
+				if !seen[n] && !g.Vertices[n].IsDeleted {
+					seen[n] = true
+					component = append(component, n)
+				}
+			}
+		}
+		sort.Slice(component, func(i, j int) bool { return component[i] < component[j] })
+		components = append(components, component)
+	}
+	return components
+}
+
+func TestCSRRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		g := NewUndirectedGraph()
+		n := 1 + r.Intn(80)
+		for i := 0; i < n; i++ {
+			g.AddVertex(common.Hash{}, uint(r.Intn(1000)))
+		}
+		ids := make([]uint, 0, len(g.Vertices))
+		for id := range g.Vertices {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for k := 0; k < n; k++ {
+			a, b := ids[r.Intn(len(ids))], ids[r.Intn(len(ids))]
+			if a != b {
+				g.AddEdge(a, b)
+			}
+		}
+		for k := 0; k < n/10; k++ {
+			g.Vertices[ids[r.Intn(len(ids))]].IsDeleted = true
+		}
+
+		c := NewCSR(g)
+		components := make([][]uint, 0)
+		for _, component := range c.Components() {
+			components = append(components, c.TxIds(component))
+		}
+		if want := bfsComponents(g); !reflect.DeepEqual(components, want) {
+			t.Fatalf("round %d: components %v, want %v", round, components, want)
+		}
+		for i := 0; i < c.Len(); i++ {
+			row := c.Neighbors(i)
+			if !sort.IntsAreSorted(row) {
+				t.Fatalf("round %d: row %d not sorted: %v", round, i, row)
+			}
+			for _, j := range row {
+				if !g.HasEdge(c.Ids[i], c.Ids[j]) || !c.HasEdge(j, i) {
+					t.Fatalf("round %d: edge %d-%d not in the graph or not symmetric", round, c.Ids[i], c.Ids[j])
+				}
+			}
+		}
+	}
+}
@@ -17,6 +17,20 @@ func NewDirectedGraph() *DirectedGraph {
 	}
 }
 
+// Clone returns a working copy of g
+func (g *DirectedGraph) Clone() *DirectedGraph {
+	NewG := NewDirectedGraph()
+	for id, v := range g.Vertices {
+		vertex := *v
+		NewG.Vertices[id] = &vertex
+		NewG.AdjacencyMap[id] = make(map[uint]struct{}, len(g.AdjacencyMap[id]))
+		for neighborid := range g.AdjacencyMap[id] {
+			NewG.AdjacencyMap[id][neighborid] = struct{}{}
+		}
+	}
+	return NewG
+}
+
 func (g *DirectedGraph) AddVertex(tx common.Hash, id uint) {
 	_, exist := g.Vertices[id]
 	if exist {
@@ -45,31 +59,50 @@ func (g *DirectedGraph) HasEdge(source, destination uint) bool {
 	return ok
 }
 
+// GetDegreeZero returns the in-degree layers of the graph in TxIds, each in increasing order. The graph is left unchanged
 func (g *DirectedGraph) GetDegreeZero() [][]uint {
+	csr := NewDirectedCSR(g)
 	ans := make([][]uint, 0)
-	degreeZero := make([]uint, 0)
+	for _, layer := range csr.Layers() {
+		ans = append(ans, csr.TxIds(layer))
+	}
+	return ans
+}
+
+// CriticalPath returns the bottom level of each vertex, i.e. the heaviest path starting from it,
+// and the heaviest path of the graph, which bounds any schedule of it. The graph is left unchanged
+func (g *DirectedGraph) CriticalPath(weight func(uint) uint64) (map[uint]uint64, uint64) {
+	inDegree := make(map[uint]uint, len(g.Vertices))
+	order := make([]uint, 0, len(g.Vertices))
 	for id, v := range g.Vertices {
+		inDegree[id] = v.Degree
 		if v.Degree == 0 {
-			degreeZero = append(degreeZero, id)
+			order = append(order, id)
+		}
+	}
+	// topological order, the edges go from the earlier tx to the later one
+	for i := 0; i < len(order); i++ {
+		for neighborid := range g.AdjacencyMap[order[i]] {
+			inDegree[neighborid]--
+			if inDegree[neighborid] == 0 {
+				order = append(order, neighborid)
+			}
 		}
 	}
-	ans = append(ans, degreeZero)
-	for {
-		newDegreeZero := make([]uint, 0)
-		for _, vid := range degreeZero {
-			for neighborid := range g.AdjacencyMap[vid] {
-				g.Vertices[neighborid].Degree--
-				if g.Vertices[neighborid].Degree == 0 {
-					newDegreeZero = append(newDegreeZero, neighborid)
-				}
+	level := make(map[uint]uint64, len(order))
+	bound := uint64(0)
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		longest := uint64(0)
+		for neighborid := range g.AdjacencyMap[id] {
+			if level[neighborid] > longest {
+				longest = level[neighborid]
 			}
 		}
-		degreeZero = newDegreeZero
-		if len(degreeZero) == 0 {
-			break
-		} else {
-			ans = append(ans, degreeZero)
+		level[id] = weight(id) + longest
+		if level[id] > bound {
+			bound = level[id]
 		}
 	}
-	return ans
+	return level, bound
 }
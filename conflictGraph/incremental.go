@@ -0,0 +1,310 @@
+package conflictgraph
+
+import (
+	"errors"
+	"interact/accesslist"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var ErrNoPrediction = errors.New("tx without a prediction")
+
+// IncrementalGraph is a conflict graph maintained one tx at a time, e.g. over a mempool.
+// The txs get increasing ids in arrival order and a conflict is directed from the earlier tx to the later one,
+// so the in-degree layers schedule the txs as if they ran in arrival order.
+// The connected components are kept in a union-find, a removal rebuilds the set of the removed tx,
+// which may fall apart. The layer of each tx is kept too, a removal lowers the layers after it
+type IncrementalGraph struct {
+	nextId uint
+	hashes map[uint]common.Hash
+	rwSets map[uint]*accesslist.RWSet
+	byAddr map[common.Address]map[uint]struct{} // the txs touching each address, the candidates for a conflict
+
+	neighbors map[uint]map[uint]struct{}
+	preds     map[uint]map[uint]struct{}
+	succs     map[uint]map[uint]struct{}
+
+	parent  map[uint]uint
+	members map[uint][]uint // by root
+
+	depth map[uint]int
+}
+
+func NewIncrementalGraph() *IncrementalGraph {
+	return &IncrementalGraph{
+		hashes:    make(map[uint]common.Hash),
+		rwSets:    make(map[uint]*accesslist.RWSet),
+		byAddr:    make(map[common.Address]map[uint]struct{}),
+		neighbors: make(map[uint]map[uint]struct{}),
+		preds:     make(map[uint]map[uint]struct{}),
+		succs:     make(map[uint]map[uint]struct{}),
+		parent:    make(map[uint]uint),
+		members:   make(map[uint][]uint),
+		depth:     make(map[uint]int),
+	}
+}
+
+func (g *IncrementalGraph) Len() int { return len(g.rwSets) }
+
+func (g *IncrementalGraph) Contains(id uint) bool {
+	_, ok := g.rwSets[id]
+	return ok
+}
+
+// AddTx adds a tx after all the txs in the graph and returns its id
+func (g *IncrementalGraph) AddTx(hash common.Hash, rwSet *accesslist.RWSet) (uint, error) {
+	if rwSet == nil {
+		return 0, ErrNoPrediction
+	}
+	id := g.nextId
+	g.nextId++
+	g.hashes[id] = hash
+	g.rwSets[id] = rwSet
+	g.neighbors[id] = make(map[uint]struct{})
+	g.preds[id] = make(map[uint]struct{})
+	g.succs[id] = make(map[uint]struct{})
+	g.parent[id] = id
+	g.members[id] = []uint{id}
+	g.depth[id] = 0
+
+	conflicts := g.Conflicting(rwSet)
+	for _, tuple := range []accesslist.ALTuple{rwSet.ReadSet, rwSet.WriteSet} {
+		for addr := range tuple {
+			if _, ok := g.byAddr[addr]; !ok {
+				g.byAddr[addr] = make(map[uint]struct{})
+			}
+			g.byAddr[addr][id] = struct{}{}
+		}
+	}
+	for _, other := range conflicts {
+		g.neighbors[id][other] = struct{}{}
+		g.neighbors[other][id] = struct{}{}
+		g.preds[id][other] = struct{}{}
+		g.succs[other][id] = struct{}{}
+		if g.depth[other]+1 > g.depth[id] {
+			g.depth[id] = g.depth[other] + 1
+		}
+		g.union(id, other)
+	}
+	return id, nil
+}
+
+// Conflicting returns the txs in the graph a tx with rwSet would conflict with, in increasing order,
+// without adding it
+func (g *IncrementalGraph) Conflicting(rwSet *accesslist.RWSet) []uint {
+	candidates := make(map[uint]struct{})
+	for _, tuple := range []accesslist.ALTuple{rwSet.ReadSet, rwSet.WriteSet} {
+		for addr := range tuple {
+			for other := range g.byAddr[addr] {
+				candidates[other] = struct{}{}
+			}
+		}
+	}
+	conflicts := make([]uint, 0)
+	for _, other := range sortedKeys(candidates) {
+		if rwSet.HasConflict(*g.rwSets[other]) {
+			conflicts = append(conflicts, other)
+		}
+	}
+	return conflicts
+}
+
+// RemoveTx removes a tx, e.g. once it is included in a block or dropped from the mempool
+func (g *IncrementalGraph) RemoveTx(id uint) {
+	rwSet, ok := g.rwSets[id]
+	if !ok {
+		return
+	}
+	for _, tuple := range []accesslist.ALTuple{rwSet.ReadSet, rwSet.WriteSet} {
+		for addr := range tuple {
+			delete(g.byAddr[addr], id)
+			if len(g.byAddr[addr]) == 0 {
+				delete(g.byAddr, addr)
+			}
+		}
+	}
+	for other := range g.neighbors[id] {
+		delete(g.neighbors[other], id)
+		delete(g.preds[other], id)
+		delete(g.succs[other], id)
+	}
+	succs := g.succs[id]
+	root := g.find(id)
+	rest := g.members[root]
+
+	delete(g.hashes, id)
+	delete(g.rwSets, id)
+	delete(g.neighbors, id)
+	delete(g.preds, id)
+	delete(g.succs, id)
+	delete(g.depth, id)
+	delete(g.members, root)
+	delete(g.parent, id)
+
+	g.rebuild(rest, id)
+	g.lowerDepths(succs)
+}
+
+func (g *IncrementalGraph) find(id uint) uint {
+	root := id
+	for g.parent[root] != root {
+		root = g.parent[root]
+	}
+	for id != root {
+		id, g.parent[id] = g.parent[id], root
+	}
+	return root
+}
+
+// union merges the smaller set into the larger one
+func (g *IncrementalGraph) union(a, b uint) {
+	ra, rb := g.find(a), g.find(b)
+	if ra == rb {
+		return
+	}
+	if len(g.members[ra]) < len(g.members[rb]) {
+		ra, rb = rb, ra
+	}
+	g.parent[rb] = ra
+	g.members[ra] = append(g.members[ra], g.members[rb]...)
+	delete(g.members, rb)
+}
+
+// rebuild splits the former set of a removed tx into the components of the txs left
+func (g *IncrementalGraph) rebuild(set []uint, removed uint) {
+	for _, id := range set {
+		if id != removed {
+			g.parent[id] = id
+			g.members[id] = []uint{id}
+		}
+	}
+	for _, id := range set {
+		if id == removed {
+			continue
+		}
+		for other := range g.neighbors[id] {
+			g.union(id, other)
+		}
+	}
+}
+
+// lowerDepths recomputes the layers after a removal in id order, which is a topological order
+func (g *IncrementalGraph) lowerDepths(from map[uint]struct{}) {
+	pending := make(map[uint]struct{}, len(from))
+	for id := range from {
+		pending[id] = struct{}{}
+	}
+	for len(pending) > 0 {
+		next := uint(0)
+		first := true
+		for id := range pending {
+			if first || id < next {
+				next, first = id, false
+			}
+		}
+		delete(pending, next)
+		depth := 0
+		for pred := range g.preds[next] {
+			if g.depth[pred]+1 > depth {
+				depth = g.depth[pred] + 1
+			}
+		}
+		if depth == g.depth[next] {
+			continue
+		}
+		g.depth[next] = depth
+		for succ := range g.succs[next] {
+			pending[succ] = struct{}{}
+		}
+	}
+}
+
+// Conflicts returns the txs in conflict with id in increasing order
+func (g *IncrementalGraph) Conflicts(id uint) []uint {
+	return sortedKeys(g.neighbors[id])
+}
+
+// Component returns the connected component of id in increasing order
+func (g *IncrementalGraph) Component(id uint) []uint {
+	if !g.Contains(id) {
+		return nil
+	}
+	component := append([]uint(nil), g.members[g.find(id)]...)
+	sort.Slice(component, func(i, j int) bool {
+		return component[i] < component[j]
+	})
+	return component
+}
+
+// Components returns the connected components by least member, each in increasing order
+func (g *IncrementalGraph) Components() [][]uint {
+	components := make([][]uint, 0, len(g.members))
+	for root := range g.members {
+		components = append(components, g.Component(root))
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+	return components
+}
+
+// Layer returns the in-degree layer of id, i.e. the longest chain of conflicts ending at it
+func (g *IncrementalGraph) Layer(id uint) int {
+	return g.depth[id]
+}
+
+// Layers returns the in-degree layers, each in increasing order, as DirectedGraph.GetDegreeZero does
+func (g *IncrementalGraph) Layers() [][]uint {
+	layers := make([][]uint, 0)
+	for _, id := range sortedKeys(g.rwSets) {
+		d := g.depth[id]
+		for len(layers) <= d {
+			layers = append(layers, make([]uint, 0))
+		}
+		layers[d] = append(layers[d], id)
+	}
+	return layers
+}
+
+// UndirectedGraph returns a working copy of the conflict graph for the schedulers on it
+func (g *IncrementalGraph) UndirectedGraph() *UndirectedGraph {
+	undiGraph := NewUndirectedGraph()
+	for id := range g.rwSets {
+		undiGraph.Vertices[id] = &Vertex{
+			TxId:   id,
+			TxHash: g.hashes[id],
+			Degree: uint(len(g.neighbors[id])),
+		}
+		undiGraph.AdjacencyMap[id] = sortedKeys(g.neighbors[id])
+	}
+	return undiGraph
+}
+
+// DirectedGraph returns a working copy of the directed conflict graph
+func (g *IncrementalGraph) DirectedGraph() *DirectedGraph {
+	diGraph := NewDirectedGraph()
+	for id := range g.rwSets {
+		diGraph.Vertices[id] = &Vertex{
+			TxId:   id,
+			TxHash: g.hashes[id],
+			Degree: uint(len(g.preds[id])),
+		}
+		diGraph.AdjacencyMap[id] = make(map[uint]struct{}, len(g.succs[id]))
+		for succ := range g.succs[id] {
+			diGraph.AdjacencyMap[id][succ] = struct{}{}
+		}
+	}
+	return diGraph
+}
+
+func sortedKeys[V any](m map[uint]V) []uint {
+	keys := make([]uint, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,88 @@
+package conflictgraph
+
+import (
+	"interact/accesslist"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// randomRWSet touches a few slots of 30 contracts, so that the components keep merging and splitting
+func randomRWSet(r *rand.Rand) *accesslist.RWSet {
+	rwSet := accesslist.NewRWSet()
+	for k := 0; k < 1+r.Intn(3); k++ {
+		addr := common.BigToAddress(big.NewInt(int64(r.Intn(30))))
+		slot := common.BigToHash(big.NewInt(int64(r.Intn(2))))
+		if r.Intn(2) == 0 {
+			rwSet.AddReadSet(addr, slot)
+		} else {
+			rwSet.AddWriteSet(addr, slot)
+		}
+	}
+	return rwSet
+}
+
+// batchGraphs builds the graphs from scratch over the txs left, in arrival order
+func batchGraphs(rwSets map[uint]*accesslist.RWSet) (*UndirectedGraph, *DirectedGraph) {
+	undiGraph, diGraph := NewUndirectedGraph(), NewDirectedGraph()
+	ids := sortedKeys(rwSets)
+	for _, id := range ids {
+		undiGraph.AddVertex(common.Hash{}, id)
+		diGraph.AddVertex(common.Hash{}, id)
+	}
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			if rwSets[a].HasConflict(*rwSets[b]) {
+				undiGraph.AddEdge(a, b)
+				diGraph.AddEdge(a, b)
+			}
+		}
+	}
+	return undiGraph, diGraph
+}
+
+func TestIncrementalGraph(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	g := NewIncrementalGraph()
+	live := make(map[uint]*accesslist.RWSet)
+	for step := 0; step < 600; step++ {
+		if len(live) > 0 && r.Intn(3) == 0 {
+			ids := sortedKeys(live)
+			id := ids[r.Intn(len(ids))]
+			g.RemoveTx(id)
+			delete(live, id)
+		} else {
+			rwSet := randomRWSet(r)
+			id, err := g.AddTx(common.Hash{}, rwSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			live[id] = rwSet
+		}
+
+		undiGraph, diGraph := batchGraphs(live)
+		want := make([][]uint, 0)
+		for _, component := range undiGraph.GetConnectedComponents() {
+			ids := make([]uint, len(component))
+			for k, v := range component {
+				ids[k] = v.TxId
+			}
+			want = append(want, ids)
+		}
+		if got := g.Components(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("step %d: components %v, want %v", step, got, want)
+		}
+		if got, want := g.Layers(), diGraph.GetDegreeZero(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("step %d: layers %v, want %v", step, got, want)
+		}
+		if got := g.DirectedGraph().GetDegreeZero(); !reflect.DeepEqual(got, g.Layers()) {
+			t.Fatalf("step %d: snapshot layers %v", step, got)
+		}
+	}
+	if _, err := g.AddTx(common.Hash{}, nil); err != ErrNoPrediction {
+		t.Fatalf("got %v, want %v", err, ErrNoPrediction)
+	}
+}
@@ -16,6 +16,20 @@ type Vertex struct {
 type UndirectedGraph struct {
 	Vertices     map[uint]*Vertex `json:"vertices"`     // 顶点集合
 	AdjacencyMap map[uint][]uint  `json:"adjacencyMap"` // 邻接边表
+
+	edges map[edgeKey]struct{} // the edges added so far, built from AdjacencyMap on the first AddEdge
+}
+
+// edgeKey is an undirected edge, the smaller TxId first
+type edgeKey struct {
+	a, b uint
+}
+
+func newEdgeKey(tx1, tx2 uint) edgeKey {
+	if tx1 > tx2 {
+		tx1, tx2 = tx2, tx1
+	}
+	return edgeKey{tx1, tx2}
 }
 
 // NewUndirectedGraph 创建一个新的无向图
@@ -26,20 +40,52 @@ func NewUndirectedGraph() *UndirectedGraph {
 	}
 }
 
+// CopyGraphWithDeletion returns a working copy of the vertices not deleted, g is left unchanged
 func (g *UndirectedGraph) CopyGraphWithDeletion() *UndirectedGraph {
+	return g.Subgraph(func(uint) bool { return true })
+}
+
+// Subgraph returns a working copy of the subgraph induced by the vertices not deleted for which keep is true,
+// the algorithms that mutate a graph run on such a copy so that one conflict graph can feed several schedulers
+func (g *UndirectedGraph) Subgraph(keep func(uint) bool) *UndirectedGraph {
+	kept := make(map[uint]bool, len(g.Vertices))
+	for id, v := range g.Vertices {
+		kept[id] = !v.IsDeleted && keep(id)
+	}
 	NewG := NewUndirectedGraph()
 	for id, v := range g.Vertices {
-		if !v.IsDeleted {
-			NewG.AddVertex(v.TxHash, id)
+		if !kept[id] {
+			continue
 		}
-	}
-	for id := range NewG.Vertices {
+		neighbors := make([]uint, 0, len(g.AdjacencyMap[id]))
 		for _, neighborId := range g.AdjacencyMap[id] {
-			neighbor := g.Vertices[neighborId]
-			if !neighbor.IsDeleted {
-				NewG.AddEdge(id, neighbor.TxId)
+			if kept[neighborId] {
+				neighbors = append(neighbors, neighborId)
 			}
 		}
+		NewG.Vertices[id] = &Vertex{
+			TxId:   id,
+			TxHash: v.TxHash,
+			Degree: uint(len(neighbors)),
+		}
+		NewG.AdjacencyMap[id] = neighbors
+	}
+	return NewG
+}
+
+// Clone returns a working copy of g, the deleted vertices included
+func (g *UndirectedGraph) Clone() *UndirectedGraph {
+	NewG := NewUndirectedGraph()
+	for id, v := range g.Vertices {
+		vertex := *v
+		NewG.Vertices[id] = &vertex
+		NewG.AdjacencyMap[id] = append(make([]uint, 0, len(g.AdjacencyMap[id])), g.AdjacencyMap[id]...)
+	}
+	if g.edges != nil {
+		NewG.edges = make(map[edgeKey]struct{}, len(g.edges))
+		for key := range g.edges {
+			NewG.edges[key] = struct{}{}
+		}
 	}
 	return NewG
 }
@@ -60,11 +106,21 @@ func (g *UndirectedGraph) AddVertex(tx common.Hash, id uint) {
 	g.AdjacencyMap[id] = make([]uint, 0)
 }
 
-// AddEdge 向图中添加一条边
+// AddEdge 向图中添加一条边, an edge added before is looked up in a set rather than in the adjacency list
 func (g *UndirectedGraph) AddEdge(source, destination uint) {
-	if g.HasEdge(source, destination) {
+	if g.edges == nil {
+		g.edges = make(map[edgeKey]struct{})
+		for id, neighbors := range g.AdjacencyMap {
+			for _, neighborId := range neighbors {
+				g.edges[newEdgeKey(id, neighborId)] = struct{}{}
+			}
+		}
+	}
+	key := newEdgeKey(source, destination)
+	if _, ok := g.edges[key]; ok {
 		return
 	}
+	g.edges[key] = struct{}{}
 	g.AdjacencyMap[source] = append(g.AdjacencyMap[source], destination)
 	g.AdjacencyMap[destination] = append(g.AdjacencyMap[destination], source)
 	g.Vertices[source].Degree++
@@ -96,31 +152,16 @@ func (g *UndirectedGraph) RemoveVertex(tx uint) {
 	}
 }
 
-// GetConnectedComponents 获取图中的连通分量（使用深度优先搜索）
+// GetConnectedComponents 获取图中的连通分量, 按最小的TxId排序, 分量内按TxId排序
 func (g *UndirectedGraph) GetConnectedComponents() [][]*Vertex {
-	visited := make(map[*Vertex]bool)
-	components := [][]*Vertex{}
-
-	for _, v := range g.Vertices {
-		if !visited[v] && !v.IsDeleted {
-			component := []*Vertex{}
-			g.dfs(v, visited, &component)
-			components = append(components, component)
+	csr := NewCSR(g)
+	components := make([][]*Vertex, 0)
+	for _, component := range csr.Components() {
+		vertices := make([]*Vertex, len(component))
+		for k, i := range component {
+			vertices[k] = g.Vertices[csr.Ids[i]]
 		}
+		components = append(components, vertices)
 	}
-
 	return components
 }
-
-// dfs 深度优先搜索函数
-func (g *UndirectedGraph) dfs(v *Vertex, visited map[*Vertex]bool, component *[]*Vertex) {
-	visited[v] = true
-	*component = append(*component, v)
-
-	for _, neighborId := range g.AdjacencyMap[v.TxId] {
-		neighbor := g.Vertices[neighborId]
-		if !visited[neighbor] && !neighbor.IsDeleted {
-			g.dfs(neighbor, visited, component)
-		}
-	}
-}
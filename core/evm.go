@@ -25,6 +25,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // ChainContext supports retrieving headers and consensus parameters from the
@@ -33,16 +34,35 @@ type ChainContext interface {
 	// Engine retrieves the chain's consensus engine.
 	// Engine() consensus.Engine
 
+	// Config returns the chain's fork configuration.
+	Config() *params.ChainConfig
+
 	// GetHeader returns the header corresponding to the hash/number argument pair.
 	GetHeader(common.Hash, uint64) *types.Header
 }
 
 type FakeChainContext struct {
 	chainDB ethdb.Database
+	config  *params.ChainConfig
 }
 
+// NewFakeChainContext uses the chain config stored with the genesis block,
+// and the mainnet config if the database has none
 func NewFakeChainContext(chainDB ethdb.Database) *FakeChainContext {
-	return &FakeChainContext{chainDB: chainDB}
+	config := rawdb.ReadChainConfig(chainDB, rawdb.ReadCanonicalHash(chainDB, 0))
+	if config == nil {
+		config = params.MainnetChainConfig
+	}
+	return NewFakeChainContextWithConfig(chainDB, config)
+}
+
+// NewFakeChainContextWithConfig is for the chains without a stored config, e.g. the synthetic fixture
+func NewFakeChainContextWithConfig(chainDB ethdb.Database, config *params.ChainConfig) *FakeChainContext {
+	return &FakeChainContext{chainDB: chainDB, config: config}
+}
+
+func (f *FakeChainContext) Config() *params.ChainConfig {
+	return f.config
 }
 
 func (f *FakeChainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
@@ -139,11 +159,17 @@ func GetHashFn(ref *types.Header, chain ChainContext) func(n uint64) common.Hash
 // CanTransfer checks whether there are enough funds in the address' account to make a transfer.
 // This does not take the necessary gas in to account to make the transfer valid.
 func CanTransfer(db vm.StateDB, addr common.Address, amount *big.Int) bool {
-	return true
-	// if amount.Sign() == 0 {
-	// 	return true
-	// }
-	// return db.GetBalance(addr).Cmp(amount) >= 0
+	if amount.Sign() == 0 {
+		return true
+	}
+	switch GetTransferMode() {
+	case TransferDisabled:
+		return true
+	case TransferDelta:
+		// validated when the deltas are committed
+		return true
+	}
+	return db.GetBalance(addr).Cmp(amount) >= 0
 }
 
 // Transfer subtracts amount from sender and adds amount to recipient using the given Db
@@ -151,6 +177,16 @@ func Transfer(db vm.StateDB, sender, recipient common.Address, amount *big.Int)
 	if amount.Sign() == 0 {
 		return
 	}
-	// db.SubBalance(sender, amount)
-	// db.AddBalance(recipient, amount)
+	switch GetTransferMode() {
+	case TransferDisabled:
+		return
+	case TransferDelta:
+		if recorder, ok := db.(BalanceDeltaRecorder); ok {
+			recorder.AddBalanceDelta(sender, new(big.Int).Neg(amount))
+			recorder.AddBalanceDelta(recipient, amount)
+			return
+		}
+	}
+	db.SubBalance(sender, amount)
+	db.AddBalance(recipient, amount)
 }
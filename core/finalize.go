@@ -0,0 +1,66 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ProcessBeaconBlockRoot applies the EIP-4788 system call to the beacon block root contract,
+// it is the same as geth's but takes any vm.StateDB and leaves the state unfinalised
+func ProcessBeaconBlockRoot(beaconRoot common.Hash, vmenv *vm.EVM, statedb vm.StateDB) {
+	msg := &Message{
+		From:      params.SystemAddress,
+		GasLimit:  30_000_000,
+		GasPrice:  common.Big0,
+		GasFeeCap: common.Big0,
+		GasTipCap: common.Big0,
+		To:        &params.BeaconRootsStorageAddress,
+		Data:      beaconRoot[:],
+	}
+	vmenv.Reset(NewEVMTxContext(msg), statedb)
+	statedb.AddAddressToAccessList(params.BeaconRootsStorageAddress)
+	_, _, _ = vmenv.Call(vm.AccountRef(msg.From), *msg.To, msg.Data, 30_000_000, common.Big0)
+}
+
+// AccumulateRewards credits the coinbase of a pre-merge block with the block reward
+// and the rewards for the uncles, the coinbase of each uncle is rewarded too, as ethash does
+func AccumulateRewards(config *params.ChainConfig, statedb vm.StateDB, header *types.Header, uncles []*types.Header) {
+	blockReward := ethash.FrontierBlockReward
+	if config.IsByzantium(header.Number) {
+		blockReward = ethash.ByzantiumBlockReward
+	}
+	if config.IsConstantinople(header.Number) {
+		blockReward = ethash.ConstantinopleBlockReward
+	}
+	reward := new(big.Int).Set(blockReward)
+	r := new(big.Int)
+	for _, uncle := range uncles {
+		r.Add(uncle.Number, big.NewInt(8))
+		r.Sub(r, header.Number)
+		r.Mul(r, blockReward)
+		r.Div(r, big.NewInt(8))
+		statedb.AddBalance(uncle.Coinbase, new(big.Int).Set(r))
+
+		r.Div(blockReward, big.NewInt(32))
+		reward.Add(reward, r)
+	}
+	statedb.AddBalance(header.Coinbase, reward)
+}
+
+// ProcessWithdrawals credits the shanghai withdrawals, whose amounts are in gwei
+func ProcessWithdrawals(statedb vm.StateDB, withdrawals []*types.Withdrawal) {
+	for _, w := range withdrawals {
+		if w.Amount == 0 {
+			// geth drops the empty account touched by a zero withdrawal when finalising
+			continue
+		}
+		amount := new(big.Int).SetUint64(w.Amount)
+		amount.Mul(amount, big.NewInt(params.GWei))
+		statedb.AddBalance(w.Address, amount)
+	}
+}
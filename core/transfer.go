@@ -0,0 +1,82 @@
+package core
+
+import (
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// TransferMode selects how value transfers are executed, set once per run with SetTransferMode
+type TransferMode int32
+
+const (
+	// TransferDisabled drops value transfers and never reverts on insufficient balance,
+	// which was the behaviour of the harness before
+	TransferDisabled TransferMode = iota
+	// TransferStrict moves the value on the state and checks the balance, as serial execution does
+	TransferStrict
+	// TransferDelta records the value as balance deltas on a BalanceDeltaRecorder,
+	// the deltas commute, and the executor applies and validates them at commit time.
+	// The balance is not checked during execution, other states apply the value right away
+	TransferDelta
+)
+
+var transferMode atomic.Int32
+
+func init() {
+	SetTransferMode(TransferStrict)
+}
+
+func SetTransferMode(mode TransferMode) {
+	transferMode.Store(int32(mode))
+}
+
+func GetTransferMode() TransferMode {
+	return TransferMode(transferMode.Load())
+}
+
+func (mode TransferMode) String() string {
+	switch mode {
+	case TransferDisabled:
+		return "disabled"
+	case TransferStrict:
+		return "strict"
+	case TransferDelta:
+		return "delta"
+	}
+	return "unknown"
+}
+
+// BalanceDeltaRecorder is a state keeping the value transfers of TransferDelta aside until commit
+type BalanceDeltaRecorder interface {
+	AddBalanceDelta(addr common.Address, delta *big.Int)
+}
+
+// chargeGas takes the gas payment amount from addr according to GetTransferMode,
+// TransferDisabled never buys gas, so that it never refunds nor pays the coinbase either
+func chargeGas(db vm.StateDB, addr common.Address, amount *big.Int) {
+	payGas(db, addr, new(big.Int).Neg(amount))
+}
+
+// payGas credits a gas refund or the coinbase tip to addr according to GetTransferMode
+func payGas(db vm.StateDB, addr common.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	switch GetTransferMode() {
+	case TransferDisabled:
+		return
+	case TransferDelta:
+		if recorder, ok := db.(BalanceDeltaRecorder); ok {
+			recorder.AddBalanceDelta(addr, amount)
+			return
+		}
+	}
+	if amount.Sign() < 0 {
+		db.SubBalance(addr, new(big.Int).Neg(amount))
+	} else {
+		db.AddBalance(addr, amount)
+	}
+}
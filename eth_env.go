@@ -0,0 +1,36 @@
+package main
+
+import (
+	statedb "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/ethereum/go-ethereum/trie/triedb/pathdb"
+)
+
+// getEthDatabaseAndStateDatabase get node, ethdb and state database(eth env)
+func getEthDatabaseAndStateDatabase() (*node.Node, ethdb.Database, statedb.Database) {
+	nodeCfg := node.Config{DataDir: "/mnt/disk1/xsp/chaindata/execution/"}
+	Node, err := node.New(&nodeCfg)
+	if err != nil {
+		panic(err)
+	}
+
+	ethCfg := ethconfig.Defaults
+	chainDB, err := Node.OpenDatabase("chaindata", ethCfg.DatabaseCache, ethCfg.DatabaseHandles, "eth/db/chaindata/", true)
+	if err != nil {
+		panic(err)
+	}
+
+	config := &trie.Config{Preimages: ethCfg.Preimages}
+	config.PathDB = &pathdb.Config{
+		StateHistory:   ethCfg.StateHistory,
+		CleanCacheSize: 256 * 1024 * 1024,
+		DirtyCacheSize: 256 * 1024 * 1024,
+	}
+
+	trieDB := trie.NewDatabase(chainDB, config)
+	sdbBackend := statedb.NewDatabaseWithNodeDB(chainDB, trieDB)
+	return Node, chainDB, sdbBackend
+}
@@ -8,6 +8,7 @@ import (
 	"interact/tracer"
 	"interact/utils"
 	testfunc "interact/utils/testFunc"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,6 +20,9 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
+// warmCacheSize is the capacity in bytes of the warm cache kept across the blocks by the executors of several blocks
+const warmCacheSize = 64 << 20
+
 func ExecSerial(chainDB ethdb.Database, sdbBackend ethState.Database, startNum, endNum uint64) error {
 	fmt.Println("SerialExecution")
 	fakeChainCtx := core.NewFakeChainContext(chainDB)
@@ -48,12 +52,20 @@ func ExecSerial(chainDB ethdb.Database, sdbBackend ethState.Database, startNum,
 		}
 		state.StartPrefetcher("miner")
 		defer state.StopPrefetcher()
+		// the blocks are read before the timer, so that only the execution is timed
+		blocks := make([]*types.Block, len(txs))
+		for i := range blocks {
+			blocks[i], _ = utils.GetBlockAndHeader(chainDB, startNum+uint64(i))
+		}
 
 		// set the satrt time
 		start := time.Now()
 		// test the serial execution
 		for i := 0; i < len(txs); i++ {
+			block := blocks[i]
+			utils.PrepareBlock(state, block, fakeChainCtx)
 			tracer.ExecuteTxs(state, txs[i], headers[i], fakeChainCtx)
+			utils.FinalizeBlock(state, block, fakeChainCtx)
 		}
 		// cal the execution time
 		elapsed := time.Since(start)
@@ -99,15 +111,22 @@ func ExecWithConnectedComponents(chainDB ethdb.Database, sdbBackend ethState.Dat
 		txGroupsList := make([][]types.Transactions, len(txs))
 		RWSetGroupsList := make([][]accesslist.RWSetList, len(txs))
 		for i := 0; i < len(txs); i++ {
-			txGroupsList[i], RWSetGroupsList[i] = utils.GenerateTxAndRWSetGroups(txs[i], predictRWSets[i])
+			txGroupsList[i], RWSetGroupsList[i], err = utils.GenerateTxAndRWSetGroups(txs[i], predictRWSets[i])
+			if err != nil {
+				return err
+			}
 		}
 		elapsed := time.Since(start)
 		fmt.Println("Generate TxGroups Costs:", elapsed)
 
 		// !!! Our Prefetch is less efficient than StateDB.Prefetch !!!
 
+		warm := interactState.NewWarmCache(warmCacheSize)
 		for i := 0; i < len(txs); i++ {
-			utils.GenerateCacheStates(state, RWSetGroupsList[i]) // trick!!!!!!!!!!!
+			block, _ := utils.GetBlockAndHeader(chainDB, startNum+uint64(i))
+			utils.InvalidatePrepare(warm, state, block, fakeChainCtx)
+			utils.PrepareBlock(state, block, fakeChainCtx)
+			utils.GenerateCacheStates(warm.Reader(state), RWSetGroupsList[i]) // trick!!!!!!!!!!!
 
 			st := time.Now()
 			PureExecutionCost := time.Duration(0)
@@ -115,7 +134,7 @@ func ExecWithConnectedComponents(chainDB ethdb.Database, sdbBackend ethState.Dat
 			PureMergeCost := time.Duration(0)
 
 			startPrefetch := time.Now()
-			cacheStates := utils.GenerateCacheStates(state, RWSetGroupsList[i]) // This step is to warm up the cache
+			cacheStates := utils.GenerateCacheStates(warm.Reader(state), RWSetGroupsList[i]) // This step is to warm up the cache
 			PurePrefetchCost = time.Since(startPrefetch)
 			// fmt.Println("Prefetching Costs:", elapsedPrefetch)
 
@@ -132,15 +151,24 @@ func ExecWithConnectedComponents(chainDB ethdb.Database, sdbBackend ethState.Dat
 			// fmt.Println("Longest Task Costs for Execution Costs:", timeCost)
 			// timeCost = time.Duration(0)
 
+			// the writes merged into state are dropped from the warm cache
+			merged, written := utils.RecordWrites(state)
 			startMerge := time.Now()
-			utils.MergeToState(cacheStates, state)
+			utils.MergeToState(cacheStates, merged)
 			PureMergeCost = time.Since(startMerge)
+			barrier, err := utils.FinishBlock(state, utils.WholeState{StateInterface: merged}, block, predictRWSets[i], fakeChainCtx, nil)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Barrier Txs:", barrier)
+			utils.InvalidateBlock(warm, written.WriteSet)
 
 			fmt.Println("Execution Time:", time.Since(st))
 			fmt.Println("PureExecution Time:", PureExecutionCost)
 			fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 			fmt.Println("PureMergeInTurn Time:", PureMergeCost)
 		}
+		fmt.Println(warm.Stats())
 	}
 
 	return nil
@@ -163,12 +191,20 @@ func ExecWithDegreeZero(chainDB ethdb.Database, sdbBackend ethState.Database, st
 		defer antsPool.Release()
 		var antsWG sync.WaitGroup
 
+		warm := interactState.NewWarmCache(warmCacheSize)
 		for i := 0; i < len(txs); i++ {
 			// the i'th block
 			st := time.Now()
-			groups := utils.GenerateDegreeZeroGroups(txs[i], predictRWSets[i])
+			groups, err := utils.GenerateDegreeZeroGroups(txs[i], predictRWSets[i])
+			if err != nil {
+				return err
+			}
 			fmt.Println("Generate TxGroups:", time.Since(st))
+			block, _ := utils.GetBlockAndHeader(chainDB, startNum+uint64(i))
+			utils.InvalidatePrepare(warm, state, block, fakeChainCtx)
+			utils.PrepareBlock(state, block, fakeChainCtx)
 			fullcache := interactState.NewCacheState()
+			fullcache.SetWarmCache(warm)
 			// here we don't pre warm the data
 			fullcache.Prefetch(state, predictRWSets[i])
 			st = time.Now()
@@ -203,13 +239,22 @@ func ExecWithDegreeZero(chainDB ethdb.Database, sdbBackend ethState.Database, st
 				utils.MergeToState(cacheStates, fullcache)
 				PureMergeCost += time.Since(mergest)
 			}
-			utils.MergeToState(interactState.CacheStateList{fullcache}, state)
+			// the writes merged into state are dropped from the warm cache
+			merged, written := utils.RecordWrites(state)
+			utils.MergeToState(interactState.CacheStateList{fullcache}, merged)
+			barrier, err := utils.FinishBlock(state, utils.WholeState{StateInterface: merged}, block, predictRWSets[i], fakeChainCtx, nil)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Barrier Txs:", barrier)
+			utils.InvalidateBlock(warm, written.WriteSet)
 
 			fmt.Println("Execution Time:", time.Since(st))
 			fmt.Println("PureExection Time:", PureExecutionCost)
 			fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 			fmt.Println("PureMergeInTurn Time:", PureMergeCost)
 		}
+		fmt.Println(warm.Stats())
 
 	}
 
@@ -233,12 +278,20 @@ func ExecWithMIS(chainDB ethdb.Database, sdbBackend ethState.Database, startNum,
 		defer antsPool.Release()
 		var antsWG sync.WaitGroup
 
+		warm := interactState.NewWarmCache(warmCacheSize)
 		for i := 0; i < len(txs); i++ {
 			// the i'th block
 			st := time.Now()
-			groups := utils.GenerateMISGroups(txs[i], predictRWSets[i])
+			groups, err := utils.GenerateMISGroups(txs[i], predictRWSets[i])
+			if err != nil {
+				return err
+			}
 			fmt.Println("Generate TxGroups:", time.Since(st))
+			block, _ := utils.GetBlockAndHeader(chainDB, startNum+uint64(i))
+			utils.InvalidatePrepare(warm, state, block, fakeChainCtx)
+			utils.PrepareBlock(state, block, fakeChainCtx)
 			fullcache := interactState.NewCacheState()
+			fullcache.SetWarmCache(warm)
 
 			// here we don't pre warm the data
 			fullcache.Prefetch(state, predictRWSets[i])
@@ -274,12 +327,21 @@ func ExecWithMIS(chainDB ethdb.Database, sdbBackend ethState.Database, startNum,
 				utils.MergeToState(cacheStates, fullcache)
 				PureMergeCost += time.Since(mergest)
 			}
-			utils.MergeToState(interactState.CacheStateList{fullcache}, state)
+			// the writes merged into state are dropped from the warm cache
+			merged, written := utils.RecordWrites(state)
+			utils.MergeToState(interactState.CacheStateList{fullcache}, merged)
+			barrier, err := utils.FinishBlock(state, utils.WholeState{StateInterface: merged}, block, predictRWSets[i], fakeChainCtx, nil)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Barrier Txs:", barrier)
+			utils.InvalidateBlock(warm, written.WriteSet)
 			fmt.Println("Execution Time:", time.Since(st))
 			fmt.Println("PureExection Time:", PureExecutionCost)
 			fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 			fmt.Println("PureMergeInTurn Time:", PureMergeCost)
 		}
+		fmt.Println(warm.Stats())
 	}
 	return nil
 }
@@ -301,6 +363,7 @@ func ExecAriaMultiRoundWithConcurrentState(chainDB ethdb.Database, sdbBackend et
 		defer antsPool.Release()
 		var antsWG sync.WaitGroup
 
+		warm := interactState.NewWarmCache(warmCacheSize)
 		// for i'th block
 		for i := 0; i < len(txs); i++ {
 			PureExecutionCost := time.Duration(0)
@@ -313,10 +376,15 @@ func ExecAriaMultiRoundWithConcurrentState(chainDB ethdb.Database, sdbBackend et
 			}
 
 			// make a fullcache containing both predictList and trueList
-			trueRWlists, _ := testfunc.TrueRWSets(txs[i], chainDB, sdbBackend, startNum+uint64(i))
-			fullcache := interactState.NewFullCacheConcurrent()
-			fullcache.Prefetch(state, trueRWlists)
-			fullcache.Prefetch(state, predictRWSets[i])
+			trueRWlists, err := testfunc.TrueRWSets(txs[i], chainDB, sdbBackend, startNum+uint64(i))
+			if err != nil {
+				return err
+			}
+			block, _ := utils.GetBlockAndHeader(chainDB, startNum+uint64(i))
+			fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, warm, trueRWlists, predictRWSets[i])
+			meter := utils.NewBlockGasMeter(txs[i], headers[i])
+			// the write sets of the merged snapshots are dropped from the warm cache
+			written := make([]accesslist.ALTuple, 0, len(txs[i])+1)
 
 			for {
 				fmt.Println("Execute Parallel:", len(txListIndex))
@@ -337,7 +405,7 @@ func ExecAriaMultiRoundWithConcurrentState(chainDB ethdb.Database, sdbBackend et
 				writeReserve := accesslist.NewReserveSet()
 
 				execSt := time.Now()
-				errs := tracer.ExecWithSnapshotState(antsPool, txs[i], txListIndex, snapshots, headers[i], fakeChainCtx, &antsWG, readReserve, writeReserve)
+				errs, gasUsed := tracer.ExecWithSnapshotState(antsPool, txs[i], txListIndex, snapshots, headers[i], fakeChainCtx, &antsWG, readReserve, writeReserve)
 				PureExecutionCost = PureExecutionCost + time.Since(execSt)
 				fmt.Println("Exec Time:", time.Since(execSt))
 
@@ -358,26 +426,54 @@ func ExecAriaMultiRoundWithConcurrentState(chainDB ethdb.Database, sdbBackend et
 						} else {
 							nextTxlistIndex = append(nextTxlistIndex, index)
 						}
+					} else {
+						// both RAW and WAR
+						nextTxlistIndex = append(nextTxlistIndex, index)
 					}
 				}
 				commitCacheStates := make(interactState.CacheStateList, len(canCommit))
+				commitTxs := make(types.Transactions, len(canCommit))
+				commitGasUsed := make([]uint64, len(canCommit))
 				for k, j := range canCommit {
 					commitCacheStates[k] = snapshots[j].GetStateDB().(*interactState.CacheState)
+					commitTxs[k] = txs[i][txListIndex[j]]
+					commitGasUsed[k] = gasUsed[j]
 				}
 
 				mergeSt := time.Now()
-				utils.MergeToCacheStateConcurrent(antsPool, commitCacheStates, fullcache, &antsWG)
+				mergeErrs := utils.MergeToCacheStateConcurrent(antsPool, commitCacheStates, fullcache, &antsWG)
 				PureMergeCost = PureMergeCost + time.Since(mergeSt)
+				if err := meter.Commit(commitTxs, commitGasUsed, mergeErrs); err != nil {
+					return err
+				}
+				for k, j := range canCommit {
+					if mergeErrs[k] != nil {
+						// the balance deltas are invalid, the tx runs again next round
+						nextTxlistIndex = append(nextTxlistIndex, txListIndex[j])
+						continue
+					}
+					written = append(written, snapshots[j].GetRWSet().WriteSet)
+				}
+				sort.Ints(nextTxlistIndex)
 
 				txListIndex = nextTxlistIndex
 				if len(txListIndex) == 0 {
 					break
 				}
 			}
+			finalizer, finalized := utils.RecordWrites(interactState.NewConcurrentTxState(fullcache))
+			utils.FinalizeBlock(finalizer, block, fakeChainCtx)
+			written = append(written, finalized.WriteSet)
 			fmt.Println("PureExecution Time:", PureExecutionCost)
 			fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 			fmt.Println("PureMergeInTurn Time:", PureMergeCost)
+			if err := meter.Check(); err != nil {
+				return err
+			}
+			fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", headers[i].GasUsed)
+			utils.InvalidateBlock(warm, written...)
 		}
+		fmt.Println(warm.Stats())
 
 	}
 
@@ -398,15 +494,18 @@ func ExecWithConnectedComponentsConcurrentCacheState(chainDB ethdb.Database, sdb
 	}
 
 	start := time.Now()
-	txGroupsList, RWSetGroupsList := utils.GenerateTxAndRWSetGroups(txs, predictRwSets)
+	txGroupsList, RWSetGroupsList, err := utils.GenerateTxAndRWSetGroups(txs, predictRwSets)
+	if err != nil {
+		return err
+	}
 	elapsed := time.Since(start)
 	fmt.Println("Generate TxGroups Costs:", elapsed)
 
 	// !!! Our Prefetch is less efficient than StateDB.Prefetch !!!
 
-	fullcache := interactState.NewFullCacheConcurrent()
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
 	// here we don't pre warm the data
-	fullcache.Prefetch(state, predictRwSets)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets)
 
 	st := time.Now()
 	PureExecutionCost := time.Duration(0)
@@ -417,19 +516,121 @@ func ExecWithConnectedComponentsConcurrentCacheState(chainDB ethdb.Database, sdb
 	cacheStates := utils.GenerateCacheStatesConcurrent(antsPool, fullcache, RWSetGroupsList, &antsWG)
 	PurePrefetchCost = time.Since(startPrefetch)
 
+	meter := utils.NewBlockGasMeter(txs, header)
+	for _, group := range txGroupsList {
+		if err := meter.Admit(group); err != nil {
+			return err
+		}
+	}
 	start = time.Now()
-	tracer.ExecConflictedTxs(antsPool, txGroupsList, cacheStates, header, fakeChainCtx, &antsWG)
+	errss, gasUsed := tracer.ExecConflictedTxs(antsPool, txGroupsList, cacheStates, header, fakeChainCtx, &antsWG)
 	PureExecutionCost = time.Since(start)
 
 	startMerge := time.Now()
-	utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
+	mergeErrs := utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
 	PureMergeCost = time.Since(startMerge)
+	for i, group := range txGroupsList {
+		if mergeErrs[i] != nil {
+			continue
+		}
+		if err := meter.Commit(group, gasUsed[i], errss[i]); err != nil {
+			return err
+		}
+	}
+	// the groups failing to merge merged nothing, their txs are executed again one after another
+	retryTxs, retryErrs, retryGasUsed := utils.ExecBarrierRound(state, interactState.NewConcurrentTxState(fullcache),
+		utils.FailedGroups(txs, txGroupsList, mergeErrs), txs, header, fakeChainCtx)
+	if err := meter.Commit(retryTxs, retryGasUsed, retryErrs); err != nil {
+		return err
+	}
 
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
 	fmt.Println("PureExecution Time:", PureExecutionCost)
 	fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 	fmt.Println("PureMergeInTurn Time:", PureMergeCost)
+	return nil
+}
+
+func ExecWithPackedComponentsConcurrentCacheState(chainDB ethdb.Database, sdbBackend ethState.Database, height uint64) error {
+	fmt.Println("Packed Connected Components Solution Concurrent CacheState")
+	txs, predictRwSets, header, fakeChainCtx := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, height)
+
+	var antsWG sync.WaitGroup
+	antsPool, _ := ants.NewPool(16, ants.WithPreAlloc(true))
+	defer antsPool.Release()
+
+	state, err := utils.GetState(chainDB, sdbBackend, height-1)
+	if err != nil {
+		return err
+	}
+
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
+	start := time.Now()
+	txStages, RWSetStages, err := utils.GenerateLPTStages(txs, predictRwSets, utils.TxGasWeights(chainDB, block, fakeChainCtx.Config()), antsPool.Cap())
+	if err != nil {
+		return err
+	}
+	fmt.Println("Generate TxGroups Costs:", time.Since(start))
+	fmt.Println("Stages:", len(txStages))
+
+	// here we don't pre warm the data
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets)
 
+	st := time.Now()
+	PureExecutionCost := time.Duration(0)
+	PurePrefetchCost := time.Duration(0) // without considering the very first fullcache prefetch
+	PureMergeCost := time.Duration(0)
+
+	meter := utils.NewBlockGasMeter(txs, header)
+	for stage := range txStages {
+		startPrefetch := time.Now()
+		cacheStates := utils.GenerateCacheStatesConcurrent(antsPool, fullcache, RWSetStages[stage], &antsWG)
+		PurePrefetchCost += time.Since(startPrefetch)
+
+		for _, group := range txStages[stage] {
+			if err := meter.Admit(group); err != nil {
+				return err
+			}
+		}
+		start = time.Now()
+		errss, gasUsed := tracer.ExecConflictedTxs(antsPool, txStages[stage], cacheStates, header, fakeChainCtx, &antsWG)
+		PureExecutionCost += time.Since(start)
+
+		startMerge := time.Now()
+		mergeErrs := utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
+		PureMergeCost += time.Since(startMerge)
+		for i, group := range txStages[stage] {
+			if mergeErrs[i] != nil {
+				continue
+			}
+			if err := meter.Commit(group, gasUsed[i], errss[i]); err != nil {
+				return err
+			}
+		}
+		// the groups failing to merge merged nothing, their txs are executed again before the next stage depends on them
+		retryTxs, retryErrs, retryGasUsed := utils.ExecBarrierRound(state, interactState.NewConcurrentTxState(fullcache),
+			utils.FailedGroups(txs, txStages[stage], mergeErrs), txs, header, fakeChainCtx)
+		if err := meter.Commit(retryTxs, retryGasUsed, retryErrs); err != nil {
+			return err
+		}
+	}
+
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
+	fmt.Println("PureExecution Time:", PureExecutionCost)
+	fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
+	fmt.Println("PureMergeInTurn Time:", PureMergeCost)
 	return nil
 }
 
@@ -449,11 +650,15 @@ func ExecWithDegreeZeroConcurrentCacheState(chainDB ethdb.Database, sdbBackend e
 
 	// the i'th block
 	st := time.Now()
-	groups := utils.GenerateDegreeZeroGroups(txs, predictRwSets)
+	groups, err := utils.GenerateDegreeZeroGroups(txs, predictRwSets)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Generate TxGroups:", time.Since(st))
-	fullcache := interactState.NewFullCacheConcurrent()
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
 	// here we don't pre warm the data
-	fullcache.Prefetch(state, predictRwSets)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets)
+	meter := utils.NewBlockGasMeter(txs, header)
 	st = time.Now()
 	PureExecutionCost := time.Duration(0)
 	PurePrefetchCost := time.Duration(0) // without considering the very first fullcache prefetch
@@ -466,22 +671,39 @@ func ExecWithDegreeZeroConcurrentCacheState(chainDB ethdb.Database, sdbBackend e
 		txsToExec, cacheStates := utils.GenerateTxsAndCacheStatesWithAnts(antsPool, fullcache, groups[round], txs, predictRwSets, &antsWG)
 		PurePrefetchCost += time.Since(prefst)
 
+		if err := meter.Admit(txsToExec); err != nil {
+			return err
+		}
 		execst := time.Now()
-		tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, header, fakeChainCtx, &antsWG)
+		errs, gasUsed := tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, header, fakeChainCtx, &antsWG)
 		PureExecutionCost += time.Since(execst)
 		mergest := time.Now()
-		utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
+		mergeErrs := utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
 		PureMergeCost += time.Since(mergest)
+		if err := meter.Commit(txsToExec, gasUsed, errs, mergeErrs); err != nil {
+			return err
+		}
+		// the txs failing to merge merged nothing, they are executed again before the next round depends on them
+		retryTxs, retryErrs, retryGasUsed := utils.ExecBarrierRound(state, interactState.NewConcurrentTxState(fullcache),
+			utils.FailedRound(groups[round], mergeErrs), txs, header, fakeChainCtx)
+		if err := meter.Commit(retryTxs, retryGasUsed, retryErrs); err != nil {
+			return err
+		}
 	}
 	// Ignore merge to state as we use fullcache to represent statedb
 	// and another reason is that the Range of sync.Map is hard to use.
 	// utils.MergeToState(interactState.CacheStateList{fullcache}, state)
 
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
 	fmt.Println("PureExecution Time:", PureExecutionCost)
 	fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 	fmt.Println("PureMergeInTurn Time:", PureMergeCost)
-
 	return nil
 }
 
@@ -499,11 +721,15 @@ func ExecWithMISConcurrentCacheState(chainDB ethdb.Database, sdbBackend ethState
 	var antsWG sync.WaitGroup
 
 	st := time.Now()
-	groups := utils.GenerateMISGroups(txs, predictRwSets)
+	groups, err := utils.GenerateMISGroups(txs, predictRwSets)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Generate TxGroups:", time.Since(st))
-	fullcache := interactState.NewFullCacheConcurrent()
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
 	// here we don't pre warm the data
-	fullcache.Prefetch(state, predictRwSets)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets)
+	meter := utils.NewBlockGasMeter(txs, header)
 	st = time.Now()
 	PureExecutionCost := time.Duration(0)
 	PurePrefetchCost := time.Duration(0) // without considering the very first fullcache prefetch
@@ -517,24 +743,41 @@ func ExecWithMISConcurrentCacheState(chainDB ethdb.Database, sdbBackend ethState
 		txsToExec, cacheStates := utils.GenerateTxsAndCacheStatesWithAnts(antsPool, fullcache, groups[round], txs, predictRwSets, &antsWG)
 		PurePrefetchCost += time.Since(prefst)
 
+		if err := meter.Admit(txsToExec); err != nil {
+			return err
+		}
 		execst := time.Now()
-		tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, header, fakeChainCtx, &antsWG)
+		errs, gasUsed := tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, header, fakeChainCtx, &antsWG)
 		PureExecutionCost += time.Since(execst)
 		// fmt.Println("exec time:", time.Since(execst))
 
 		mergest := time.Now()
-		utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
+		mergeErrs := utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
 		PureMergeCost += time.Since(mergest)
+		if err := meter.Commit(txsToExec, gasUsed, errs, mergeErrs); err != nil {
+			return err
+		}
+		// the txs failing to merge merged nothing, they are executed again before the next round depends on them
+		retryTxs, retryErrs, retryGasUsed := utils.ExecBarrierRound(state, interactState.NewConcurrentTxState(fullcache),
+			utils.FailedRound(groups[round], mergeErrs), txs, header, fakeChainCtx)
+		if err := meter.Commit(retryTxs, retryGasUsed, retryErrs); err != nil {
+			return err
+		}
 	}
 	// Ignore merge to state as we use fullcache to represent statedb
 	// and another reason is that the Range of sync.Map is hard to use.
 	// utils.MergeToState(interactState.CacheStateList{fullcache}, state)
 
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
 	fmt.Println("PureExecution Time:", PureExecutionCost)
 	fmt.Println("PurePrefetchInTurn Time:", PurePrefetchCost)
 	fmt.Println("PureMergeInTurn Time:", PureMergeCost)
-
 	return nil
 }
 
@@ -551,9 +794,8 @@ func ExecAriaThenConnectedComponentsWithOneBlock(chainDB ethdb.Database, sdbBack
 	if err != nil {
 		return err
 	}
-	fullcache := interactState.NewFullCacheConcurrent()
-	fullcache.Prefetch(state, trueRWlists)
-	fullcache.Prefetch(state, predictRwSets)
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, trueRWlists, predictRwSets)
 
 	// first we use Aria method to commit txs and get rw sets
 	PrefetchRwSetList := make([]accesslist.RWSetList, len(txs))
@@ -565,12 +807,16 @@ func ExecAriaThenConnectedComponentsWithOneBlock(chainDB ethdb.Database, sdbBack
 	// then we use connected components method to commit the rest txs
 	fmt.Println("Start Connected Components Execution")
 	st := time.Now()
-	txGroup, RwSetGroup := utils.GenerateTxAndRWSetGroups(restTx, restPredictRwSets)
+	txGroup, RwSetGroup, err := utils.GenerateTxAndRWSetGroups(restTx, restPredictRwSets)
+	if err != nil {
+		return err
+	}
 	cacheStates := utils.GenerateCacheStatesConcurrent(antsPool, fullcache, RwSetGroup, &antsWG)
 	tracer.ExecConflictedTxs(antsPool, txGroup, cacheStates, header, fakeChainCtx, &antsWG)
 	utils.MergeToCacheStateConcurrent(antsPool, cacheStates, fullcache, &antsWG)
 	fmt.Println("End Connected Components Execution")
 	fmt.Println("Cost:", time.Since(st))
+	utils.FinalizeBlock(interactState.NewConcurrentTxState(fullcache), block, fakeChainCtx)
 	return nil
 }
 
@@ -587,9 +833,8 @@ func ExecAriaThenDegreeZeroWithOneBlock(chainDB ethdb.Database, sdbBackend ethSt
 	if err != nil {
 		return err
 	}
-	fullcache := interactState.NewFullCacheConcurrent()
-	fullcache.Prefetch(state, trueRWlists)
-	fullcache.Prefetch(state, predictRwSets)
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, trueRWlists, predictRwSets)
 
 	// first we use Aria method to commit txs and get rw sets
 	PrefetchRwSetList := make([]accesslist.RWSetList, len(txs))
@@ -601,7 +846,10 @@ func ExecAriaThenDegreeZeroWithOneBlock(chainDB ethdb.Database, sdbBackend ethSt
 	// then we use Degree Zero method to commit the rest txs
 	fmt.Println("Start Degree Zero Execution")
 	st := time.Now()
-	groups := utils.GenerateDegreeZeroGroups(restTx, restPredictRwSets)
+	groups, err := utils.GenerateDegreeZeroGroups(restTx, restPredictRwSets)
+	if err != nil {
+		return err
+	}
 	for round := 0; round < len(groups); round++ {
 		txsToExec, cacheStates := utils.GenerateTxsAndCacheStatesWithAnts(antsPool, fullcache, groups[round], restTx, restPredictRwSets, &antsWG)
 		tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, header, fakeChainCtx, &antsWG)
@@ -609,6 +857,7 @@ func ExecAriaThenDegreeZeroWithOneBlock(chainDB ethdb.Database, sdbBackend ethSt
 	}
 	fmt.Println("End Degree Zero Execution")
 	fmt.Println("Cost:", time.Since(st))
+	utils.FinalizeBlock(interactState.NewConcurrentTxState(fullcache), block, fakeChainCtx)
 	return nil
 }
 
@@ -625,9 +874,8 @@ func ExecAriaThenMISWithOneBlock(chainDB ethdb.Database, sdbBackend ethState.Dat
 	if err != nil {
 		return err
 	}
-	fullcache := interactState.NewFullCacheConcurrent()
-	fullcache.Prefetch(state, trueRWlists)
-	fullcache.Prefetch(state, predictRwSets)
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, trueRWlists, predictRwSets)
 
 	// first we use Aria method to commit txs and get rw sets
 	PrefetchRwSetList := make([]accesslist.RWSetList, len(txs))
@@ -639,7 +887,10 @@ func ExecAriaThenMISWithOneBlock(chainDB ethdb.Database, sdbBackend ethState.Dat
 	// then we use MIS method to commit the rest txs
 	fmt.Println("Start MIS Execution")
 	st := time.Now()
-	groups := utils.GenerateMISGroups(restTx, restPredictRwSets)
+	groups, err := utils.GenerateMISGroups(restTx, restPredictRwSets)
+	if err != nil {
+		return err
+	}
 	for round := 0; round < len(groups); round++ {
 		txsToExec, cacheStates := utils.GenerateTxsAndCacheStatesWithAnts(antsPool, fullcache, groups[round], restTx, restPredictRwSets, &antsWG)
 		tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, header, fakeChainCtx, &antsWG)
@@ -647,6 +898,7 @@ func ExecAriaThenMISWithOneBlock(chainDB ethdb.Database, sdbBackend ethState.Dat
 	}
 	fmt.Println("End MIS Execution")
 	fmt.Println("Cost:", time.Since(st))
+	utils.FinalizeBlock(interactState.NewConcurrentTxState(fullcache), block, fakeChainCtx)
 	return nil
 }
 
@@ -666,26 +918,40 @@ func ExecWithDegreeZeroConcurrentFullstate(chainDB ethdb.Database, sdbBackend et
 	var antsWG sync.WaitGroup
 
 	st := time.Now()
-	groups := utils.GenerateDegreeZeroGroups(txs, predictRwSets)
+	groups, err := utils.GenerateDegreeZeroGroups(txs, predictRwSets)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Generate TxGroups:", time.Since(st))
-	fullcache := interactState.NewFullCacheConcurrent()
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
 	// here we don't pre warm the data
-	fullcache.Prefetch(state, predictRwSets)
-	fullcache.Prefetch(state, trueRWlists)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets, trueRWlists)
 
+	meter := utils.NewBlockGasMeter(txs, header)
 	st = time.Now()
 	PureExecutionCost := time.Duration(0)
 	for round := 0; round < len(groups); round++ {
 		txsToExec := utils.GenerateTxToExec(groups[round], txs)
 
+		if err := meter.Admit(txsToExec); err != nil {
+			return err
+		}
 		execst := time.Now()
-		tracer.ExecuteWithCCFullState(antsPool, txsToExec, fullcache, header, fakeChainCtx, &antsWG)
+		errs, gasUsed := tracer.ExecuteWithCCFullState(antsPool, txsToExec, fullcache, header, fakeChainCtx, &antsWG)
 		PureExecutionCost += time.Since(execst)
+		if err := meter.Commit(txsToExec, gasUsed, errs); err != nil {
+			return err
+		}
 	}
 
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
 	fmt.Println("PureExecution Time:", PureExecutionCost)
-
 	return nil
 }
 
@@ -705,41 +971,224 @@ func ExecWithMISConcurrentFullstate(chainDB ethdb.Database, sdbBackend ethState.
 	var antsWG sync.WaitGroup
 
 	st := time.Now()
-	groups := utils.GenerateMISGroups(txs, predictRwSets)
+	groups, err := utils.GenerateMISGroups(txs, predictRwSets)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Generate TxGroups:", time.Since(st))
-	fullcache := interactState.NewFullCacheConcurrent()
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
 	// here we don't pre warm the data
-	fullcache.Prefetch(state, predictRwSets)
-	fullcache.Prefetch(state, trueRWlists)
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets, trueRWlists)
 
+	meter := utils.NewBlockGasMeter(txs, header)
 	st = time.Now()
 	PureExecutionCost := time.Duration(0)
 	for round := 0; round < len(groups); round++ {
 		txsToExec := utils.GenerateTxToExec(groups[round], txs)
 
+		if err := meter.Admit(txsToExec); err != nil {
+			return err
+		}
 		execst := time.Now()
-		tracer.ExecuteWithCCFullState(antsPool, txsToExec, fullcache, header, fakeChainCtx, &antsWG)
+		errs, gasUsed := tracer.ExecuteWithCCFullState(antsPool, txsToExec, fullcache, header, fakeChainCtx, &antsWG)
 		PureExecutionCost += time.Since(execst)
+		if err := meter.Commit(txsToExec, gasUsed, errs); err != nil {
+			return err
+		}
+	}
+
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
+	fmt.Println("PureExecution Time:", PureExecutionCost)
+	return nil
+}
+
+func ExecWithCriticalPathConcurrentFullstate(chainDB ethdb.Database, sdbBackend ethState.Database, height uint64) error {
+	fmt.Println("Critical Path Solution Concurrent Fullstate")
+
+	txs, predictRwSets, header, fakeChainCtx := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, height)
+	trueRWlists, _ := testfunc.TrueRWSets(txs, chainDB, sdbBackend, height)
+
+	state, err := utils.GetState(chainDB, sdbBackend, height-1)
+	if err != nil {
+		return err
+	}
+
+	antsPool, _ := ants.NewPool(16, ants.WithPreAlloc(true))
+	defer antsPool.Release()
+
+	block, _ := utils.GetBlockAndHeader(chainDB, height)
+	st := time.Now()
+	schedule := utils.GenerateCriticalPathSchedule(txs, predictRwSets, utils.TxGasWeights(chainDB, block, fakeChainCtx.Config()))
+	fmt.Println("Generate Schedule:", time.Since(st))
+	fmt.Println("Critical Path Gas:", schedule.Bound, "Total Gas:", schedule.Total)
+	if schedule.Bound > 0 {
+		fmt.Println("Parallelism Bound:", float64(schedule.Total)/float64(schedule.Bound))
+	}
+	// here we don't pre warm the data
+	fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRwSets, trueRWlists)
+
+	meter := utils.NewBlockGasMeter(txs, header)
+	st = time.Now()
+	_, _, durations, err := utils.ExecWithCriticalPath(antsPool, schedule, txs, fullcache, header, fakeChainCtx, meter)
+	if err != nil {
+		return err
 	}
+	PureExecutionCost := time.Since(st)
 
+	barrier, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRwSets, fakeChainCtx, meter)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Execution Time:", time.Since(st))
+	fmt.Println("Barrier Txs:", barrier)
+	fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
 	fmt.Println("PureExecution Time:", PureExecutionCost)
+	fmt.Println("Critical Path Time:", schedule.TimeBound(durations))
+	return nil
+}
 
+// pipelineBlock is a block handed from a stage of ExecPipeline to the next
+type pipelineBlock struct {
+	num      uint64
+	block    *types.Block
+	header   *types.Header
+	txs      types.Transactions
+	predicts accesslist.RWSetList
+	trueRWs  accesslist.RWSetList // of the oracle mode only
+	schedule *utils.CriticalPathSchedule
+	staged   *interactState.FullCacheConcurrent
+}
+
+// ExecPipeline executes the blocks in [startNum, endNum] in a pipeline without barriers between the blocks:
+// block N+2 is predicted and scheduled, block N+1 is prefetched and block N is executed at the same time.
+// The blocks are executed on a rolling FullCacheConcurrent. A block is prefetched aside from the state of block[startNum-1]
+// and absorbed by the rolling state once the blocks ahead of it are executed, the rolling state keeps the newer values
+// of the keys they touched. The stale state is read directly, a warm cache invalidated by the executed blocks can't hold it.
+// The predicted rw sets are prefetched, the oracle mode prefetches the true rw sets too, like the other fullstate executors.
+// The root is checkpointed every interval blocks and after the last block
+func ExecPipeline(chainDB ethdb.Database, sdbBackend ethState.Database, startNum, endNum, interval uint64, oracle bool) error {
+	if oracle {
+		fmt.Println("Pipelined Execution, Prefetch: oracle")
+	} else {
+		fmt.Println("Pipelined Execution, Prefetch: predicted")
+	}
+	fakeChainCtx := core.NewFakeChainContext(chainDB)
+
+	base, err := utils.GetState(chainDB, sdbBackend, startNum-1)
+	if err != nil {
+		return err
+	}
+	// base is never written, the stages read it on their own copies
+	prefetchState, execState := base.Copy(), base.Copy()
+
+	antsPool, _ := ants.NewPool(16, ants.WithPreAlloc(true))
+	defer antsPool.Release()
+
+	predictMeter := utils.NewStageMeter("Predict")
+	prefetchMeter := utils.NewStageMeter("Prefetch")
+	execMeter := utils.NewStageMeter("Execute")
+	predicted := make(chan *pipelineBlock, 1)
+	prefetched := make(chan *pipelineBlock, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(predicted)
+		for num := startNum; num <= endNum; num++ {
+			st := time.Now()
+			txs, predicts, header, _ := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+			var trueRWs accesslist.RWSetList
+			if oracle {
+				trueRWs, _ = testfunc.TrueRWSets(txs, chainDB, sdbBackend, num)
+			}
+			block, _ := utils.GetBlockAndHeader(chainDB, num)
+			schedule := utils.GenerateCriticalPathSchedule(txs, predicts, utils.TxGasWeights(chainDB, block, fakeChainCtx.Config()))
+			predictMeter.Record(txs.Len(), time.Since(st))
+			select {
+			case predicted <- &pipelineBlock{num: num, block: block, header: header, txs: txs, predicts: predicts, trueRWs: trueRWs, schedule: schedule}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(prefetched)
+		for b := range predicted {
+			st := time.Now()
+			b.staged = interactState.NewFullCacheConcurrent()
+			b.staged.Prefetch(prefetchState, b.predicts)
+			if oracle {
+				b.staged.Prefetch(prefetchState, b.trueRWs)
+			}
+			b.staged.Prefetch(prefetchState, accesslist.RWSetList{
+				utils.PredictPrepareRWSet(prefetchState, b.block, fakeChainCtx),
+				utils.PredictFinalizeRWSet(prefetchState, b.block, fakeChainCtx),
+			})
+			prefetchMeter.Record(b.txs.Len(), time.Since(st))
+			select {
+			case prefetched <- b:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	rolling := interactState.NewFullCacheConcurrent()
+	start := time.Now()
+	for b := range prefetched {
+		st := time.Now()
+		rolling.Absorb(b.staged)
+		utils.PrepareBlock(interactState.NewConcurrentTxState(rolling), b.block, fakeChainCtx)
+		meter := utils.NewBlockGasMeter(b.txs, b.header)
+		if _, _, _, err := utils.ExecWithCriticalPath(antsPool, b.schedule, b.txs, rolling, b.header, fakeChainCtx, meter); err != nil {
+			return err
+		}
+		// the values missing in the rolling state are untouched by the blocks so far, execState still holds them
+		barrier, err := utils.FinishBlock(execState, interactState.NewConcurrentTxState(rolling), b.block, b.predicts, fakeChainCtx, meter)
+		if err != nil {
+			return err
+		}
+		execMeter.Record(b.txs.Len(), time.Since(st))
+		fmt.Println("Block:", b.num, "Barrier Txs:", barrier, "Gas Used:", meter.GasUsed(), "Header Gas Used:", b.header.GasUsed)
+
+		if b.num == endNum || (interval > 0 && (b.num-startNum+1)%interval == 0) {
+			checkpoint := base.Copy()
+			rolling.WriteTo(checkpoint)
+			root := checkpoint.IntermediateRoot(fakeChainCtx.Config().IsEIP158(b.header.Number))
+			fmt.Println("Checkpoint Block:", b.num, "Root:", root, "Header Root:", b.header.Root)
+		}
+	}
+	fmt.Println("Pipeline Time:", time.Since(start))
+	for _, m := range []*utils.StageMeter{predictMeter, prefetchMeter, execMeter} {
+		fmt.Println(m)
+	}
 	return nil
 }
 
 func main() {
-	Node, chainDB, sdbBackend := utils.GetEthDatabaseAndStateDatabase()
+	Node, chainDB, sdbBackend := getEthDatabaseAndStateDatabase()
 	defer Node.Close()
 
 	head := rawdb.ReadHeadBlockHash(chainDB)
 	num := *rawdb.ReadHeaderNumber(chainDB, head)
 
+	// value transfers: core.TransferStrict (serial semantics), core.TransferDelta or core.TransferDisabled
+	core.SetTransferMode(core.TransferStrict)
+
 	// just test one block
 	ExecSerial(chainDB, sdbBackend, num, num)
 	fmt.Println()
 	// ExecWithConnectedComponentsConcurrentCacheState(chainDB, sdbBackend, num)
 	// fmt.Println()
+	// ExecWithPackedComponentsConcurrentCacheState(chainDB, sdbBackend, num)
+	// fmt.Println()
 	// ExecWithDegreeZeroConcurrentCacheState(chainDB, sdbBackend, num)
 	// fmt.Println()
 	// ExecWithMISConcurrentCacheState(chainDB, sdbBackend, num)
@@ -753,4 +1202,30 @@ func main() {
 	// ExecWithDegreeZeroConcurrentCacheStateWithoutPrefetchAndMerge(chainDB, sdbBackend, num)
 	// fmt.Println()
 	// ExecWithMISConcurrentFullstate(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// ExecWithCriticalPathConcurrentFullstate(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// ExecPipeline(chainDB, sdbBackend, num-9, num, 5, false)
+	// fmt.Println()
+	// testfunc.StalePredictionReport(chainDB, sdbBackend, num, 8)
+	// fmt.Println()
+	// testfunc.CompareStaticAndTrue(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// testfunc.CompareScheduleWithSerial(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// testfunc.CompareSchedulers(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// testfunc.CompareMISWithOptimum(chainDB, sdbBackend, num, time.Second)
+	// fmt.Println()
+	// testfunc.BenchmarkConflictGraphs(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// testfunc.StreamBlockIntoGraph(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// testfunc.CompareBlockBuilders(chainDB, sdbBackend, num, 16)
+	// fmt.Println()
+	// testfunc.CompareSpeculativeImport(chainDB, sdbBackend, num)
+	// fmt.Println()
+	// testfunc.CompareWarmPrefetch(chainDB, sdbBackend, num-9, num, warmCacheSize)
+	// fmt.Println()
+	// testfunc.CompareHotLanes(chainDB, sdbBackend, num-9, num, 4, 0.05)
 }
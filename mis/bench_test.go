@@ -0,0 +1,75 @@
+package mis
+
+import (
+	conflictgraph "interact/conflictGraph"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// newSyntheticGraphs are synthetic conflict graphs, not recorded ones, of 400 txs each touching 2 of 200 keys
+// drawn from a Zipf distribution, so that a few keys are hot like the token contracts and the routers.
+// testfunc.BenchmarkConflictGraphs runs the same algorithms on the conflict graphs of a recorded block
+func newSyntheticGraphs() (*conflictgraph.UndirectedGraph, *conflictgraph.DirectedGraph) {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.2, 1, 199)
+	const n = 400
+	keys := make([][2]uint64, n)
+	undi, di := conflictgraph.NewUndirectedGraph(), conflictgraph.NewDirectedGraph()
+	for i := 0; i < n; i++ {
+		keys[i] = [2]uint64{zipf.Uint64(), zipf.Uint64()}
+		undi.AddVertex(common.Hash{}, uint(i))
+		di.AddVertex(common.Hash{}, uint(i))
+		for j := 0; j < i; j++ {
+			if keys[i][0] == keys[j][0] || keys[i][0] == keys[j][1] || keys[i][1] == keys[j][0] || keys[i][1] == keys[j][1] {
+				undi.AddEdge(uint(j), uint(i))
+				di.AddEdge(uint(j), uint(i))
+			}
+		}
+	}
+	return undi, di
+}
+
+func BenchmarkSyntheticNewCSR(b *testing.B) {
+	undi, _ := newSyntheticGraphs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conflictgraph.NewCSR(undi)
+	}
+}
+
+func BenchmarkSyntheticConnectedComponents(b *testing.B) {
+	undi, _ := newSyntheticGraphs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		undi.GetConnectedComponents()
+	}
+}
+
+func BenchmarkSyntheticDegreeZero(b *testing.B) {
+	_, di := newSyntheticGraphs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		di.GetDegreeZero()
+	}
+}
+
+func BenchmarkSyntheticLinearTime(b *testing.B) {
+	undi, _ := newSyntheticGraphs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		solution := NewSolution(undi)
+		solution.Solve()
+	}
+}
+
+func BenchmarkSyntheticExact(b *testing.B) {
+	undi, _ := newSyntheticGraphs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		solution := NewExactSolution(undi, time.Second)
+		solution.Solve()
+	}
+}
@@ -0,0 +1,277 @@
+package mis
+
+import (
+	conflictgraph "interact/conflictGraph"
+	"time"
+)
+
+// Exact is a branch and bound solver of the maximum (weight) independent set,
+// meant for conflict graphs up to a few hundred vertices. Each connected component is searched on its own,
+// with a greedy solution as the first incumbent and a clique cover as the upper bound,
+// and so is each component the remaining candidates fall apart into while branching.
+// If the time budget runs out, IndependentSet is the best set found so far and Optimal is false
+type Exact struct {
+	Graph   *conflictgraph.UndirectedGraph
+	Weights map[uint]uint64 // nil means every vertex weighs 1
+	Budget  time.Duration   // 0 means no limit
+
+	IndependentSet *OrderedSet
+	Weight         uint64
+	Optimal        bool
+}
+
+func NewExactSolution(graph *conflictgraph.UndirectedGraph, budget time.Duration) *Exact {
+	return &Exact{
+		Graph:          graph,
+		Budget:         budget,
+		IndependentSet: NewOrderedSet(),
+	}
+}
+
+// NewWeightedSolution solves the maximum weight independent set, e.g. with the gas of the txs as weights
+func NewWeightedSolution(graph *conflictgraph.UndirectedGraph, weights map[uint]uint64, budget time.Duration) *Exact {
+	return &Exact{
+		Graph:          graph,
+		Weights:        weights,
+		Budget:         budget,
+		IndependentSet: NewOrderedSet(),
+	}
+}
+
+func (s *Exact) weight(id uint) uint64 {
+	if s.Weights == nil {
+		return 1
+	}
+	return s.Weights[id]
+}
+
+func (s *Exact) Solve() {
+	var deadline time.Time
+	if s.Budget > 0 {
+		deadline = time.Now().Add(s.Budget)
+	}
+	s.Optimal = true
+	csr := conflictgraph.NewCSR(s.Graph)
+	position := make([]int, csr.Len())
+	for _, component := range csr.Components() {
+		search := s.newSearch(csr, component, position, deadline)
+		search.run()
+		for k, i := range component {
+			if search.bestSet.Has(k) {
+				s.IndependentSet.Add(csr.Ids[i])
+				s.Weight += search.w[k]
+			}
+		}
+		if search.timeout {
+			s.Optimal = false
+		}
+	}
+}
+
+// newSearch renumbers a component of csr from 0, position is scratch space of csr.Len()
+func (s *Exact) newSearch(csr *conflictgraph.CSR, component []int, position []int, deadline time.Time) *exactSearch {
+	n := len(component)
+	for k, i := range component {
+		position[i] = k
+	}
+	search := &exactSearch{
+		adj:      make([]conflictgraph.Bitset, n),
+		w:        make([]uint64, n),
+		deadline: deadline,
+	}
+	for k, i := range component {
+		search.w[k] = s.weight(csr.Ids[i])
+		search.adj[k] = conflictgraph.NewBitset(n)
+		for _, j := range csr.Neighbors(i) {
+			search.adj[k].Set(position[j])
+		}
+	}
+	return search
+}
+
+type exactSearch struct {
+	adj      []conflictgraph.Bitset
+	w        []uint64
+	bestSet  conflictgraph.Bitset
+	deadline time.Time
+	nodes    int
+	timeout  bool
+}
+
+func (e *exactSearch) run() {
+	all := conflictgraph.NewBitset(len(e.w))
+	for i := range e.w {
+		all.Set(i)
+	}
+	weight, set := e.greedy(all)
+	e.bestSet = set
+	if _, set, ok := e.solve(all, int64(weight)); ok {
+		e.bestSet = set
+	}
+}
+
+// greedy takes the vertex with the best weight per closed neighbourhood first
+func (e *exactSearch) greedy(cand conflictgraph.Bitset) (uint64, conflictgraph.Bitset) {
+	cand = cand.Clone()
+	set := conflictgraph.NewBitset(len(e.w))
+	weight := uint64(0)
+	for !cand.Empty() {
+		best, bestScore := -1, 0.0
+		cand.ForEach(func(i int) {
+			score := float64(e.w[i]) / float64(e.adj[i].AndCount(cand)+1)
+			if best == -1 || score > bestScore {
+				best, bestScore = i, score
+			}
+		})
+		set.Set(best)
+		weight += e.w[best]
+		cand.AndNot(e.adj[best])
+		cand.Clear(best)
+	}
+	return weight, set
+}
+
+func (e *exactSearch) expired() bool {
+	if e.timeout {
+		return true
+	}
+	e.nodes++
+	if e.nodes%1024 == 0 && !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		e.timeout = true
+	}
+	return e.timeout
+}
+
+// solve returns a maximum weight independent set of cand if it weighs more than lb, ok is false otherwise
+func (e *exactSearch) solve(cand conflictgraph.Bitset, lb int64) (uint64, conflictgraph.Bitset, bool) {
+	if e.expired() {
+		return 0, nil, false
+	}
+	cand = cand.Clone()
+	forced := conflictgraph.NewBitset(len(e.w))
+	forcedWeight := uint64(0)
+	take := func(i int) {
+		forced.Set(i)
+		forcedWeight += e.w[i]
+		cand.AndNot(e.adj[i])
+		cand.Clear(i)
+	}
+	// an isolated vertex is in some maximum set, and so is a pendant vertex not lighter than its neighbour
+	for reduced := true; reduced; {
+		reduced = false
+		cand.ForEach(func(i int) {
+			if !cand.Has(i) {
+				return
+			}
+			switch e.adj[i].AndCount(cand) {
+			case 0:
+				take(i)
+				reduced = true
+			case 1:
+				neighbors := e.adj[i].Clone()
+				neighbors.And(cand)
+				if e.w[i] >= e.w[neighbors.First()] {
+					take(i)
+					reduced = true
+				}
+			}
+		})
+	}
+	lb -= int64(forcedWeight)
+
+	components := e.split(cand)
+	bounds := make([]int64, len(components))
+	sumBound := int64(0)
+	for k, component := range components {
+		bounds[k] = int64(e.bound(component))
+		sumBound += bounds[k]
+	}
+	if sumBound <= lb {
+		return 0, nil, false
+	}
+	// the components are independent, each must beat lb less what the others can weigh at most
+	weight := uint64(0)
+	for k, component := range components {
+		w, set, ok := e.solveConnected(component, lb-(sumBound-bounds[k]))
+		if !ok {
+			return 0, nil, false
+		}
+		weight += w
+		forced.Or(set)
+	}
+	if int64(weight) <= lb {
+		return 0, nil, false
+	}
+	return weight + forcedWeight, forced, true
+}
+
+// solveConnected branches on the vertex of cand with the most neighbours in cand
+func (e *exactSearch) solveConnected(cand conflictgraph.Bitset, lb int64) (uint64, conflictgraph.Bitset, bool) {
+	v, degree := -1, -1
+	cand.ForEach(func(i int) {
+		if d := e.adj[i].AndCount(cand); d > degree {
+			v, degree = i, d
+		}
+	})
+	best := lb
+	var bestSet conflictgraph.Bitset
+	next := cand.Clone()
+	next.AndNot(e.adj[v])
+	next.Clear(v)
+	if w, set, ok := e.solve(next, best-int64(e.w[v])); ok {
+		set.Set(v)
+		best, bestSet = int64(w+e.w[v]), set
+	}
+	rest := cand.Clone()
+	rest.Clear(v)
+	if w, set, ok := e.solve(rest, best); ok {
+		best, bestSet = int64(w), set
+	}
+	return uint64(best), bestSet, bestSet != nil
+}
+
+// split returns the connected components of the subgraph induced by cand
+func (e *exactSearch) split(cand conflictgraph.Bitset) []conflictgraph.Bitset {
+	rest := cand.Clone()
+	components := make([]conflictgraph.Bitset, 0)
+	for !rest.Empty() {
+		component := conflictgraph.NewBitset(len(e.w))
+		frontier := conflictgraph.NewBitset(len(e.w))
+		frontier.Set(rest.First())
+		for !frontier.Empty() {
+			component.Or(frontier)
+			rest.AndNot(frontier)
+			next := conflictgraph.NewBitset(len(e.w))
+			frontier.ForEach(func(i int) {
+				next.Or(e.adj[i])
+			})
+			next.And(rest)
+			frontier = next
+		}
+		components = append(components, component)
+	}
+	return components
+}
+
+// bound covers the candidates with cliques greedily, an independent set takes at most one vertex of a clique
+func (e *exactSearch) bound(cand conflictgraph.Bitset) uint64 {
+	rest := cand.Clone()
+	total := uint64(0)
+	for !rest.Empty() {
+		v := rest.First()
+		rest.Clear(v)
+		heaviest := e.w[v]
+		common := e.adj[v].Clone()
+		common.And(rest)
+		for !common.Empty() {
+			u := common.First()
+			rest.Clear(u)
+			if e.w[u] > heaviest {
+				heaviest = e.w[u]
+			}
+			common.And(e.adj[u])
+		}
+		total += heaviest
+	}
+	return total
+}
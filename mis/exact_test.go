@@ -0,0 +1,153 @@
+package mis
+
+import (
+	conflictgraph "interact/conflictGraph"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// bruteForce returns the maximum weight of an independent set of a graph with vertices 0..n-1
+func bruteForce(g *conflictgraph.UndirectedGraph, n int, weight func(uint) uint64) uint64 {
+	best := uint64(0)
+	for mask := 0; mask < 1<<n; mask++ {
+		total, independent := uint64(0), true
+		for u := 0; u < n && independent; u++ {
+			if mask&(1<<u) == 0 {
+				continue
+			}
+			total += weight(uint(u))
+			for _, v := range g.AdjacencyMap[uint(u)] {
+				if mask&(1<<v) != 0 {
+					independent = false
+					break
+				}
+			}
+		}
+		if independent && total > best {
+			best = total
+		}
+	}
+	return best
+}
+
+func checkIndependent(t *testing.T, g *conflictgraph.UndirectedGraph, set []uint) {
+	in := make(map[uint]bool, len(set))
+	for _, id := range set {
+		in[id] = true
+	}
+	for _, u := range set {
+		for _, v := range g.AdjacencyMap[u] {
+			if in[v] {
+				t.Fatalf("%d and %d are both in the set", u, v)
+			}
+		}
+	}
+}
+
+func TestExactMIS(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		n := 4 + r.Intn(13)
+		G := conflictgraph.NewUndirectedGraph()
+		weights := make(map[uint]uint64, n)
+		for i := 0; i < n; i++ {
+			G.AddVertex(common.Hash{}, uint(i))
+			weights[uint(i)] = uint64(21000 + r.Intn(1000000))
+		}
+		for i := 0; i < n*2; i++ {
+			u, v := uint(r.Intn(n)), uint(r.Intn(n))
+			if u != v {
+				G.AddEdge(u, v)
+			}
+		}
+
+		exact := NewExactSolution(G, 0)
+		exact.Solve()
+		set := exact.IndependentSet.ToSlice()
+		checkIndependent(t, G, set)
+		if want := bruteForce(G, n, func(uint) uint64 { return 1 }); !exact.Optimal || uint64(len(set)) != want || exact.Weight != want {
+			t.Fatalf("round %d: size %d, want %d", round, len(set), want)
+		}
+
+		heuristic := NewSolution(G)
+		heuristic.Solve()
+		if heuristic.IndependentSet.Cardinality() > len(set) {
+			t.Fatalf("round %d: heuristic %d beats the optimum %d", round, heuristic.IndependentSet.Cardinality(), len(set))
+		}
+
+		weighted := NewWeightedSolution(G, weights, 0)
+		weighted.Solve()
+		checkIndependent(t, G, weighted.IndependentSet.ToSlice())
+		if want := bruteForce(G, n, func(id uint) uint64 { return weights[id] }); !weighted.Optimal || weighted.Weight != want {
+			t.Fatalf("round %d: weight %d, want %d", round, weighted.Weight, want)
+		}
+	}
+}
+
+func TestExactMISDeleted(t *testing.T) {
+	G := NewGraph()
+	G.Vertices[3].IsDeleted = true
+	exact := NewExactSolution(G, 0)
+	exact.Solve()
+	for _, id := range exact.IndependentSet.ToSlice() {
+		if id == 3 {
+			t.Fatal("deleted vertex in the set")
+		}
+	}
+	// {0 or 1 or 2}, {4, 6}, {8 or 9} without 3
+	if exact.IndependentSet.Cardinality() != 4 {
+		t.Fatalf("size %d, want 4", exact.IndependentSet.Cardinality())
+	}
+}
+
+func TestExactMISBudget(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	G := conflictgraph.NewUndirectedGraph()
+	for i := 0; i < 300; i++ {
+		G.AddVertex(common.Hash{}, uint(i))
+	}
+	for i := 0; i < 3000; i++ {
+		u, v := uint(r.Intn(300)), uint(r.Intn(300))
+		if u != v {
+			G.AddEdge(u, v)
+		}
+	}
+	st := time.Now()
+	exact := NewExactSolution(G, 50*time.Millisecond)
+	exact.Solve()
+	if elapsed := time.Since(st); elapsed > time.Second {
+		t.Fatalf("took %v past a budget of 50ms", elapsed)
+	}
+	checkIndependent(t, G, exact.IndependentSet.ToSlice())
+	if exact.IndependentSet.Cardinality() == 0 {
+		t.Fatal("empty set")
+	}
+}
+
+// the solvers and the schedulers share one conflict graph, none of them may change it
+func TestSolversLeaveGraphUnchanged(t *testing.T) {
+	G := NewRandomGraph()
+	G.Vertices[7].IsDeleted = true
+	want := G.Clone()
+
+	NewSolution(G).Solve()
+	NewExactSolution(G, time.Second).Solve()
+	NewWeightedSolution(G, map[uint]uint64{1: 5, 2: 3}, time.Second).Solve()
+	G.GetConnectedComponents()
+	conflictgraph.NewCSR(G).Components()
+	if !reflect.DeepEqual(G, want) {
+		t.Fatal("the undirected graph changed")
+	}
+
+	_, D := newSyntheticGraphs()
+	wantD := D.Clone()
+	first := D.GetDegreeZero()
+	D.CriticalPath(func(uint) uint64 { return 1 })
+	if !reflect.DeepEqual(D, wantD) || !reflect.DeepEqual(D.GetDegreeZero(), first) {
+		t.Fatal("the directed graph changed")
+	}
+}
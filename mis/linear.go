@@ -1,16 +1,11 @@
 package mis
 
 import (
-	"fmt"
 	conflictgraph "interact/conflictGraph"
-
-	set "github.com/deckarep/golang-set"
 )
 
-// 一个比较尴尬的事情是这个算法好像不一定是确定性的
-// 不确定性来自于我们Set存储的都是指针，而指针大小是不确定的
-// 且Set的底层是Map，可能造成不一致的Pop；
-// 实际上，我们可以通过修改数据结构以及存储的数据来保证一致性
+// 算法是确定性的：工作集按CSR的稠密下标即TxId有序弹出，邻接表是CSR按下标排好序的行，度数相同时取TxId最小者，
+// 相同的输入总是得到相同的IndependentSet
 const MAX_UINT = uint(2147483647)
 
 type VertexStack []uint
@@ -31,42 +26,49 @@ func (s *VertexStack) Pop() uint {
 }
 
 type LinearTime struct {
-	Graph *conflictgraph.UndirectedGraph
+	Graph *conflictgraph.CSR
 
-	VerticesOne, VerticesTwo, VerticesGreaterThanThree, IndependentSet set.Set // 存txID
+	// the worklists and Stack hold the dense indices of Graph, IndependentSet the TxIds once Solve returns
+	VerticesOne, VerticesTwo, VerticesGreaterThanThree, IndependentSet *OrderedSet
 
 	Stack VertexStack
+
+	degree  []uint
+	deleted conflictgraph.Bitset
+	folded  map[uint][]int // the edges the degree two path reduction adds to the snapshot
+	set     *OrderedSet    // the independent set in dense indices
 }
 
+// NewSolution solves on a CSR snapshot of the vertices of graph not deleted, graph is left unchanged
 func NewSolution(graph *conflictgraph.UndirectedGraph) *LinearTime {
-	VerticesOne := set.NewSet()
-	VerticesTwo := set.NewSet()
-	VerticesGreaterThanThree := set.NewSet()
-	IndependentSet := set.NewSet()
-	Stack := make([]uint, 0)
-
-	for _, v := range graph.Vertices {
-		switch v.Degree {
+	csr := conflictgraph.NewCSR(graph)
+	s := &LinearTime{
+		Graph:                    csr,
+		VerticesOne:              NewOrderedSet(),
+		VerticesTwo:              NewOrderedSet(),
+		VerticesGreaterThanThree: NewOrderedSet(),
+		IndependentSet:           NewOrderedSet(),
+		Stack:                    make([]uint, 0),
+		degree:                   make([]uint, csr.Len()),
+		deleted:                  conflictgraph.NewBitset(csr.Len()),
+		folded:                   make(map[uint][]int),
+		set:                      NewOrderedSet(),
+	}
+	for i := 0; i < csr.Len(); i++ {
+		s.degree[i] = uint(csr.Degree(i))
+		switch s.degree[i] {
 		case 0:
-			IndependentSet.Add(v.TxId)
-			v.IsDeleted = true
+			s.set.Add(uint(i))
+			s.deleted.Set(i)
 		case 1:
-			VerticesOne.Add(v.TxId)
+			s.VerticesOne.Add(uint(i))
 		case 2:
-			VerticesTwo.Add(v.TxId)
+			s.VerticesTwo.Add(uint(i))
 		default:
-			VerticesGreaterThanThree.Add(v.TxId)
+			s.VerticesGreaterThanThree.Add(uint(i))
 		}
 	}
-
-	return &LinearTime{
-		Graph:                    graph,
-		VerticesOne:              VerticesOne,
-		VerticesTwo:              VerticesTwo,
-		VerticesGreaterThanThree: VerticesGreaterThanThree,
-		IndependentSet:           IndependentSet,
-		Stack:                    Stack,
-	}
+	return s
 }
 
 func (s *LinearTime) Solve() {
@@ -81,25 +83,69 @@ func (s *LinearTime) Solve() {
 	}
 	for id := s.Stack.Pop(); id != MAX_UINT; id = s.Stack.Pop() {
 		canAdd := true
-		for _, neighborId := range s.Graph.AdjacencyMap[id] {
-			neighbor := s.Graph.Vertices[neighborId]
-			if !neighbor.IsDeleted && !s.IndependentSet.Contains(neighborId) {
-				continue
-			} else {
+		for _, neighbor := range s.neighbors(id) {
+			if s.deleted.Has(neighbor) || s.set.Contains(uint(neighbor)) {
 				canAdd = false
 				break
 			}
 		}
 		if canAdd {
-			s.IndependentSet.Add(id)
+			s.set.Add(id)
+		}
+	}
+	for _, id := range s.set.ToSlice() {
+		s.IndependentSet.Add(s.Graph.Ids[id])
+	}
+}
+
+// neighbors returns the neighbours of id in the snapshot followed by those the reductions added, deleted or not
+func (s *LinearTime) neighbors(id uint) []int {
+	row := s.Graph.Neighbors(int(id))
+	added, ok := s.folded[id]
+	if !ok {
+		return row
+	}
+	return append(append(make([]int, 0, len(row)+len(added)), row...), added...)
+}
+
+func (s *LinearTime) hasEdge(u, v uint) bool {
+	if u == MAX_UINT || v == MAX_UINT || s.deleted.Has(int(u)) || s.deleted.Has(int(v)) {
+		return false
+	}
+	if s.Graph.HasEdge(int(u), int(v)) {
+		return true
+	}
+	for _, neighbor := range s.folded[u] {
+		if uint(neighbor) == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *LinearTime) addEdge(u, v uint) {
+	if u == MAX_UINT || v == MAX_UINT || s.hasEdge(u, v) {
+		return
+	}
+	s.folded[u] = append(s.folded[u], int(v))
+	s.folded[v] = append(s.folded[v], int(u))
+	s.degree[u]++
+	s.degree[v]++
+}
+
+// removeVertex takes a vertex of a folded path out of the graph, the worklists of its neighbours are left as they are
+func (s *LinearTime) removeVertex(id uint) {
+	s.deleted.Set(int(id))
+	for _, neighbor := range s.neighbors(id) {
+		if !s.deleted.Has(neighbor) {
+			s.degree[neighbor]--
 		}
 	}
 }
 
 func (s *LinearTime) deleteVertex(id uint) {
-	v := s.Graph.Vertices[id]
-	v.IsDeleted = true
-	switch v.Degree {
+	s.deleted.Set(int(id))
+	switch s.degree[id] {
 	case 1:
 		s.VerticesOne.Remove(id)
 	case 2:
@@ -107,34 +153,63 @@ func (s *LinearTime) deleteVertex(id uint) {
 	default:
 		s.VerticesGreaterThanThree.Remove(id)
 	}
-	if v.Degree == 0 {
+	if s.degree[id] == 0 {
 		return
 	}
-	for _, neighborId := range s.Graph.AdjacencyMap[id] {
-		neighbor := s.Graph.Vertices[neighborId]
-		if !neighbor.IsDeleted {
-			neighbor.Degree--
-			switch neighbor.Degree {
-			case 0:
-				s.IndependentSet.Add(neighborId)
-				s.VerticesOne.Remove(neighborId)
-			case 1:
-				s.VerticesOne.Add(neighborId)
-				s.VerticesTwo.Remove(neighborId)
-			case 2:
-				s.VerticesTwo.Add(neighborId)
-				s.VerticesGreaterThanThree.Remove(neighborId)
-			}
+	for _, neighbor := range s.neighbors(id) {
+		if s.deleted.Has(neighbor) {
+			continue
+		}
+		neighborId := uint(neighbor)
+		s.degree[neighborId]--
+		switch s.degree[neighborId] {
+		case 0:
+			s.set.Add(neighborId)
+			s.VerticesOne.Remove(neighborId)
+		case 1:
+			s.VerticesOne.Add(neighborId)
+			s.VerticesTwo.Remove(neighborId)
+		case 2:
+			s.VerticesTwo.Add(neighborId)
+			s.VerticesGreaterThanThree.Remove(neighborId)
 		}
 	}
 }
 
+// reclassify moves a vertex to the worklist of its degree, when the degree changed outside deleteVertex,
+// i.e. by the removeVertex and addEdge of the degree two path reduction
+func (s *LinearTime) reclassify(id uint) {
+	if id == MAX_UINT {
+		return
+	}
+	s.VerticesOne.Remove(id)
+	s.VerticesTwo.Remove(id)
+	s.VerticesGreaterThanThree.Remove(id)
+	if s.deleted.Has(int(id)) {
+		return
+	}
+	switch s.degree[id] {
+	case 0:
+		s.set.Add(id)
+		s.deleted.Set(int(id))
+	case 1:
+		s.VerticesOne.Add(id)
+	case 2:
+		s.VerticesTwo.Add(id)
+	default:
+		s.VerticesGreaterThanThree.Add(id)
+	}
+}
+
 func (s *LinearTime) degreeOneReduction() {
-	txId := s.VerticesOne.Pop().(uint)
-	for _, neighborId := range s.Graph.AdjacencyMap[txId] {
-		neighbor := s.Graph.Vertices[neighborId]
-		if !neighbor.IsDeleted {
-			s.deleteVertex(neighborId)
+	id := s.VerticesOne.Pop()
+	if s.deleted.Has(int(id)) || s.degree[id] != 1 {
+		s.reclassify(id)
+		return
+	}
+	for _, neighbor := range s.neighbors(id) {
+		if !s.deleted.Has(neighbor) {
+			s.deleteVertex(uint(neighbor))
 		}
 	}
 }
@@ -143,11 +218,16 @@ func (s *LinearTime) inexactReduction() {
 	var maxDegree = uint(0)
 	var maxDegreeId = MAX_UINT
 
-	for _, txId := range s.VerticesGreaterThanThree.ToSlice() {
-		vertex := s.Graph.Vertices[txId.(uint)]
-		if vertex.Degree > maxDegree {
-			maxDegree = vertex.Degree
-			maxDegreeId = txId.(uint)
+	// ToSlice is in index order, i.e. TxId order, so the least TxId wins on ties
+	for _, id := range s.VerticesGreaterThanThree.ToSlice() {
+		if s.deleted.Has(int(id)) || s.degree[id] < 3 {
+			// otherwise the reduction makes no progress and Solve never ends
+			s.reclassify(id)
+			continue
+		}
+		if s.degree[id] > maxDegree {
+			maxDegree = s.degree[id]
+			maxDegreeId = id
 		}
 	}
 
@@ -157,7 +237,11 @@ func (s *LinearTime) inexactReduction() {
 }
 
 func (s *LinearTime) degreeTwoPathReduction() {
-	uId := s.VerticesTwo.Pop().(uint)
+	uId := s.VerticesTwo.Pop()
+	if s.deleted.Has(int(uId)) || s.degree[uId] != 2 {
+		s.reclassify(uId)
+		return
+	}
 	path, isCycle := s.findLongestDegreeTwoPath(uId)
 
 	if isCycle {
@@ -166,31 +250,28 @@ func (s *LinearTime) degreeTwoPathReduction() {
 		path = s.pathReOrg(path)
 		var v, w uint = MAX_UINT, MAX_UINT
 		if len(path) == 1 {
-			for _, neighborId := range s.Graph.AdjacencyMap[path[0].TxId] {
-				neighbor := s.Graph.Vertices[neighborId]
-				if !neighbor.IsDeleted && neighbor.Degree != 2 {
+			for _, neighbor := range s.neighbors(path[0]) {
+				if !s.deleted.Has(neighbor) && s.degree[neighbor] != 2 {
 					if v == MAX_UINT {
-						v = neighbor.TxId
+						v = uint(neighbor)
 					} else if w == MAX_UINT {
-						w = neighbor.TxId
+						w = uint(neighbor)
 					} else {
 						break
 					}
 				}
 			}
 		} else {
-			for _, neighborId := range s.Graph.AdjacencyMap[path[0].TxId] {
-				neighbor := s.Graph.Vertices[neighborId]
-				if !neighbor.IsDeleted && neighbor.Degree != 2 {
-					v = neighbor.TxId
+			for _, neighbor := range s.neighbors(path[0]) {
+				if !s.deleted.Has(neighbor) && s.degree[neighbor] != 2 {
+					v = uint(neighbor)
 					break
 				}
 			}
 
-			for _, neighborId := range s.Graph.AdjacencyMap[path[len(path)-1].TxId] {
-				neighbor := s.Graph.Vertices[neighborId]
-				if !neighbor.IsDeleted && neighbor.Degree != 2 {
-					w = neighbor.TxId
+			for _, neighbor := range s.neighbors(path[len(path)-1]) {
+				if !s.deleted.Has(neighbor) && s.degree[neighbor] != 2 {
+					w = uint(neighbor)
 					break
 				}
 			}
@@ -199,50 +280,47 @@ func (s *LinearTime) degreeTwoPathReduction() {
 		if v == w {
 			s.deleteVertex(v)
 		} else if len(path)%2 == 1 {
-			if s.Graph.HasEdge(v, w) {
+			if s.hasEdge(v, w) {
 				s.deleteVertex(v)
 				s.deleteVertex(w)
 			} else {
 				for i := 1; i < len(path); i++ {
-					s.Graph.RemoveVertex(path[i].TxId)
-					s.VerticesTwo.Remove(path[i].TxId)
+					s.removeVertex(path[i])
+					s.VerticesTwo.Remove(path[i])
 				}
-				s.Graph.AddEdge(path[0].TxId, w)
+				s.addEdge(path[0], w)
 				for i := len(path) - 1; i > 0; i-- {
-					s.Stack.Push(path[i].TxId)
+					s.Stack.Push(path[i])
 				}
 			}
 		} else {
-			for _, vertex := range path {
-				s.Graph.RemoveVertex(vertex.TxId)
-				s.VerticesTwo.Remove(vertex.TxId)
+			for _, id := range path {
+				s.removeVertex(id)
+				s.VerticesTwo.Remove(id)
 			}
-			fmt.Println("v:", v)
-			fmt.Println("w:", w)
-			if v == 73 && w == MAX_UINT {
-				fmt.Println("Bingo")
-			}
-			if !s.Graph.HasEdge(v, w) {
-				s.Graph.AddEdge(v, w)
+			if v != MAX_UINT && w != MAX_UINT && !s.hasEdge(v, w) {
+				s.addEdge(v, w)
+			} else {
+				// v and w each lost a neighbour in the path
+				s.reclassify(v)
+				s.reclassify(w)
 			}
 			for i := len(path) - 1; i >= 0; i-- {
-				s.Stack.Push(path[i].TxId)
+				s.Stack.Push(path[i])
 			}
 		}
 	}
 }
 
-func (s *LinearTime) findLongestDegreeTwoPath(vId uint) ([]*conflictgraph.Vertex, bool) {
-	visited := make(map[*conflictgraph.Vertex]bool)
-	longestPath := make([]*conflictgraph.Vertex, 0)
+func (s *LinearTime) findLongestDegreeTwoPath(id uint) ([]uint, bool) {
+	visited := conflictgraph.NewBitset(s.Graph.Len())
+	longestPath := make([]uint, 0)
 	isCycle := true
 
-	s.dfsToFindDegreeTwoPath(vId, visited, &longestPath)
-	for _, vertex := range longestPath {
-		vId := vertex.TxId
-		for _, neighborId := range s.Graph.AdjacencyMap[vId] {
-			neighbor := s.Graph.Vertices[neighborId]
-			if !visited[neighbor] && !neighbor.IsDeleted {
+	s.dfsToFindDegreeTwoPath(id, visited, &longestPath)
+	for _, vId := range longestPath {
+		for _, neighbor := range s.neighbors(vId) {
+			if !visited.Has(neighbor) && !s.deleted.Has(neighbor) {
 				isCycle = false
 				break
 			}
@@ -255,50 +333,44 @@ func (s *LinearTime) findLongestDegreeTwoPath(vId uint) ([]*conflictgraph.Vertex
 	return longestPath, isCycle
 }
 
-func (s *LinearTime) dfsToFindDegreeTwoPath(vId uint, visited map[*conflictgraph.Vertex]bool, path *[]*conflictgraph.Vertex) {
-	vertex := s.Graph.Vertices[vId]
-	visited[vertex] = true
-	*path = append(*path, vertex)
+func (s *LinearTime) dfsToFindDegreeTwoPath(id uint, visited conflictgraph.Bitset, path *[]uint) {
+	visited.Set(int(id))
+	*path = append(*path, id)
 
-	for _, neighborId := range s.Graph.AdjacencyMap[vId] {
-		neighbor := s.Graph.Vertices[neighborId]
-		if !visited[neighbor] && neighbor.Degree == 2 && !neighbor.IsDeleted {
-			s.dfsToFindDegreeTwoPath(neighborId, visited, path)
+	for _, neighbor := range s.neighbors(id) {
+		if !visited.Has(neighbor) && s.degree[neighbor] == 2 && !s.deleted.Has(neighbor) {
+			s.dfsToFindDegreeTwoPath(uint(neighbor), visited, path)
 		}
 	}
 }
 
-func (s *LinearTime) pathReOrg(initPath []*conflictgraph.Vertex) []*conflictgraph.Vertex {
-	inPath := make(map[*conflictgraph.Vertex]bool)
-	visited := make(map[*conflictgraph.Vertex]bool)
-	var st *conflictgraph.Vertex = nil
-	for _, v := range initPath {
-		inPath[v] = true
-		if st == nil {
-			vId := v.TxId
-			for _, neighborId := range s.Graph.AdjacencyMap[vId] {
-				neighbor := s.Graph.Vertices[neighborId]
-				if neighbor.Degree != 2 && !neighbor.IsDeleted {
-					st = v
+func (s *LinearTime) pathReOrg(initPath []uint) []uint {
+	inPath := conflictgraph.NewBitset(s.Graph.Len())
+	visited := conflictgraph.NewBitset(s.Graph.Len())
+	var st = MAX_UINT
+	for _, id := range initPath {
+		inPath.Set(int(id))
+		if st == MAX_UINT {
+			for _, neighbor := range s.neighbors(id) {
+				if s.degree[neighbor] != 2 && !s.deleted.Has(neighbor) {
+					st = id
 					break
 				}
 			}
 		}
 	}
 
-	path := make([]*conflictgraph.Vertex, 0)
+	path := make([]uint, 0)
 	s.dfsToReOrgPath(st, visited, inPath, &path)
 	return path
 }
 
-func (s *LinearTime) dfsToReOrgPath(vertex *conflictgraph.Vertex, visited map[*conflictgraph.Vertex]bool, inPath map[*conflictgraph.Vertex]bool, path *[]*conflictgraph.Vertex) {
-	visited[vertex] = true
-	*path = append(*path, vertex)
-	vId := vertex.TxId
-	for _, neighborId := range s.Graph.AdjacencyMap[vId] {
-		neighbor := s.Graph.Vertices[neighborId]
-		if !visited[neighbor] && !neighbor.IsDeleted && inPath[neighbor] {
-			s.dfsToReOrgPath(neighbor, visited, inPath, path)
+func (s *LinearTime) dfsToReOrgPath(id uint, visited, inPath conflictgraph.Bitset, path *[]uint) {
+	visited.Set(int(id))
+	*path = append(*path, id)
+	for _, neighbor := range s.neighbors(id) {
+		if !visited.Has(neighbor) && !s.deleted.Has(neighbor) && inPath.Has(neighbor) {
+			s.dfsToReOrgPath(uint(neighbor), visited, inPath, path)
 		}
 	}
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	conflictgraph "interact/conflictGraph"
+	"math/rand"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -90,7 +92,7 @@ func TestSolveMIS(t *testing.T) {
 			fmt.Println("Edge Count:", edgeCount)
 		}
 		for _, v := range ansSlice {
-			graph.Vertices[v.(uint)].IsDeleted = true
+			graph.Vertices[v].IsDeleted = true
 		}
 		graph = graph.CopyGraphWithDeletion()
 		if len(graph.Vertices) == 0 {
@@ -98,3 +100,44 @@ func TestSolveMIS(t *testing.T) {
 		}
 	}
 }
+
+// NewRandomGraph is a fixed pseudo-random graph, mixing all the reductions
+func NewRandomGraph() *conflictgraph.UndirectedGraph {
+	r := rand.New(rand.NewSource(1))
+	G := conflictgraph.NewUndirectedGraph()
+	for i := 0; i < 200; i++ {
+		G.AddVertex(common.Hash{}, uint(i))
+	}
+	for i := 0; i < 400; i++ {
+		u, v := uint(r.Intn(200)), uint(r.Intn(200))
+		if u != v {
+			G.AddEdge(u, v)
+		}
+	}
+	return G
+}
+
+func TestSolveMISDeterministic(t *testing.T) {
+	for _, newGraph := range []func() *conflictgraph.UndirectedGraph{NewGraph, NewGraph2, NewRandomGraph} {
+		var want []uint
+		for run := 0; run < 20; run++ {
+			// the neighbours are listed in a different order on every run
+			graph := newGraph()
+			for _, neighbors := range graph.AdjacencyMap {
+				rand.Shuffle(len(neighbors), func(i, j int) {
+					neighbors[i], neighbors[j] = neighbors[j], neighbors[i]
+				})
+			}
+			solution := NewSolution(graph)
+			solution.Solve()
+			got := solution.IndependentSet.ToSlice()
+			if run == 0 {
+				want = got
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("run %d: independent set %v, want %v", run, got, want)
+			}
+		}
+	}
+}
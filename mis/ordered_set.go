@@ -0,0 +1,63 @@
+package mis
+
+import (
+	conflictgraph "interact/conflictGraph"
+)
+
+// OrderedSet is a set of TxIds popped in increasing order,
+// so that the reductions visit the vertices the same way on every run
+type OrderedSet struct {
+	members conflictgraph.Bitset // indexed by TxId
+	size    int
+}
+
+func NewOrderedSet() *OrderedSet {
+	return &OrderedSet{
+		members: conflictgraph.NewBitset(0),
+	}
+}
+
+func (s *OrderedSet) Add(id uint) {
+	if s.Contains(id) {
+		return
+	}
+	s.members = s.members.Grow(int(id))
+	s.members.Set(int(id))
+	s.size++
+}
+
+func (s *OrderedSet) Remove(id uint) {
+	if !s.Contains(id) {
+		return
+	}
+	s.members.Clear(int(id))
+	s.size--
+}
+
+func (s *OrderedSet) Contains(id uint) bool {
+	return s.members.Has(int(id))
+}
+
+func (s *OrderedSet) Cardinality() int {
+	return s.size
+}
+
+// Pop removes and returns the least id, MAX_UINT if the set is empty
+func (s *OrderedSet) Pop() uint {
+	first := s.members.First()
+	if first == -1 {
+		return MAX_UINT
+	}
+	s.members.Clear(first)
+	s.size--
+	return uint(first)
+}
+
+// ToSlice returns the ids in increasing order
+func (s *OrderedSet) ToSlice() []uint {
+	ids := make([]uint, 0, s.size)
+	s.members.ForEach(func(id int) {
+		ids = append(ids, uint(id))
+	})
+	return ids
+}
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"interact/accesslist"
 	"math/big"
@@ -28,6 +29,8 @@ import (
 // Or use a overrall KVS, but we need to support thread safe snapshot and revert,
 // and under this circumstance, we don't need to force commit phase and execution phase to happen in turn.
 
+var ErrInsufficientBalanceDelta = errors.New("insufficient balance for the balance delta")
+
 type revision struct {
 	id           int
 	journalIndex int
@@ -38,12 +41,16 @@ type CacheState struct {
 	Accounts map[common.Address]*accountObject `json:"accounts,omitempty"`
 
 	Logs           map[common.Hash][]*types.Log `json:"logs,omitempty"`
+	BalanceDeltas  map[common.Address]*big.Int  `json:"balance_deltas,omitempty"` // value transfers of core.TransferDelta
 	thash          common.Hash
 	txIndex        int
 	logSize        uint
 	StateJudge     bool
 	prefetching    bool
 	prefectched    accesslist.ALTuple
+	warm           *WarmCache // consulted by Prefetch before the state, nil means none
+	transient      transientStorage
+	refund         uint64   // of the current tx
 	Journal        *journal `json:"journal,omitempty"`
 	ValidRevisions []revision
 	NextRevisionId int
@@ -53,12 +60,14 @@ type CacheStateList []*CacheState
 
 func NewCacheState() *CacheState {
 	return &CacheState{
-		Accounts:    make(map[common.Address]*accountObject),
-		Journal:     newJournal(),
-		Logs:        make(map[common.Hash][]*types.Log),
-		StateJudge:  true,
-		prefetching: false,
-		prefectched: make(accesslist.ALTuple),
+		Accounts:      make(map[common.Address]*accountObject),
+		Journal:       newJournal(),
+		Logs:          make(map[common.Hash][]*types.Log),
+		BalanceDeltas: make(map[common.Address]*big.Int),
+		StateJudge:    true,
+		prefetching:   false,
+		prefectched:   make(accesslist.ALTuple),
+		transient:     newTransientStorage(),
 	}
 }
 
@@ -79,12 +88,16 @@ func (s *CacheState) setAccountObject(obj *accountObject) {
 
 // GetBalance 获取某个账户的余额
 func (s *CacheState) GetBalance(addr common.Address) *big.Int {
+	balance := new(big.Int)
 	stateObject := s.getAccountObject(addr)
 	if stateObject != nil {
-		return stateObject.GetBalance()
+		balance = stateObject.GetBalance()
 	}
 	// s.StateJudge = false
-	return new(big.Int).SetInt64(0)
+	if delta, ok := s.BalanceDeltas[addr]; ok {
+		return new(big.Int).Add(balance, delta)
+	}
+	return balance
 }
 
 // GetNonce 获取nonce
@@ -131,9 +144,9 @@ func (s *CacheState) GetCodeSize(addr common.Address) int {
 	return 0
 }
 
-// GetRefund ...
+// GetRefund returns the refund counter of the current tx
 func (s *CacheState) GetRefund() uint64 {
-	return 0
+	return s.refund
 }
 
 func (s *CacheState) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
@@ -157,7 +170,7 @@ func (s *CacheState) GetState(addr common.Address, key common.Hash) common.Hash
 
 // GetTransientState gets transient storage for a given account.
 func (s *CacheState) GetTransientState(addr common.Address, key common.Hash) common.Hash {
-	return s.GetState(addr, key)
+	return s.transient.Get(addr, key)
 }
 
 // Exist 检查账户是否存在
@@ -220,6 +233,16 @@ func (s *CacheState) SetBalance(addr common.Address, amount *big.Int) {
 	// s.StateJudge = false
 }
 
+// AddBalanceDelta keeps the value transfer aside, it is validated and applied by MergeState
+func (s *CacheState) AddBalanceDelta(addr common.Address, delta *big.Int) {
+	prev := s.BalanceDeltas[addr]
+	s.Journal.append(balanceDeltaChange{&addr, prev})
+	if prev == nil {
+		prev = new(big.Int)
+	}
+	s.BalanceDeltas[addr] = new(big.Int).Add(prev, delta)
+}
+
 func (s *CacheState) setBalancePrefetch(addr common.Address, amount *big.Int) {
 	stateObject := s.getAccountObject(addr)
 	if stateObject != nil {
@@ -277,12 +300,19 @@ func (s *CacheState) setCodeHashPrefetch(addr common.Address, codeHash common.Ha
 	}
 }
 
-// AddRefund
+// AddRefund adds gas to the refund counter
 func (s *CacheState) AddRefund(amount uint64) {
+	s.Journal.append(refundChange{prev: s.refund})
+	s.refund += amount
 }
 
-// SubRefund
+// SubRefund removes gas from the refund counter, it panics if the counter goes below zero
 func (s *CacheState) SubRefund(amount uint64) {
+	s.Journal.append(refundChange{prev: s.refund})
+	if amount > s.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", amount, s.refund))
+	}
+	s.refund -= amount
 }
 
 // SetState 设置变量的状态
@@ -317,7 +347,16 @@ func (s *CacheState) setStatePrefetch(addr common.Address, key common.Hash, valu
 // adds the change to the journal so that it can be rolled back
 // to its previous value if there is a revert.
 func (s *CacheState) SetTransientState(addr common.Address, key, value common.Hash) {
-	s.SetState(addr, key, value)
+	prev := s.transient.Get(addr, key)
+	if prev == value {
+		return
+	}
+	s.Journal.append(transientStorageChange{
+		account:  &addr,
+		key:      key,
+		prevalue: prev,
+	})
+	s.transient.Set(addr, key, value)
 }
 
 // Suicide
@@ -333,6 +372,11 @@ func (s *CacheState) SelfDestruct(addr common.Address) {
 	})
 	stateObject.IsAlive = false
 	stateObject.Data.Balance = new(big.Int)
+	// the pending delta is part of the balance sent to the beneficiary
+	if delta, ok := s.BalanceDeltas[addr]; ok {
+		s.Journal.append(balanceDeltaChange{&addr, delta})
+		delete(s.BalanceDeltas, addr)
+	}
 }
 
 // HasSuicided ...
@@ -405,7 +449,10 @@ func (s *CacheState) AddLog(log *types.Log) {
 func (s *CacheState) AddPreimage(hash common.Hash, preimage []byte) {
 }
 
+// Prepare resets the transient storage and the refund counter of the tx, the access list is always warm
 func (s *CacheState) Prepare(rules params.Rules, sender, coinbase common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	s.transient = newTransientStorage()
+	s.refund = 0
 }
 
 // AddressInAccessList returns true if the given address is in the access list.
@@ -428,10 +475,22 @@ func (s *CacheState) SetTxStateErr(thash common.Hash, ti int) {
 	s.StateJudge = false
 }
 
+// SetWarmCache makes Prefetch read through warm, which keeps the values read across blocks
+func (s *CacheState) SetWarmCache(warm *WarmCache) {
+	s.warm = warm
+}
+
 func (s *CacheState) Prefetch(statedb vm.StateDB, rwSets []*accesslist.RWSet) {
+	if s.warm != nil {
+		statedb = s.warm.Reader(statedb)
+	}
 	// 预取时置prefetching为true
 	s.prefetching = true
 	for _, rwSet := range rwSets {
+		if rwSet == nil {
+			// a tx without a prediction
+			continue
+		}
 		for addr, State := range rwSet.ReadSet {
 			for hash := range State {
 				s.prefetchSetter(addr, hash, statedb)
@@ -448,11 +507,20 @@ func (s *CacheState) Prefetch(statedb vm.StateDB, rwSets []*accesslist.RWSet) {
 	s.prefetching = false
 }
 
+// IsPrefetched reports whether the value of hash of addr is prefetched
+func (s *CacheState) IsPrefetched(addr common.Address, hash common.Hash) bool {
+	return s.prefectched.Contains(addr, hash)
+}
+
 func (s *CacheState) prefetchSetter(addr common.Address, hash common.Hash, statedb vm.StateDB) {
 	if s.prefectched.Contains(addr, hash) {
 		return
 	}
 	s.prefectched.Add(addr, hash)
+	// a delta is applied at commit time, nothing to prefetch
+	if hash == accesslist.BALANCEDELTA {
+		return
+	}
 
 	s.CreateAccount(addr)
 	switch hash {
@@ -471,15 +539,141 @@ func (s *CacheState) prefetchSetter(addr common.Address, hash common.Hash, state
 	}
 }
 
+// balanceDeltaApplier is a shared state applying the deltas of concurrent merges atomically
+type balanceDeltaApplier interface {
+	ApplyBalanceDelta(addr common.Address, delta *big.Int)
+	TryApplyBalanceDeltas(deltas map[common.Address]*big.Int) error
+}
+
+// checkBalanceDelta returns ErrInsufficientBalanceDelta if delta takes balance below zero
+func checkBalanceDelta(addr common.Address, balance, delta *big.Int) error {
+	if delta.Sign() < 0 && new(big.Int).Add(balance, delta).Sign() < 0 {
+		return fmt.Errorf("%w: address %v have %v delta %v", ErrInsufficientBalanceDelta, addr.Hex(), balance, delta)
+	}
+	return nil
+}
+
+// ValidateBalanceDeltas checks that no balance goes negative when the deltas are merged into statedb.
+// It is not atomic with the merge, on a state merged concurrently see commitBalanceDeltas
+func (s *CacheState) ValidateBalanceDeltas(statedb StateInterface) error {
+	for addr, delta := range s.BalanceDeltas {
+		balance := statedb.GetBalance(addr)
+		if s.holdsBalance(addr) {
+			balance = s.getAccountObject(addr).GetBalance()
+		}
+		if err := checkBalanceDelta(addr, balance, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdsBalance reports whether the balance of addr is merged from the cache, an account whose balance
+// only has deltas, e.g. the sender buying gas with core.TransferDelta, keeps the balance of the state
+func (s *CacheState) holdsBalance(addr common.Address) bool {
+	_, dirty := s.Journal.dirties[addr]
+	return dirty && s.prefectched.Contains(addr, accesslist.BALANCE)
+}
+
+// commitBalanceDeltas checks the deltas before anything is merged and returns those left to merge after the writes.
+// On a shared state, the deltas of the accounts the cache didn't write are checked and applied right away under one lock,
+// the deltas never conflict, so two caches merged concurrently may spend the same balance
+func (s *CacheState) commitBalanceDeltas(statedb StateInterface) (map[common.Address]*big.Int, error) {
+	applier, ok := statedb.(balanceDeltaApplier)
+	if !ok {
+		if err := s.ValidateBalanceDeltas(statedb); err != nil {
+			return nil, err
+		}
+		return s.BalanceDeltas, nil
+	}
+	left := make(map[common.Address]*big.Int)
+	shared := make(map[common.Address]*big.Int)
+	for addr, delta := range s.BalanceDeltas {
+		if !s.holdsBalance(addr) {
+			shared[addr] = delta
+			continue
+		}
+		// the balance merged is the one of the cache, the writes conflict with the other caches
+		if err := checkBalanceDelta(addr, s.getAccountObject(addr).GetBalance(), delta); err != nil {
+			return nil, err
+		}
+		left[addr] = delta
+	}
+	if err := applier.TryApplyBalanceDeltas(shared); err != nil {
+		return nil, err
+	}
+	return left, nil
+}
+
 // ! we can use write set to optimize the merge process
-func (s *CacheState) MergeState(statedb StateInterface) {
+// MergeState merges nothing if a balance delta is invalid
+func (s *CacheState) MergeState(statedb StateInterface) error {
+	deltas, err := s.commitBalanceDeltas(statedb)
+	if err != nil {
+		return err
+	}
 	for addr := range s.Journal.dirties {
 		aoj := s.getAccountObject(addr)
-		statedb.SetBalance(addr, aoj.GetBalance())
+		if s.holdsBalance(addr) {
+			statedb.SetBalance(addr, aoj.GetBalance())
+		}
 		statedb.SetNonce(addr, aoj.GetNonce())
 		statedb.SetCode(addr, aoj.Code())
 		for slot, value := range aoj.CacheStorage {
 			statedb.SetState(addr, slot, value)
 		}
 	}
+	mergeBalanceDeltas(statedb, deltas)
+	return nil
+}
+
+// MergeWriteSet merges only the values of the keys in writeSet, e.g. the write set of the rw set the txs were traced with.
+// Unlike MergeState it leaves the fields the txs never wrote alone, so a cache prefetched on an older state
+// can be merged after other txs changed those fields. It merges nothing if a balance delta is invalid
+func (s *CacheState) MergeWriteSet(statedb StateInterface, writeSet accesslist.ALTuple) error {
+	deltas, err := s.commitBalanceDeltas(statedb)
+	if err != nil {
+		return err
+	}
+	for addr, keys := range writeSet {
+		aoj := s.getAccountObject(addr)
+		if aoj == nil {
+			continue
+		}
+		for key := range keys {
+			switch key {
+			case accesslist.BALANCE:
+				statedb.SetBalance(addr, aoj.GetBalance())
+			case accesslist.NONCE:
+				statedb.SetNonce(addr, aoj.GetNonce())
+			case accesslist.CODE, accesslist.CODEHASH:
+				statedb.SetCode(addr, aoj.Code())
+			case accesslist.ALIVE:
+				if !aoj.IsAlive {
+					statedb.SelfDestruct(addr)
+				}
+			case accesslist.BALANCEDELTA:
+				// merged with the deltas below
+			default:
+				if value, ok := aoj.CacheStorage[key]; ok {
+					statedb.SetState(addr, key, value)
+				}
+			}
+		}
+	}
+	mergeBalanceDeltas(statedb, deltas)
+	return nil
+}
+
+func mergeBalanceDeltas(statedb StateInterface, deltas map[common.Address]*big.Int) {
+	for addr, delta := range deltas {
+		if applier, ok := statedb.(balanceDeltaApplier); ok {
+			applier.ApplyBalanceDelta(addr, delta)
+			continue
+		}
+		if !statedb.Exist(addr) {
+			statedb.CreateAccount(addr)
+		}
+		statedb.AddBalance(addr, delta)
+	}
 }
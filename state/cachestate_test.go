@@ -0,0 +1,80 @@
+package state
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"interact/accesslist"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// slowBalanceState widens the window between reading a balance and merging a delta, as a balance read from disk would
+type slowBalanceState struct {
+	*FullCacheConcurrent
+}
+
+func (s slowBalanceState) GetBalance(addr common.Address) *big.Int {
+	balance := s.FullCacheConcurrent.GetBalance(addr)
+	time.Sleep(time.Millisecond)
+	return balance
+}
+
+// TestConcurrentBalanceDeltaOverdraft merges caches debiting the same account concurrently,
+// the deltas don't conflict, so they may be in the same round, but only one of them can be paid
+func TestConcurrentBalanceDeltaOverdraft(t *testing.T) {
+	payer, payee := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	statedb, err := ethState.New(types.EmptyRootHash, ethState.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.AddBalance(payer, big.NewInt(10))
+	rwSet := accesslist.NewRWSet()
+	rwSet.AddReadSet(payer, accesslist.BALANCE)
+
+	for round := 0; round < 20; round++ {
+		fullcache := NewFullCacheConcurrent()
+		fullcache.Prefetch(statedb, accesslist.RWSetList{rwSet})
+		caches := make(CacheStateList, 8)
+		for i := range caches {
+			caches[i] = NewCacheState()
+			caches[i].AddBalanceDelta(payer, big.NewInt(-10))
+			caches[i].AddBalanceDelta(payee, big.NewInt(10))
+		}
+
+		errs := make([]error, len(caches))
+		var start, wg sync.WaitGroup
+		start.Add(1)
+		for i := range caches {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				start.Wait()
+				errs[i] = caches[i].MergeState(slowBalanceState{fullcache})
+			}(i)
+		}
+		start.Done()
+		wg.Wait()
+
+		merged := 0
+		for _, err := range errs {
+			if err == nil {
+				merged++
+			} else if !errors.Is(err, ErrInsufficientBalanceDelta) {
+				t.Fatal(err)
+			}
+		}
+		if merged != 1 {
+			t.Fatalf("%d overlapping debits merged, want 1", merged)
+		}
+		if fullcache.GetBalance(payer).Sign() != 0 || fullcache.GetBalance(payee).Cmp(big.NewInt(10)) != 0 {
+			t.Fatalf("balances %v and %v, want 0 and 10", fullcache.GetBalance(payer), fullcache.GetBalance(payee))
+		}
+	}
+}
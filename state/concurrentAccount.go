@@ -14,6 +14,7 @@ type accountObjectConcurrent struct {
 	Data         accountData    `json:"data,omitempty"`
 	CacheStorage sync.Map       `json:"cache_storage,omitempty"` // 用于缓存存储的变量
 	IsAlive      bool           `json:"is_alive,omitempty"`
+	balanceMu    sync.Mutex     // the balance of a shared account may be changed by several txs at once
 }
 
 func newAccountObjectConcurrent(address common.Address, data accountData) *accountObjectConcurrent {
@@ -32,6 +33,8 @@ func newAccountObjectConcurrent(address common.Address, data accountData) *accou
 }
 
 func (object *accountObjectConcurrent) GetBalance() *big.Int {
+	object.balanceMu.Lock()
+	defer object.balanceMu.Unlock()
 	return object.Data.Balance
 }
 
@@ -39,6 +42,8 @@ func (object *accountObjectConcurrent) SubBalance(amount *big.Int) {
 	if amount.Sign() == 0 {
 		return
 	}
+	object.balanceMu.Lock()
+	defer object.balanceMu.Unlock()
 	object.Data.Balance = new(big.Int).Sub(object.Data.Balance, amount)
 }
 
@@ -46,11 +51,18 @@ func (object *accountObjectConcurrent) AddBalance(amount *big.Int) {
 	if amount.Sign() == 0 {
 		return
 	}
+	object.balanceMu.Lock()
+	defer object.balanceMu.Unlock()
 	object.Data.Balance = new(big.Int).Add(object.Data.Balance, amount)
 }
 
-func (object *accountObjectConcurrent) SetBalance(amount *big.Int) {
+// SetBalance returns the previous balance
+func (object *accountObjectConcurrent) SetBalance(amount *big.Int) *big.Int {
+	object.balanceMu.Lock()
+	defer object.balanceMu.Unlock()
+	prev := object.Data.Balance
 	object.Data.Balance = amount
+	return prev
 }
 
 func (object *accountObjectConcurrent) GetNonce() uint64 {
@@ -88,5 +100,5 @@ func (object *accountObjectConcurrent) SetStorageState(key, value common.Hash) {
 }
 
 func (object *accountObjectConcurrent) Empty() bool {
-	return object.Data.Nonce == 0 && object.Data.Balance.Sign() == 0 && (object.Data.CodeHash == types.EmptyCodeHash)
+	return object.Data.Nonce == 0 && object.GetBalance().Sign() == 0 && (object.Data.CodeHash == types.EmptyCodeHash)
 }
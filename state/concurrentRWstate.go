@@ -16,6 +16,9 @@ import (
 type FullCacheConcurrent struct {
 	Accounts    sync.Map // try using sync.Map
 	prefectched accesslist.ALTuple
+	warm        *WarmCache       // consulted by Prefetch before the state, nil means none
+	deltaMu     sync.Mutex       // deltas to the same account may be merged concurrently
+	transient   transientStorage // only used when the txs run on the shared state one at a time, see ConcurrentTxState
 
 	Logs    map[common.Hash][]*types.Log `json:"logs,omitempty"`
 	thash   common.Hash
@@ -28,11 +31,13 @@ func NewFullCacheConcurrent() *FullCacheConcurrent {
 		Accounts:    sync.Map{},
 		prefectched: make(accesslist.ALTuple),
 		Logs:        make(map[common.Hash][]*types.Log),
+		transient:   newTransientStorage(),
 	}
 }
 
 func (s *FullCacheConcurrent) Copy() *FullCacheConcurrent {
 	newS := NewFullCacheConcurrent()
+	newS.warm = s.warm
 	s.Accounts.Range(func(key any, value any) bool {
 		newS.Accounts.Store(key, value)
 		return true
@@ -104,7 +109,7 @@ func (s *FullCacheConcurrent) GetCodeSize(addr common.Address) int {
 	return 0
 }
 
-// GetRefund ...
+// GetRefund is zero, the state is shared by the txs, each keeps its refund counter on a ConcurrentTxState
 func (s *FullCacheConcurrent) GetRefund() uint64 {
 	return 0
 }
@@ -128,7 +133,7 @@ func (s *FullCacheConcurrent) GetState(addr common.Address, key common.Hash) com
 
 // GetTransientState gets transient storage for a given account.
 func (s *FullCacheConcurrent) GetTransientState(addr common.Address, key common.Hash) common.Hash {
-	return s.GetState(addr, key)
+	return s.transient.Get(addr, key)
 }
 
 // Exist 检查账户是否存在
@@ -178,6 +183,31 @@ func (s *FullCacheConcurrent) SetBalance(addr common.Address, amount *big.Int) {
 	}
 }
 
+// ApplyBalanceDelta adds the delta merged from a CacheState, creating the account if needed
+func (s *FullCacheConcurrent) ApplyBalanceDelta(addr common.Address, delta *big.Int) {
+	s.deltaMu.Lock()
+	defer s.deltaMu.Unlock()
+	obj, _ := s.Accounts.LoadOrStore(addr, newAccountObjectConcurrent(addr, accountData{}))
+	obj.(*accountObjectConcurrent).AddBalance(delta)
+}
+
+// TryApplyBalanceDeltas adds the deltas merged from a CacheState, or none of them if a balance would go negative.
+// The check and the change are made under one lock, so concurrent merges can't both spend the same balance
+func (s *FullCacheConcurrent) TryApplyBalanceDeltas(deltas map[common.Address]*big.Int) error {
+	s.deltaMu.Lock()
+	defer s.deltaMu.Unlock()
+	for addr, delta := range deltas {
+		if err := checkBalanceDelta(addr, s.GetBalance(addr), delta); err != nil {
+			return err
+		}
+	}
+	for addr, delta := range deltas {
+		obj, _ := s.Accounts.LoadOrStore(addr, newAccountObjectConcurrent(addr, accountData{}))
+		obj.(*accountObjectConcurrent).AddBalance(delta)
+	}
+	return nil
+}
+
 func (s *FullCacheConcurrent) setBalancePrefetch(addr common.Address, amount *big.Int) {
 	stateObject := s.getAccountObject(addr)
 	if stateObject != nil {
@@ -229,11 +259,11 @@ func (s *FullCacheConcurrent) setCodeHashPrefetch(addr common.Address, codeHash
 	}
 }
 
-// AddRefund
+// AddRefund drops the refund, a tx runs on a ConcurrentTxState
 func (s *FullCacheConcurrent) AddRefund(amount uint64) {
 }
 
-// SubRefund
+// SubRefund drops the refund, a tx runs on a ConcurrentTxState
 func (s *FullCacheConcurrent) SubRefund(amount uint64) {
 }
 
@@ -262,11 +292,10 @@ func (s *FullCacheConcurrent) setStatePrefetch(addr common.Address, key common.H
 	}
 }
 
-// SetTransientState sets transient storage for a given account. It
-// adds the change to the journal so that it can be rolled back
-// to its previous value if there is a revert.
+// SetTransientState sets transient storage for a given account.
+// It can't be reverted, as the other changes to the shared state
 func (s *FullCacheConcurrent) SetTransientState(addr common.Address, key, value common.Hash) {
-	s.SetState(addr, key, value)
+	s.transient.Set(addr, key, value)
 }
 
 // Suicide
@@ -276,7 +305,7 @@ func (s *FullCacheConcurrent) SelfDestruct(addr common.Address) {
 		return
 	}
 	stateObject.IsAlive = false
-	stateObject.Data.Balance = new(big.Int)
+	stateObject.SetBalance(new(big.Int))
 }
 
 // HasSuicided ...
@@ -313,7 +342,8 @@ func (s *FullCacheConcurrent) SlotInAccessList(addr common.Address, slot common.
 	return true, true
 }
 
-// RevertToSnapshot ...
+// RevertToSnapshot is a no-op, the shared state can't tell whose changes to revert.
+// Execute each tx on its own ConcurrentTxState to be able to revert.
 func (s *FullCacheConcurrent) RevertToSnapshot(revid int) {
 }
 
@@ -334,7 +364,9 @@ func (s *FullCacheConcurrent) AddLog(log *types.Log) {
 func (s *FullCacheConcurrent) AddPreimage(hash common.Hash, preimage []byte) {
 }
 
+// Prepare resets the transient storage, the access list is always warm
 func (s *FullCacheConcurrent) Prepare(rules params.Rules, sender, coinbase common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	s.transient = newTransientStorage()
 }
 
 // AddressInAccessList returns true if the given address is in the access list.
@@ -350,8 +382,20 @@ func (s *FullCacheConcurrent) SetTxContext(thash common.Hash, ti int) {
 	s.txIndex = ti
 }
 
+// SetWarmCache makes Prefetch read through warm, which keeps the values read across blocks
+func (s *FullCacheConcurrent) SetWarmCache(warm *WarmCache) {
+	s.warm = warm
+}
+
 func (s *FullCacheConcurrent) Prefetch(statedb vm.StateDB, rwSets []*accesslist.RWSet) {
+	if s.warm != nil {
+		statedb = s.warm.Reader(statedb)
+	}
 	for _, rwSet := range rwSets {
+		if rwSet == nil {
+			// a tx without a prediction
+			continue
+		}
 		for addr, State := range rwSet.ReadSet {
 			for hash := range State {
 				s.prefetchSetter(addr, hash, statedb)
@@ -365,21 +409,38 @@ func (s *FullCacheConcurrent) Prefetch(statedb vm.StateDB, rwSets []*accesslist.
 	}
 }
 
+// fieldKey maps the keys of one field of an account to one key, so that a field is prefetched once
+// and never again over the updates of the txs. A delta is applied to the balance, and SetCode sets the code and its hash
+func fieldKey(hash common.Hash) common.Hash {
+	switch hash {
+	case accesslist.BALANCEDELTA:
+		return accesslist.BALANCE
+	case accesslist.CODEHASH:
+		return accesslist.CODE
+	}
+	return hash
+}
+
+// IsPrefetched reports whether the value of hash of addr is prefetched
+func (s *FullCacheConcurrent) IsPrefetched(addr common.Address, hash common.Hash) bool {
+	return s.prefectched.Contains(addr, fieldKey(hash))
+}
+
 func (s *FullCacheConcurrent) prefetchSetter(addr common.Address, hash common.Hash, statedb vm.StateDB) {
-	if s.prefectched.Contains(addr, hash) {
+	key := fieldKey(hash)
+	if s.prefectched.Contains(addr, key) {
 		return
 	}
-	s.prefectched.Add(addr, hash)
+	s.prefectched.Add(addr, key)
 
 	s.CreateAccount(addr)
-	switch hash {
+	switch key {
 	case accesslist.BALANCE:
 		s.setBalancePrefetch(addr, statedb.GetBalance(addr))
 	case accesslist.NONCE:
 		s.setNoncePrefetch(addr, statedb.GetNonce(addr))
-	case accesslist.CODEHASH:
-		s.setCodeHashPrefetch(addr, statedb.GetCodeHash(addr))
 	case accesslist.CODE:
+		s.setCodeHashPrefetch(addr, statedb.GetCodeHash(addr))
 		s.setCodePrefetch(addr, statedb.GetCode(addr))
 	case accesslist.ALIVE:
 		s.setIsAlivePrefetch(addr, statedb.Exist(addr))
@@ -387,3 +448,72 @@ func (s *FullCacheConcurrent) prefetchSetter(addr common.Address, hash common.Ha
 		s.setStatePrefetch(addr, hash, statedb.GetState(addr, hash))
 	}
 }
+
+// Absorb moves the values prefetched in other that s doesn't hold yet into s, e.g. the values of the next block
+// prefetched aside while the current one executes on s. The values s already holds are newer, they are kept.
+// Neither s nor other may be in use meanwhile
+func (s *FullCacheConcurrent) Absorb(other *FullCacheConcurrent) {
+	for addr, state := range other.prefectched {
+		src := other.getAccountObject(addr)
+		for hash := range state {
+			key := fieldKey(hash)
+			if s.prefectched.Contains(addr, key) {
+				continue
+			}
+			s.prefectched.Add(addr, key)
+			s.CreateAccount(addr)
+			switch key {
+			case accesslist.BALANCE:
+				s.setBalancePrefetch(addr, src.GetBalance())
+			case accesslist.NONCE:
+				s.setNoncePrefetch(addr, src.GetNonce())
+			case accesslist.CODE:
+				s.setCodeHashPrefetch(addr, src.CodeHash())
+				s.setCodePrefetch(addr, src.Code())
+			case accesslist.ALIVE:
+				s.setIsAlivePrefetch(addr, src.IsAlive)
+			default:
+				value, _ := src.GetStorageState(hash)
+				s.setStatePrefetch(addr, hash, value)
+			}
+		}
+	}
+}
+
+// WriteTo writes the values of the prefetched keys into statedb, the state they were prefetched from,
+// e.g. to compute the root of the blocks executed on s. Only the prefetched fields are written,
+// the others of an account are left as they are in statedb
+func (s *FullCacheConcurrent) WriteTo(statedb StateInterface) {
+	for addr, state := range s.prefectched {
+		obj := s.getAccountObject(addr)
+		// an account missing at prefetch time is not alive in s until it is destructed and created again
+		if _, ok := state[accesslist.ALIVE]; ok && !obj.IsAlive && statedb.Exist(addr) {
+			statedb.SelfDestruct(addr)
+			continue
+		}
+		for hash := range state {
+			switch hash {
+			case accesslist.BALANCE:
+				statedb.SetBalance(addr, obj.GetBalance())
+			case accesslist.NONCE:
+				statedb.SetNonce(addr, obj.GetNonce())
+			case accesslist.CODE:
+				// the code is only written if a tx changed it, a missing account has no code hash rather than the empty one
+				have, hash := statedb.GetCodeHash(addr), obj.CodeHash()
+				if (have == common.Hash{}) {
+					have = types.EmptyCodeHash
+				}
+				if (hash == common.Hash{}) {
+					hash = types.EmptyCodeHash
+				}
+				if hash != have {
+					statedb.SetCode(addr, obj.Code())
+				}
+			case accesslist.ALIVE:
+			default:
+				value, _ := obj.GetStorageState(hash)
+				statedb.SetState(addr, hash, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"interact/accesslist"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	testAccount = common.HexToAddress("0xbeef")
+	oldCode     = []byte{0x60, 0x01}
+	newCode     = []byte{0x60, 0x02}
+)
+
+func newTestState(t *testing.T) *ethState.StateDB {
+	statedb, err := ethState.New(types.EmptyRootHash, ethState.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.AddBalance(testAccount, big.NewInt(100))
+	statedb.SetCode(testAccount, oldCode)
+	return statedb
+}
+
+func readSet(hash common.Hash) accesslist.RWSetList {
+	rwSet := accesslist.NewRWSet()
+	rwSet.AddReadSet(testAccount, hash)
+	return accesslist.RWSetList{rwSet}
+}
+
+// the keys of one field, s prefetches the first, a tx updates the field and the second is prefetched or absorbed over it
+var fieldKeys = []struct {
+	name          string
+	first, second common.Hash
+}{
+	{"balance then delta", accesslist.BALANCE, accesslist.BALANCEDELTA},
+	{"delta then balance", accesslist.BALANCEDELTA, accesslist.BALANCE},
+	{"code hash then code", accesslist.CODEHASH, accesslist.CODE},
+	{"code then code hash", accesslist.CODE, accesslist.CODEHASH},
+}
+
+func update(s *FullCacheConcurrent) {
+	s.SetBalance(testAccount, big.NewInt(500))
+	s.SetCode(testAccount, newCode)
+}
+
+func checkUpdated(t *testing.T, name string, s *FullCacheConcurrent, key common.Hash) {
+	switch key {
+	case accesslist.BALANCE, accesslist.BALANCEDELTA:
+		if got := s.GetBalance(testAccount); got.Cmp(big.NewInt(500)) != 0 {
+			t.Fatalf("%s: balance %v, want the updated 500", name, got)
+		}
+	default:
+		if got, hash := s.GetCode(testAccount), s.GetCodeHash(testAccount); string(got) != string(newCode) || hash != crypto.Keccak256Hash(newCode) {
+			t.Fatalf("%s: code %x hash %v, want the updated code and its hash", name, got, hash)
+		}
+	}
+}
+
+func TestPrefetchOverUpdatedField(t *testing.T) {
+	statedb := newTestState(t)
+	for _, tt := range fieldKeys {
+		s := NewFullCacheConcurrent()
+		s.Prefetch(statedb, readSet(tt.first))
+		if !s.IsPrefetched(testAccount, tt.second) {
+			t.Fatalf("%s: the second key of the field is not prefetched", tt.name)
+		}
+		update(s)
+		s.Prefetch(statedb, readSet(tt.second))
+		checkUpdated(t, tt.name, s, tt.first)
+	}
+}
+
+func TestAbsorbOverUpdatedField(t *testing.T) {
+	statedb := newTestState(t)
+	for _, tt := range fieldKeys {
+		s := NewFullCacheConcurrent()
+		s.Prefetch(statedb, readSet(tt.first))
+		update(s)
+		// the next block is prefetched aside from the state before the update
+		next := NewFullCacheConcurrent()
+		next.Prefetch(statedb, readSet(tt.second))
+		s.Absorb(next)
+		checkUpdated(t, tt.name, s, tt.first)
+	}
+}
+
+func TestAbsorbMissingField(t *testing.T) {
+	statedb := newTestState(t)
+	s := NewFullCacheConcurrent()
+	s.Prefetch(statedb, readSet(accesslist.NONCE))
+	next := NewFullCacheConcurrent()
+	next.Prefetch(statedb, readSet(accesslist.BALANCEDELTA))
+	next.Prefetch(statedb, readSet(accesslist.CODEHASH))
+	s.Absorb(next)
+	if !s.IsPrefetched(testAccount, accesslist.BALANCE) || !s.IsPrefetched(testAccount, accesslist.CODE) {
+		t.Fatal("the fields of the next block are not absorbed")
+	}
+	// the code comes with its hash
+	if got := s.GetBalance(testAccount); got.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("balance %v, want 100", got)
+	}
+	if got, hash := s.GetCode(testAccount), s.GetCodeHash(testAccount); string(got) != string(oldCode) || hash != crypto.Keccak256Hash(oldCode) {
+		t.Fatalf("code %x hash %v, want the code of the state", got, hash)
+	}
+}
+
+func TestWriteToCode(t *testing.T) {
+	missing := common.HexToAddress("0xdead")
+	for _, tt := range []struct {
+		name    string
+		updated bool
+	}{{"unchanged", false}, {"updated", true}} {
+		statedb := newTestState(t)
+		s := NewFullCacheConcurrent()
+		s.Prefetch(statedb, readSet(accesslist.CODEHASH))
+		s.Prefetch(statedb, accesslist.RWSetList{{ReadSet: accesslist.ALTuple{missing: {accesslist.CODEHASH: struct{}{}}}}})
+		if tt.updated {
+			update(s)
+		}
+		s.WriteTo(statedb)
+		want := oldCode
+		if tt.updated {
+			want = newCode
+		}
+		if got := statedb.GetCode(testAccount); string(got) != string(want) {
+			t.Fatalf("%s: code %x, want %x", tt.name, got, want)
+		}
+		// no code is written to an account missing from the state
+		if statedb.Exist(missing) {
+			t.Fatalf("%s: the missing account is created", tt.name)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package state
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ConcurrentTxState is the view of a single tx on the shared FullCacheConcurrent.
+// Changes go straight to the shared state, and are journaled in the tx's own journal,
+// so that the tx reverts only its own changes while other txs execute concurrently.
+// Balance changes are reverted by the inverse change rather than by restoring the previous value,
+// other txs may have changed the same balance in the meantime.
+type ConcurrentTxState struct {
+	*FullCacheConcurrent
+
+	thash          common.Hash
+	txIndex        int
+	transient      transientStorage // of this tx only
+	refund         uint64           // of this tx only
+	journal        []ccJournalEntry
+	validRevisions []revision
+	nextRevisionId int
+}
+
+func NewConcurrentTxState(fullstate *FullCacheConcurrent) *ConcurrentTxState {
+	return &ConcurrentTxState{FullCacheConcurrent: fullstate, transient: newTransientStorage()}
+}
+
+// ccJournalEntry is a change to the FullCacheConcurrent made by one tx
+type ccJournalEntry interface {
+	revert(*FullCacheConcurrent)
+}
+
+type (
+	ccCreateObjectChange struct {
+		obj *accountObjectConcurrent
+	}
+	ccBalanceDelta struct {
+		account common.Address
+		delta   *big.Int // added to the balance
+	}
+	ccBalanceChange struct {
+		account common.Address
+		prev    *big.Int
+	}
+	ccSelfDestructChange struct {
+		account     common.Address
+		prev        bool
+		prevbalance *big.Int
+	}
+	ccNonceChange struct {
+		account common.Address
+		prev    uint64
+	}
+	ccCodeChange struct {
+		account  common.Address
+		prevcode []byte
+		prevhash common.Hash
+	}
+	ccStorageChange struct {
+		account       common.Address
+		key, prevalue common.Hash
+	}
+	ccTransientStorageChange struct {
+		storage       transientStorage // of the tx, not of the shared state
+		account       common.Address
+		key, prevalue common.Hash
+	}
+	ccRefundChange struct {
+		refund *uint64 // of the tx, not of the shared state
+		prev   uint64
+	}
+)
+
+func (ch ccCreateObjectChange) revert(s *FullCacheConcurrent) {
+	// only the object created by this tx is deleted
+	s.Accounts.CompareAndDelete(ch.obj.Address, ch.obj)
+}
+
+func (ch ccBalanceDelta) revert(s *FullCacheConcurrent) {
+	s.getAccountObject(ch.account).SubBalance(ch.delta)
+}
+
+func (ch ccBalanceChange) revert(s *FullCacheConcurrent) {
+	s.getAccountObject(ch.account).SetBalance(ch.prev)
+}
+
+func (ch ccSelfDestructChange) revert(s *FullCacheConcurrent) {
+	obj := s.getAccountObject(ch.account)
+	obj.IsAlive = ch.prev
+	obj.SetBalance(ch.prevbalance)
+}
+
+func (ch ccNonceChange) revert(s *FullCacheConcurrent) {
+	s.getAccountObject(ch.account).SetNonce(ch.prev)
+}
+
+func (ch ccCodeChange) revert(s *FullCacheConcurrent) {
+	s.getAccountObject(ch.account).SetCode(ch.prevhash, ch.prevcode)
+}
+
+func (ch ccStorageChange) revert(s *FullCacheConcurrent) {
+	s.getAccountObject(ch.account).SetStorageState(ch.key, ch.prevalue)
+}
+
+func (ch ccTransientStorageChange) revert(s *FullCacheConcurrent) {
+	ch.storage.Set(ch.account, ch.key, ch.prevalue)
+}
+
+func (ch ccRefundChange) revert(s *FullCacheConcurrent) {
+	*ch.refund = ch.prev
+}
+
+func (s *ConcurrentTxState) CreateAccount(addr common.Address) {
+	obj := newAccountObjectConcurrent(addr, accountData{})
+	if _, loaded := s.Accounts.LoadOrStore(addr, obj); !loaded {
+		s.journal = append(s.journal, ccCreateObjectChange{obj})
+	}
+}
+
+func (s *ConcurrentTxState) SubBalance(addr common.Address, amount *big.Int) {
+	s.AddBalance(addr, new(big.Int).Neg(amount))
+}
+
+func (s *ConcurrentTxState) AddBalance(addr common.Address, amount *big.Int) {
+	stateObject := s.getAccountObject(addr)
+	if stateObject != nil && amount.Sign() != 0 {
+		s.journal = append(s.journal, ccBalanceDelta{addr, new(big.Int).Set(amount)})
+		stateObject.AddBalance(amount)
+	}
+}
+
+func (s *ConcurrentTxState) SetBalance(addr common.Address, amount *big.Int) {
+	stateObject := s.getAccountObject(addr)
+	if stateObject != nil {
+		s.journal = append(s.journal, ccBalanceChange{addr, stateObject.SetBalance(amount)})
+	}
+}
+
+func (s *ConcurrentTxState) SetNonce(addr common.Address, nonce uint64) {
+	stateObject := s.getAccountObject(addr)
+	if stateObject != nil {
+		s.journal = append(s.journal, ccNonceChange{addr, stateObject.GetNonce()})
+		stateObject.SetNonce(nonce)
+	}
+}
+
+func (s *ConcurrentTxState) SetCode(addr common.Address, code []byte) {
+	stateObject := s.getAccountObject(addr)
+	if stateObject != nil {
+		s.journal = append(s.journal, ccCodeChange{addr, stateObject.Code(), stateObject.CodeHash()})
+		stateObject.SetCode(crypto.Keccak256Hash(code), code)
+	}
+}
+
+// SetState only writes the prefetched slots, as FullCacheConcurrent.SetState
+func (s *ConcurrentTxState) SetState(addr common.Address, key common.Hash, value common.Hash) {
+	stateObject := s.getAccountObject(addr)
+	if stateObject != nil {
+		if prev, ok := stateObject.GetStorageState(key); ok {
+			s.journal = append(s.journal, ccStorageChange{addr, key, prev})
+			stateObject.SetStorageState(key, value)
+		}
+	}
+}
+
+func (s *ConcurrentTxState) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.transient.Get(addr, key)
+}
+
+func (s *ConcurrentTxState) SetTransientState(addr common.Address, key, value common.Hash) {
+	s.journal = append(s.journal, ccTransientStorageChange{s.transient, addr, key, s.transient.Get(addr, key)})
+	s.transient.Set(addr, key, value)
+}
+
+// Prepare resets the transient storage and the refund counter of the tx, the access list is always warm
+func (s *ConcurrentTxState) Prepare(rules params.Rules, sender, coinbase common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	s.transient = newTransientStorage()
+	s.refund = 0
+}
+
+// GetRefund returns the refund counter of the tx
+func (s *ConcurrentTxState) GetRefund() uint64 {
+	return s.refund
+}
+
+// AddRefund adds gas to the refund counter of the tx
+func (s *ConcurrentTxState) AddRefund(amount uint64) {
+	s.journal = append(s.journal, ccRefundChange{&s.refund, s.refund})
+	s.refund += amount
+}
+
+// SubRefund removes gas from the refund counter of the tx, it panics if the counter goes below zero
+func (s *ConcurrentTxState) SubRefund(amount uint64) {
+	s.journal = append(s.journal, ccRefundChange{&s.refund, s.refund})
+	if amount > s.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", amount, s.refund))
+	}
+	s.refund -= amount
+}
+
+func (s *ConcurrentTxState) SelfDestruct(addr common.Address) {
+	stateObject := s.getAccountObject(addr)
+	if stateObject == nil {
+		return
+	}
+	prev := stateObject.IsAlive
+	stateObject.IsAlive = false
+	s.journal = append(s.journal, ccSelfDestructChange{addr, prev, stateObject.SetBalance(new(big.Int))})
+}
+
+func (s *ConcurrentTxState) Selfdestruct6780(addr common.Address) {
+	s.SelfDestruct(addr)
+}
+
+// SetTxContext keeps the tx context apart from the other txs
+func (s *ConcurrentTxState) SetTxContext(thash common.Hash, ti int) {
+	s.thash = thash
+	s.txIndex = ti
+}
+
+// RevertToSnapshot undoes the changes of this tx since the snapshot
+func (s *ConcurrentTxState) RevertToSnapshot(revid int) {
+	idx := sort.Search(len(s.validRevisions), func(i int) bool {
+		return s.validRevisions[i].id >= revid
+	})
+	if idx == len(s.validRevisions) || s.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	snapshot := s.validRevisions[idx].journalIndex
+
+	for i := len(s.journal) - 1; i >= snapshot; i-- {
+		s.journal[i].revert(s.FullCacheConcurrent)
+	}
+	s.journal = s.journal[:snapshot]
+	s.validRevisions = s.validRevisions[:idx]
+}
+
+// Snapshot ...
+func (s *ConcurrentTxState) Snapshot() int {
+	id := s.nextRevisionId
+	s.nextRevisionId++
+	s.validRevisions = append(s.validRevisions, revision{id, len(s.journal)})
+	return id
+}
@@ -13,6 +13,7 @@ import (
 type StateWithRwSets struct {
 	stateDB StateInterface
 	rwSets  *accesslist.RWSet
+	excl    map[common.Address]struct{} // stateless precompile contracts, set by Prepare
 }
 
 func NewStateWithRwSets(stateDB StateInterface) *StateWithRwSets {
@@ -22,6 +23,24 @@ func NewStateWithRwSets(stateDB StateInterface) *StateWithRwSets {
 	}
 }
 
+func (fs *StateWithRwSets) addRead(addr common.Address, hash common.Hash) {
+	if fs.rwSets == nil {
+		return
+	}
+	if _, ok := fs.excl[addr]; !ok {
+		fs.rwSets.AddReadSet(addr, hash)
+	}
+}
+
+func (fs *StateWithRwSets) addWrite(addr common.Address, hash common.Hash) {
+	if fs.rwSets == nil {
+		return
+	}
+	if _, ok := fs.excl[addr]; !ok {
+		fs.rwSets.AddWriteSet(addr, hash)
+	}
+}
+
 // ----------------------- Getters ----------------------------
 func (fs *StateWithRwSets) GetStateDB() StateInterface {
 	return fs.stateDB
@@ -32,37 +51,27 @@ func (fs *StateWithRwSets) GetRWSet() *accesslist.RWSet {
 }
 
 func (fs *StateWithRwSets) GetBalance(addr common.Address) *big.Int {
-	if fs.rwSets != nil {
-		// fs.rwSets.AddReadSet(addr, accesslist.BALANCE)
-	}
+	fs.addRead(addr, accesslist.BALANCE)
 	return fs.stateDB.GetBalance(addr)
 }
 
 func (fs *StateWithRwSets) GetNonce(addr common.Address) uint64 {
-	if fs.rwSets != nil {
-		// fs.rwSets.AddReadSet(addr, accesslist.NONCE)
-	}
+	fs.addRead(addr, accesslist.NONCE)
 	return fs.stateDB.GetNonce(addr)
 }
 
 func (fs *StateWithRwSets) GetCodeHash(addr common.Address) common.Hash {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, accesslist.CODEHASH)
-	}
+	fs.addRead(addr, accesslist.CODEHASH)
 	return fs.stateDB.GetCodeHash(addr)
 }
 
 func (fs *StateWithRwSets) GetCode(addr common.Address) []byte {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, accesslist.CODE)
-	}
+	fs.addRead(addr, accesslist.CODE)
 	return fs.stateDB.GetCode(addr)
 }
 
 func (fs *StateWithRwSets) GetCodeSize(addr common.Address) int {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, accesslist.CODE)
-	}
+	fs.addRead(addr, accesslist.CODE)
 	return fs.stateDB.GetCodeSize(addr)
 }
 
@@ -71,31 +80,23 @@ func (fs *StateWithRwSets) GetRefund() uint64 {
 }
 
 func (fs *StateWithRwSets) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, key)
-	}
+	fs.addRead(addr, key)
 	return fs.stateDB.GetCommittedState(addr, key)
 }
 
 func (fs *StateWithRwSets) GetState(addr common.Address, key common.Hash) common.Hash {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, key)
-	}
+	fs.addRead(addr, key)
 	return fs.stateDB.GetState(addr, key)
 }
 
 func (fs *StateWithRwSets) GetTransientState(addr common.Address, key common.Hash) common.Hash {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, key)
-	}
+	// transient storage is discarded at the end of the tx, it never conflicts
 	return fs.stateDB.GetTransientState(addr, key)
 }
 
 func (fs *StateWithRwSets) HasSelfDestructed(addr common.Address) bool {
-	if fs.rwSets != nil {
-		fs.rwSets.AddReadSet(addr, accesslist.ALIVE)
-	}
-	return fs.HasSelfDestructed(addr)
+	fs.addRead(addr, accesslist.ALIVE)
+	return fs.stateDB.HasSelfDestructed(addr)
 }
 
 func (fs *StateWithRwSets) Exist(addr common.Address) bool {
@@ -120,64 +121,76 @@ func (fs *StateWithRwSets) CreateAccount(addr common.Address) {
 }
 
 func (fs *StateWithRwSets) AddBalance(addr common.Address, amount *big.Int) {
-	if fs.rwSets != nil {
-		// fs.rwSets.AddWriteSet(addr, accesslist.BALANCE)
+	// a zero amount only touches the account, e.g. the AddBalance of StaticCall
+	if amount.Sign() != 0 {
+		fs.addRead(addr, accesslist.BALANCE)
+		fs.addWrite(addr, accesslist.BALANCE)
 	}
 	fs.stateDB.AddBalance(addr, amount)
 }
 
 func (fs *StateWithRwSets) SubBalance(addr common.Address, amount *big.Int) {
-	if fs.rwSets != nil {
-		// fs.rwSets.AddWriteSet(addr, accesslist.BALANCE)
+	if amount.Sign() != 0 {
+		fs.addRead(addr, accesslist.BALANCE)
+		fs.addWrite(addr, accesslist.BALANCE)
 	}
 	fs.stateDB.SubBalance(addr, amount)
 }
 
-func (fs *StateWithRwSets) SetBalance(addr common.Address, amount *big.Int) {
-	if fs.rwSets != nil {
-		// fs.rwSets.AddWriteSet(addr, accesslist.BALANCE)
+// balanceDeltaRecorder is a state keeping the deltas of core.TransferDelta aside
+type balanceDeltaRecorder interface {
+	AddBalanceDelta(addr common.Address, delta *big.Int)
+}
+
+// AddBalanceDelta records a delta, which doesn't conflict with other deltas.
+// The delta is applied right away if the wrapped state doesn't keep deltas aside
+func (fs *StateWithRwSets) AddBalanceDelta(addr common.Address, delta *big.Int) {
+	fs.addWrite(addr, accesslist.BALANCEDELTA)
+	if recorder, ok := fs.stateDB.(balanceDeltaRecorder); ok {
+		recorder.AddBalanceDelta(addr, delta)
+		return
+	}
+	if delta.Sign() < 0 {
+		fs.stateDB.SubBalance(addr, new(big.Int).Neg(delta))
+	} else {
+		fs.stateDB.AddBalance(addr, delta)
 	}
+}
+
+func (fs *StateWithRwSets) SetBalance(addr common.Address, amount *big.Int) {
+	fs.addWrite(addr, accesslist.BALANCE)
 	fs.stateDB.SetBalance(addr, amount)
 }
 
 func (fs *StateWithRwSets) SetNonce(addr common.Address, nonce uint64) {
-	if fs.rwSets != nil {
-		// fs.rwSets.AddWriteSet(addr, accesslist.NONCE)
-	}
+	fs.addWrite(addr, accesslist.NONCE)
 	fs.stateDB.SetNonce(addr, nonce)
 }
 
 func (fs *StateWithRwSets) SetCode(addr common.Address, code []byte) {
-	if fs.rwSets != nil {
-		fs.rwSets.AddWriteSet(addr, accesslist.CODE)
-		fs.rwSets.AddWriteSet(addr, accesslist.CODEHASH)
-	}
+	fs.addWrite(addr, accesslist.CODE)
+	fs.addWrite(addr, accesslist.CODEHASH)
 	fs.stateDB.SetCode(addr, code)
 }
 
 func (fs *StateWithRwSets) SetState(addr common.Address, key, value common.Hash) {
-	if fs.rwSets != nil {
-		fs.rwSets.AddWriteSet(addr, key)
-	}
+	fs.addWrite(addr, key)
 	fs.stateDB.SetState(addr, key, value)
 }
 
 func (fs *StateWithRwSets) SetTransientState(addr common.Address, key, value common.Hash) {
-	if fs.rwSets != nil {
-		fs.rwSets.AddWriteSet(addr, key)
-	}
 	fs.stateDB.SetTransientState(addr, key, value)
 }
 
 func (fs *StateWithRwSets) SelfDestruct(addr common.Address) {
-	if fs.rwSets != nil {
-		fs.rwSets.AddWriteSet(addr, accesslist.ALIVE)
-		fs.rwSets.AddWriteSet(addr, accesslist.BALANCE)
-	}
+	fs.addWrite(addr, accesslist.ALIVE)
+	fs.addWrite(addr, accesslist.BALANCE)
 	fs.stateDB.SelfDestruct(addr)
 }
 
 func (fs *StateWithRwSets) Selfdestruct6780(addr common.Address) {
+	fs.addWrite(addr, accesslist.ALIVE)
+	fs.addWrite(addr, accesslist.BALANCE)
 	fs.stateDB.Selfdestruct6780(addr)
 }
 
@@ -222,6 +235,10 @@ func (fs *StateWithRwSets) AddPreimage(hash common.Hash, preimage []byte) {
 }
 
 func (fs *StateWithRwSets) Prepare(rules params.Rules, sender, coinbase common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	fs.excl = make(map[common.Address]struct{}, len(precompiles))
+	for _, addr := range precompiles {
+		fs.excl[addr] = struct{}{}
+	}
 	fs.stateDB.Prepare(rules, sender, coinbase, dst, precompiles, list)
 }
 
@@ -100,6 +100,10 @@ type (
 		account *common.Address
 		prev    *big.Int
 	}
+	balanceDeltaChange struct {
+		account *common.Address
+		prev    *big.Int // nil if there was no delta
+	}
 	nonceChange struct {
 		account *common.Address
 		prev    uint64
@@ -116,6 +120,13 @@ type (
 	addLogChange struct {
 		txhash common.Hash
 	}
+	transientStorageChange struct {
+		account       *common.Address
+		key, prevalue common.Hash
+	}
+	refundChange struct {
+		prev uint64
+	}
 )
 
 func (ch createObjectChange) revert(s *CacheState) {
@@ -146,6 +157,19 @@ func (ch balanceChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch balanceDeltaChange) revert(s *CacheState) {
+	if ch.prev == nil {
+		delete(s.BalanceDeltas, *ch.account)
+	} else {
+		s.BalanceDeltas[*ch.account] = ch.prev
+	}
+}
+
+// deltas are merged apart from the dirty accounts
+func (ch balanceDeltaChange) dirtied() *common.Address {
+	return nil
+}
+
 func (ch nonceChange) revert(s *CacheState) {
 	s.getAccountObject(*ch.account).SetNonce(ch.prev)
 }
@@ -183,3 +207,19 @@ func (ch addLogChange) revert(s *CacheState) {
 func (ch addLogChange) dirtied() *common.Address {
 	return nil
 }
+
+func (ch transientStorageChange) revert(s *CacheState) {
+	s.transient.Set(*ch.account, ch.key, ch.prevalue)
+}
+
+func (ch transientStorageChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch refundChange) revert(s *CacheState) {
+	s.refund = ch.prev
+}
+
+func (ch refundChange) dirtied() *common.Address {
+	return nil
+}
@@ -0,0 +1,228 @@
+package state
+
+import (
+	"container/list"
+	"fmt"
+	"interact/accesslist"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// WarmCache keeps the values read by the prefetches of the recent blocks, so the hot accounts and slots,
+// e.g. of WETH, USDC or the Uniswap pools, are not read from disk again by every block.
+// The values are those of the state after the last block the cache is invalidated with,
+// so the writes of every block must be invalidated before the next block is prefetched.
+// It is bounded by the approximate size of the values and evicts the least recently used first, it is safe for concurrent use
+type WarmCache struct {
+	mu       sync.Mutex
+	capacity int // in bytes
+	size     int
+	entries  map[warmKey]*list.Element
+	byAddr   map[common.Address]map[common.Hash]struct{} // the keys of each account, a self destruct drops them all
+	lru      *list.List                                  // the most recently used at the front
+
+	hits, misses, evictions, invalidations uint64
+}
+
+type warmKey struct {
+	addr common.Address
+	hash common.Hash // a slot or one of the pseudo keys of accesslist
+}
+
+type warmEntry struct {
+	key   warmKey
+	value any
+	size  int
+}
+
+// WarmCacheStats are the counters of a WarmCache
+type WarmCacheStats struct {
+	Hits, Misses, Evictions, Invalidations uint64
+	Entries, Size                          int
+}
+
+func (s WarmCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (s WarmCacheStats) String() string {
+	return fmt.Sprintf("Hits: %d Misses: %d Hit Rate: %.2f Evictions: %d Invalidations: %d Entries: %d Size: %d",
+		s.Hits, s.Misses, s.HitRate(), s.Evictions, s.Invalidations, s.Entries, s.Size)
+}
+
+// NewWarmCache returns a cache holding about capacity bytes of values
+func NewWarmCache(capacity int) *WarmCache {
+	return &WarmCache{
+		capacity: capacity,
+		entries:  make(map[warmKey]*list.Element),
+		byAddr:   make(map[common.Address]map[common.Hash]struct{}),
+		lru:      list.New(),
+	}
+}
+
+// entrySize is the size of a value with its key and the bookkeeping, the code is counted by its length
+func entrySize(value any) int {
+	size := common.AddressLength + common.HashLength + 64
+	switch v := value.(type) {
+	case []byte:
+		size += len(v)
+	case *big.Int:
+		size += len(v.Bits()) * 8
+	default:
+		size += common.HashLength
+	}
+	return size
+}
+
+func (c *WarmCache) get(key warmKey) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*warmEntry).value, true
+}
+
+func (c *WarmCache) put(key warmKey, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+	entry := &warmEntry{key: key, value: value, size: entrySize(value)}
+	if entry.size > c.capacity {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if _, ok := c.byAddr[key.addr]; !ok {
+		c.byAddr[key.addr] = make(map[common.Hash]struct{})
+	}
+	c.byAddr[key.addr][key.hash] = struct{}{}
+	c.size += entry.size
+	for c.size > c.capacity {
+		c.removeElement(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *WarmCache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*warmEntry)
+	delete(c.entries, entry.key)
+	delete(c.byAddr[entry.key.addr], entry.key.hash)
+	if len(c.byAddr[entry.key.addr]) == 0 {
+		delete(c.byAddr, entry.key.addr)
+	}
+	c.size -= entry.size
+}
+
+func (c *WarmCache) remove(key warmKey) {
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+		c.invalidations++
+	}
+}
+
+// Invalidate drops the values written by a block, e.g. the union of the write sets of its txs.
+// A delta drops the balance, the code drops the code hash too, and a self destruct drops the whole account.
+// Any write may create the account or leave it empty, so it drops whether the account exists too
+func (c *WarmCache) Invalidate(writeSet accesslist.ALTuple) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, state := range writeSet {
+		if _, ok := state[accesslist.ALIVE]; ok {
+			for hash := range c.byAddr[addr] {
+				c.remove(warmKey{addr, hash})
+			}
+			continue
+		}
+		c.remove(warmKey{addr, accesslist.ALIVE})
+		for hash := range state {
+			switch hash {
+			case accesslist.BALANCEDELTA:
+				c.remove(warmKey{addr, accesslist.BALANCE})
+			case accesslist.CODE, accesslist.CODEHASH:
+				c.remove(warmKey{addr, accesslist.CODE})
+				c.remove(warmKey{addr, accesslist.CODEHASH})
+			default:
+				c.remove(warmKey{addr, hash})
+			}
+		}
+	}
+}
+
+// InvalidateRWSets drops the values written by the txs of rwSets, the txs without a set are skipped
+func (c *WarmCache) InvalidateRWSets(rwSets accesslist.RWSetList) {
+	for _, rwSet := range rwSets {
+		if rwSet != nil {
+			c.Invalidate(rwSet.WriteSet)
+		}
+	}
+}
+
+func (c *WarmCache) Stats() WarmCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return WarmCacheStats{
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+		Entries:       len(c.entries),
+		Size:          c.size,
+	}
+}
+
+// Reader returns statedb reading through the cache, the values read from statedb are cached
+func (c *WarmCache) Reader(statedb vm.StateDB) vm.StateDB {
+	return &warmReader{StateDB: statedb, cache: c}
+}
+
+// warmReader overrides the getters the prefetchers use
+type warmReader struct {
+	vm.StateDB
+	cache *WarmCache
+}
+
+func warmRead[V any](r *warmReader, addr common.Address, hash common.Hash, read func() V) V {
+	key := warmKey{addr, hash}
+	if value, ok := r.cache.get(key); ok {
+		return value.(V)
+	}
+	value := read()
+	r.cache.put(key, value)
+	return value
+}
+
+func (r *warmReader) GetBalance(addr common.Address) *big.Int {
+	return warmRead(r, addr, accesslist.BALANCE, func() *big.Int { return r.StateDB.GetBalance(addr) })
+}
+
+func (r *warmReader) GetNonce(addr common.Address) uint64 {
+	return warmRead(r, addr, accesslist.NONCE, func() uint64 { return r.StateDB.GetNonce(addr) })
+}
+
+func (r *warmReader) GetCodeHash(addr common.Address) common.Hash {
+	return warmRead(r, addr, accesslist.CODEHASH, func() common.Hash { return r.StateDB.GetCodeHash(addr) })
+}
+
+func (r *warmReader) GetCode(addr common.Address) []byte {
+	return warmRead(r, addr, accesslist.CODE, func() []byte { return r.StateDB.GetCode(addr) })
+}
+
+func (r *warmReader) Exist(addr common.Address) bool {
+	return warmRead(r, addr, accesslist.ALIVE, func() bool { return r.StateDB.Exist(addr) })
+}
+
+func (r *warmReader) GetState(addr common.Address, key common.Hash) common.Hash {
+	return warmRead(r, addr, key, func() common.Hash { return r.StateDB.GetState(addr, key) })
+}
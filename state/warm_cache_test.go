@@ -0,0 +1,110 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"interact/accesslist"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// accountSet reads the balance, the nonce, the code hash and the slots of testAccount
+func accountSet(slots ...common.Hash) accesslist.RWSetList {
+	rwSet := accesslist.NewRWSet()
+	for _, hash := range append([]common.Hash{accesslist.BALANCE, accesslist.NONCE, accesslist.CODEHASH}, slots...) {
+		rwSet.AddReadSet(testAccount, hash)
+	}
+	return accesslist.RWSetList{rwSet}
+}
+
+func TestWarmCache(t *testing.T) {
+	statedb := newTestState(t)
+	slot := common.BigToHash(common.Big1)
+	statedb.SetState(testAccount, slot, common.BigToHash(common.Big1))
+	warm := NewWarmCache(1 << 20)
+
+	cold := NewCacheState()
+	cold.SetWarmCache(warm)
+	cold.Prefetch(statedb, accountSet(slot))
+	if stats := warm.Stats(); stats.Hits != 0 || stats.Misses == 0 || stats.Entries != int(stats.Misses) {
+		t.Fatalf("cold prefetch: %v", stats)
+	}
+
+	// the next block runs on the state after a block writing the nonce and the slot, its writes are invalidated
+	statedb.SetNonce(testAccount, 1)
+	statedb.SetState(testAccount, slot, common.BigToHash(common.Big2))
+	writes := accesslist.NewRWSet()
+	writes.AddWriteSet(testAccount, accesslist.NONCE)
+	writes.AddWriteSet(testAccount, slot)
+	warm.InvalidateRWSets(accesslist.RWSetList{writes, nil})
+	misses := warm.Stats().Misses
+
+	warmed := NewCacheState()
+	warmed.SetWarmCache(warm)
+	warmed.Prefetch(statedb, accountSet(slot))
+	stats := warm.Stats()
+	if stats.Hits == 0 || stats.Invalidations == 0 {
+		t.Errorf("warm prefetch: %v", stats)
+	}
+	// the invalidated values are read again from the state
+	if stats.Misses == misses || warmed.GetNonce(testAccount) != 1 || warmed.GetState(testAccount, slot) != common.BigToHash(common.Big2) {
+		t.Errorf("stale values: nonce %d slot %v, %v", warmed.GetNonce(testAccount), warmed.GetState(testAccount, slot), stats)
+	}
+	if warmed.GetCodeHash(testAccount) != crypto.Keccak256Hash(oldCode) || warmed.GetBalance(testAccount).Cmp(big.NewInt(100)) != 0 {
+		t.Error("wrong code hash or balance from the warm cache")
+	}
+}
+
+func TestWarmCacheInvalidate(t *testing.T) {
+	statedb := newTestState(t)
+	for _, tt := range []struct {
+		name    string
+		write   common.Hash
+		dropped []common.Hash
+	}{
+		{"delta", accesslist.BALANCEDELTA, []common.Hash{accesslist.BALANCE}},
+		{"code", accesslist.CODE, []common.Hash{accesslist.CODE, accesslist.CODEHASH}},
+		{"code hash", accesslist.CODEHASH, []common.Hash{accesslist.CODE, accesslist.CODEHASH}},
+		{"self destruct", accesslist.ALIVE, []common.Hash{accesslist.BALANCE, accesslist.NONCE, accesslist.CODE, accesslist.CODEHASH, accesslist.ALIVE}},
+	} {
+		warm := NewWarmCache(1 << 20)
+		reader := warm.Reader(statedb)
+		reader.GetBalance(testAccount)
+		reader.GetNonce(testAccount)
+		reader.GetCode(testAccount)
+		reader.GetCodeHash(testAccount)
+		reader.Exist(testAccount)
+		warm.Invalidate(accesslist.ALTuple{testAccount: {tt.write: struct{}{}}})
+
+		// a write drops whether the account exists too
+		dropped := map[common.Hash]bool{accesslist.ALIVE: true}
+		for _, hash := range tt.dropped {
+			dropped[hash] = true
+		}
+		if stats := warm.Stats(); stats.Entries != 5-len(dropped) || stats.Invalidations != uint64(len(dropped)) {
+			t.Fatalf("%s: %v, want %d values dropped", tt.name, stats, len(dropped))
+		}
+		for _, hash := range []common.Hash{accesslist.BALANCE, accesslist.NONCE, accesslist.CODE, accesslist.CODEHASH, accesslist.ALIVE} {
+			if _, ok := warm.get(warmKey{testAccount, hash}); ok == dropped[hash] {
+				t.Fatalf("%s: %v cached %v, want %v", tt.name, hash, ok, !dropped[hash])
+			}
+		}
+	}
+}
+
+func TestWarmCacheEviction(t *testing.T) {
+	statedb := newTestState(t)
+	// a cache of two slots keeps the most recent ones
+	small := NewWarmCache(300)
+	reader := small.Reader(statedb)
+	for i := int64(0); i < 8; i++ {
+		reader.GetState(testAccount, common.BigToHash(big.NewInt(i)))
+	}
+	reader.GetState(testAccount, common.BigToHash(big.NewInt(7)))
+	reader.GetState(testAccount, common.BigToHash(big.NewInt(0)))
+	if stats := small.Stats(); stats.Entries != 2 || stats.Size > 300 || stats.Hits != 1 || stats.Misses != 9 || stats.Evictions != 7 {
+		t.Errorf("small cache: %v", stats)
+	}
+}
@@ -9,28 +9,39 @@ import (
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/params"
 	"github.com/panjf2000/ants/v2"
 )
 
-// This function execute without generating tracer.list
-func executeTx(statedb state.StateInterface, tx *types.Transaction, header *types.Header, chainCtx core.ChainContext, evm *vm.EVM) error {
-	msg, err := core.TransactionToMessage(tx, types.LatestSigner(params.MainnetChainConfig), header.BaseFee)
+// This function execute without generating tracer.list and returns the gas used by tx,
+// the nonce of the sender is checked, so the earlier txs of the sender must have been executed on statedb
+func executeTx(statedb state.StateInterface, tx *types.Transaction, header *types.Header, chainCtx core.ChainContext, evm *vm.EVM) (uint64, error) {
+	return applyTx(statedb, tx, header, chainCtx, evm, false)
+}
+
+// predictTx skips the nonce check, a prediction runs tx without the earlier txs of its sender in the block
+func predictTx(statedb state.StateInterface, tx *types.Transaction, header *types.Header, chainCtx core.ChainContext, evm *vm.EVM) error {
+	_, err := applyTx(statedb, tx, header, chainCtx, evm, true)
+	return err
+}
+
+func applyTx(statedb state.StateInterface, tx *types.Transaction, header *types.Header, chainCtx core.ChainContext, evm *vm.EVM, skipAccountChecks bool) (uint64, error) {
+	msg, err := core.TransactionToMessage(tx, types.MakeSigner(chainCtx.Config(), header.Number, header.Time), header.BaseFee)
 
 	if err != nil {
 		// This error means the transaction is invalid and should be discarded
-		return err
+		return 0, err
 	}
-	// Skip the nonce check!
-	msg.SkipAccountChecks = true
+	msg.SkipAccountChecks = skipAccountChecks
 	txCtx := core.NewEVMTxContext(msg)
 	evm.TxContext = txCtx
 
 	snapshot := statedb.Snapshot()
-	_, err = core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.GasLimit))
+	// the gas pool of a single tx, the block gas limit is checked by utils.BlockGasMeter in block order
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.GasLimit))
 	if err != nil {
-		// This error means the Execution phase failed and the transaction has been reverted
-		return err
+		// This error means the transaction is invalid, drop whatever it has changed
+		statedb.RevertToSnapshot(snapshot)
+		return 0, err
 	}
 
 	switch statedb.(type) {
@@ -40,7 +51,7 @@ func executeTx(statedb state.StateInterface, tx *types.Transaction, header *type
 			statedb.(*state.CacheState).StateJudge = true
 			// This error means the prediction is false, and the transaction should be reverted
 			statedb.RevertToSnapshot(snapshot)
-			return ErrFalsePredict
+			return 0, ErrFalsePredict
 		}
 
 	case *state.StateWithRwSets:
@@ -51,7 +62,7 @@ func executeTx(statedb state.StateInterface, tx *types.Transaction, header *type
 				innerState.(*state.CacheState).StateJudge = true
 				// This error means the prediction is false, and the transaction should be reverted
 				statedb.RevertToSnapshot(snapshot)
-				return ErrFalsePredict
+				return 0, ErrFalsePredict
 			}
 		default:
 			break
@@ -61,18 +72,19 @@ func executeTx(statedb state.StateInterface, tx *types.Transaction, header *type
 		break
 	}
 
-	return nil
+	return result.UsedGas, nil
 }
 
 // ExecuteTxs a batch of transactions in a single atomic state transition.
-func ExecuteTxs(sdb state.StateInterface, txs []*types.Transaction, header *types.Header, chainCtx core.ChainContext) []error {
-	evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, sdb, params.MainnetChainConfig, vm.Config{})
+func ExecuteTxs(sdb state.StateInterface, txs []*types.Transaction, header *types.Header, chainCtx core.ChainContext) ([]error, []uint64) {
+	evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, sdb, chainCtx.Config(), vm.Config{})
 	errs := make([]error, len(txs))
+	gasUsed := make([]uint64, len(txs))
 	for i, tx := range txs {
 		// ExecBasedOnRWSets includes the snapshot logic
-		errs[i] = executeTx(sdb, tx, header, chainCtx, evm)
+		gasUsed[i], errs[i] = executeTx(sdb, tx, header, chainCtx, evm)
 	}
-	return errs
+	return errs, gasUsed
 }
 
 type ParameterForTxGroup struct {
@@ -106,13 +118,14 @@ func ExecuteWithAntsCacheState(pool *ants.PoolWithFunc, txsGroups []types.Transa
 }
 
 // Execute with ants Pool with cacheState
-func ExecConflictedTxs(pool *ants.Pool, txsGroups []types.Transactions, CacheStates state.CacheStateList, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) [][]error {
+func ExecConflictedTxs(pool *ants.Pool, txsGroups []types.Transactions, CacheStates state.CacheStateList, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) ([][]error, [][]uint64) {
 	wg.Add(len(txsGroups))
 	errss := make([][]error, len(txsGroups))
+	gasUsed := make([][]uint64, len(txsGroups))
 	for j := 0; j < len(txsGroups); j++ {
 		taskNum := j
 		err := pool.Submit(func() {
-			errss[taskNum] = ExecuteTxs(CacheStates[taskNum], txsGroups[taskNum], header, chainCtx)
+			errss[taskNum], gasUsed[taskNum] = ExecuteTxs(CacheStates[taskNum], txsGroups[taskNum], header, chainCtx)
 			wg.Done() // Mark the task as completed
 		})
 		if err != nil {
@@ -122,16 +135,20 @@ func ExecConflictedTxs(pool *ants.Pool, txsGroups []types.Transactions, CacheSta
 	}
 	// Wait for all tasks to complete
 	wg.Wait()
-	return errss
+	return errss, gasUsed
 }
 
-func ExecuteWithCCFullState(pool *ants.Pool, txs types.Transactions, fullstate *state.FullCacheConcurrent, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) {
+func ExecuteWithCCFullState(pool *ants.Pool, txs types.Transactions, fullstate *state.FullCacheConcurrent, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) ([]error, []uint64) {
 	wg.Add(len(txs))
+	errs := make([]error, len(txs))
+	gasUsed := make([]uint64, len(txs))
 	for i := 0; i < len(txs); i++ {
 		taskNum := i
-		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, fullstate, params.MainnetChainConfig, vm.Config{})
+		// each tx journals its own changes on the shared state
+		txState := state.NewConcurrentTxState(fullstate)
+		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, txState, chainCtx.Config(), vm.Config{})
 		err := pool.Submit(func() {
-			executeTx(fullstate, txs[taskNum], header, chainCtx, evm)
+			gasUsed[taskNum], errs[taskNum] = executeTx(txState, txs[taskNum], header, chainCtx, evm)
 			wg.Done() // Mark the task as completed
 		})
 		if err != nil {
@@ -140,6 +157,7 @@ func ExecuteWithCCFullState(pool *ants.Pool, txs types.Transactions, fullstate *
 		}
 	}
 	wg.Wait()
+	return errs, gasUsed
 }
 
 func ExecConflictFreeTxsGeneratingRwSets(pool *ants.Pool, txs types.Transactions, CacheStates []*state.CacheState, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) ([]error, accesslist.RWSetList) {
@@ -151,11 +169,11 @@ func ExecConflictFreeTxsGeneratingRwSets(pool *ants.Pool, txs types.Transactions
 		stateWithRwsets := state.NewStateWithRwSets(CacheStates[taskNum])
 		rwSet := accesslist.NewRWSet()
 		stateWithRwsets.SetRWSet(rwSet)
-		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, stateWithRwsets, params.MainnetChainConfig, vm.Config{})
+		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, stateWithRwsets, chainCtx.Config(), vm.Config{})
 
 		// Submit tasks to the ants pool
 		err := pool.Submit(func() {
-			errs[taskNum] = executeTx(stateWithRwsets, txs[taskNum], header, chainCtx, evm)
+			_, errs[taskNum] = executeTx(stateWithRwsets, txs[taskNum], header, chainCtx, evm)
 			rwsets[taskNum] = rwSet
 			wg.Done() // Mark the task as completed
 		})
@@ -169,16 +187,17 @@ func ExecConflictFreeTxsGeneratingRwSets(pool *ants.Pool, txs types.Transactions
 }
 
 // Concurrently execute single transaction, rather than transaction groups
-func ExecConflictFreeTxs(pool *ants.Pool, txs types.Transactions, CacheStates []*state.CacheState, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) []error {
+func ExecConflictFreeTxs(pool *ants.Pool, txs types.Transactions, CacheStates []*state.CacheState, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup) ([]error, []uint64) {
 	wg.Add(len(txs))
 	errs := make([]error, txs.Len())
+	gasUsed := make([]uint64, txs.Len())
 	for i := 0; i < len(txs); i++ {
 		taskNum := i
-		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, CacheStates[taskNum], params.MainnetChainConfig, vm.Config{})
+		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, CacheStates[taskNum], chainCtx.Config(), vm.Config{})
 
 		// Submit tasks to the ants pool
 		err := pool.Submit(func() {
-			errs[taskNum] = executeTx(CacheStates[taskNum], txs[taskNum], header, chainCtx, evm)
+			gasUsed[taskNum], errs[taskNum] = executeTx(CacheStates[taskNum], txs[taskNum], header, chainCtx, evm)
 			wg.Done() // Mark the task as completed
 		})
 		if err != nil {
@@ -187,23 +206,24 @@ func ExecConflictFreeTxs(pool *ants.Pool, txs types.Transactions, CacheStates []
 		}
 	}
 	wg.Wait()
-	return errs
+	return errs, gasUsed
 }
 
 // txs is the whole transactions of a block
 // txsIndex speicifies the index of transactions to be executed
-func ExecWithSnapshotState(pool *ants.Pool, txs types.Transactions, txsIndex []int, snapshots []*state.StateWithRwSets, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup, readReserve, writeReserve *accesslist.ReserveSet) []error {
+func ExecWithSnapshotState(pool *ants.Pool, txs types.Transactions, txsIndex []int, snapshots []*state.StateWithRwSets, header *types.Header, chainCtx core.ChainContext, wg *sync.WaitGroup, readReserve, writeReserve *accesslist.ReserveSet) ([]error, []uint64) {
 	errs := make([]error, len(txsIndex))
+	gasUsed := make([]uint64, len(txsIndex))
 	wg.Add(len(txsIndex))
 	for i := 0; i < len(txsIndex); i++ {
 		taskNum := i
-		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, snapshots[taskNum], params.MainnetChainConfig, vm.Config{})
+		evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, snapshots[taskNum], chainCtx.Config(), vm.Config{})
 		// Submit tasks to the ants pool
 		err := pool.Submit(func() {
 			rwSet := accesslist.NewRWSet()
 			snapshots[taskNum].SetRWSet(rwSet)
 			index := txsIndex[taskNum]
-			errs[taskNum] = executeTx(snapshots[taskNum], txs[index], header, chainCtx, evm)
+			gasUsed[taskNum], errs[taskNum] = executeTx(snapshots[taskNum], txs[index], header, chainCtx, evm)
 			readReserve.Reserve(rwSet.ReadSet, uint(txsIndex[taskNum]))
 			writeReserve.Reserve(rwSet.WriteSet, uint(txsIndex[taskNum]))
 			wg.Done() // Mark the task as completed
@@ -214,5 +234,5 @@ func ExecWithSnapshotState(pool *ants.Pool, txs types.Transactions, txsIndex []i
 		}
 	}
 	wg.Wait()
-	return errs
+	return errs, gasUsed
 }
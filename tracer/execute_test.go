@@ -0,0 +1,410 @@
+package tracer
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"interact/accesslist"
+	"interact/core"
+	"interact/state"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethcore "github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/panjf2000/ants/v2"
+)
+
+func TestChainConfigFromDatabase(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	genesis := common.HexToHash("0x01")
+	rawdb.WriteCanonicalHash(db, genesis, 0)
+	rawdb.WriteChainConfig(db, genesis, params.AllDevChainProtocolChanges)
+	chainCtx := core.NewFakeChainContext(db)
+	if chainCtx.Config().ChainID.Cmp(params.AllDevChainProtocolChanges.ChainID) != 0 {
+		t.Fatalf("chain id %v, want %v", chainCtx.Config().ChainID, params.AllDevChainProtocolChanges.ChainID)
+	}
+
+	// a dev chain tx is only valid with the dev chain config
+	env := newRWTestEnv(t)
+	env.chainCtx = chainCtx
+	env.setCode(rwCodeCases()[0])
+	tx := env.tx(&testContract, common.Big0, nil)
+	if _, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, chainCtx); err != nil {
+		t.Fatal(err)
+	}
+	mainnet := core.NewFakeChainContext(rawdb.NewMemoryDatabase())
+	if _, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, mainnet); err == nil {
+		t.Error("dev chain tx executed with the mainnet config")
+	}
+}
+
+func (env *rwTestEnv) execute(statedb state.StateInterface, tx *types.Transaction) error {
+	_, err := env.gasUsed(statedb, tx)
+	return err
+}
+
+func (env *rwTestEnv) gasUsed(statedb state.StateInterface, tx *types.Transaction) (uint64, error) {
+	evm := vm.NewEVM(core.NewEVMBlockContext(env.header, env.chainCtx, &env.header.Coinbase), vm.TxContext{}, statedb, env.chainCtx.Config(), vm.Config{})
+	return executeTx(statedb, tx, env.header, env.chainCtx, evm)
+}
+
+func TestTransferModes(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	env := newRWTestEnv(t)
+	sender := crypto.PubkeyToAddress(env.key.PublicKey)
+	// the whole balance leaves nothing to buy the gas with
+	tooMuch := env.statedb.GetBalance(sender)
+
+	core.SetTransferMode(core.TransferStrict)
+	statedb := env.statedb.Copy()
+	if err := env.execute(statedb, env.tx(&testNonExistent, common.Big1, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if statedb.GetBalance(testNonExistent).Cmp(common.Big1) != 0 {
+		t.Errorf("strict: recipient balance %v, want 1", statedb.GetBalance(testNonExistent))
+	}
+	if err := env.execute(env.statedb.Copy(), env.tx(&testNonExistent, tooMuch, nil)); !errors.Is(err, core.ErrInsufficientFunds) {
+		t.Errorf("strict: got %v, want %v", err, core.ErrInsufficientFunds)
+	}
+
+	core.SetTransferMode(core.TransferDelta)
+	for _, value := range []*big.Int{common.Big1, tooMuch} {
+		tx := env.tx(&testNonExistent, value, nil)
+		rwSet, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, env.chainCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rwSet.WriteSet.Contains(testNonExistent, accesslist.BALANCEDELTA) {
+			t.Error("delta: missing balance delta of the recipient")
+		}
+		cache := state.NewCacheState()
+		cache.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+		// the balance is only validated at commit time
+		if err := env.execute(cache, tx); err != nil {
+			t.Fatal(err)
+		}
+		merged := env.statedb.Copy()
+		err = cache.MergeState(merged)
+		if value == tooMuch {
+			if !errors.Is(err, state.ErrInsufficientBalanceDelta) {
+				t.Errorf("delta: got %v, want %v", err, state.ErrInsufficientBalanceDelta)
+			}
+			if merged.GetBalance(testNonExistent).Sign() != 0 {
+				t.Error("delta: invalid deltas are merged")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged.GetBalance(testNonExistent).Cmp(common.Big1) != 0 {
+			t.Errorf("delta: recipient balance %v, want 1", merged.GetBalance(testNonExistent))
+		}
+	}
+}
+
+// TestGasPayment checks the balances after a tx against the unmodified state transition of go-ethereum
+func TestGasPayment(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	env := newRWTestEnv(t)
+	sender := crypto.PubkeyToAddress(env.key.PublicKey)
+	for _, tx := range []*types.Transaction{
+		env.tx(&testNonExistent, big.NewInt(params.GWei), nil),
+		env.tx(&testWriter, big.NewInt(params.GWei), nil),
+	} {
+		want := env.statedb.Copy()
+		msg, err := gethcore.TransactionToMessage(tx, types.MakeSigner(env.chainCtx.Config(), env.header.Number, env.header.Time), env.header.BaseFee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evm := vm.NewEVM(gethcore.NewEVMBlockContext(env.header, nil, &env.header.Coinbase), gethcore.NewEVMTxContext(msg), want, env.chainCtx.Config(), vm.Config{})
+		result, err := gethcore.ApplyMessage(evm, msg, new(gethcore.GasPool).AddGas(msg.GasLimit))
+		if err != nil || result.Failed() {
+			t.Fatalf("go-ethereum: %v %v", err, result)
+		}
+
+		for _, mode := range []core.TransferMode{core.TransferStrict, core.TransferDelta} {
+			core.SetTransferMode(mode)
+			got := env.statedb.Copy()
+			if mode == core.TransferStrict {
+				if err := env.execute(got, tx); err != nil {
+					t.Fatal(err)
+				}
+			} else if *tx.To() == testNonExistent {
+				// a cache state keeps the deltas aside until they are merged, it has no access list,
+				// so only the plain transfer is charged the same gas
+				rwSet, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, env.chainCtx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cache := state.NewCacheState()
+				cache.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+				if err := env.execute(cache, tx); err != nil {
+					t.Fatal(err)
+				}
+				if err := cache.MergeState(got); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				continue
+			}
+			for _, addr := range []common.Address{sender, *tx.To(), env.header.Coinbase} {
+				if got.GetBalance(addr).Cmp(want.GetBalance(addr)) != 0 {
+					t.Errorf("%v to %v: balance of %v %v, go-ethereum %v", mode, tx.To(), addr, got.GetBalance(addr), want.GetBalance(addr))
+				}
+			}
+		}
+	}
+}
+
+// TestRefund checks the gas of an SSTORE clearing a slot on the cache states against the StateDB
+func TestRefund(t *testing.T) {
+	env := newRWTestEnv(t)
+	signer := types.MakeSigner(env.chainCtx.Config(), env.header.Number, env.header.Time)
+	slot := common.BigToHash(common.Big1)
+	for _, c := range []struct {
+		name string
+		code string
+	}{
+		{"clear", "0x600060015500"},
+		{"clear reverted", "0x600060015560006000fd"},
+	} {
+		env.statedb.SetCode(testContract, common.FromHex(c.code))
+		env.statedb.SetState(testContract, slot, common.BigToHash(common.Big1))
+		env.statedb.Finalise(true)
+		// the cache states have no access list, the slot is warm on the StateDB too
+		tx := types.MustSignNewTx(env.key, signer, &types.AccessListTx{
+			ChainID:    env.chainCtx.Config().ChainID,
+			Gas:        1000000,
+			GasPrice:   big.NewInt(2 * params.GWei),
+			To:         &testContract,
+			AccessList: types.AccessList{{Address: testContract, StorageKeys: []common.Hash{slot}}},
+		})
+		want, err := env.gasUsed(env.statedb.Copy(), tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rwSet, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, env.chainCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache := state.NewCacheState()
+		cache.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+		fullstate := state.NewFullCacheConcurrent()
+		fullstate.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+		for _, statedb := range []state.StateInterface{cache, state.NewConcurrentTxState(fullstate)} {
+			if got, err := env.gasUsed(statedb, tx); err != nil || got != want {
+				t.Errorf("%s on %T: gas used %d, err %v, StateDB %d", c.name, statedb, got, err, want)
+			}
+		}
+	}
+}
+
+func TestConcurrentTxStateRevert(t *testing.T) {
+	env := newRWTestEnv(t)
+	env.setCode(rwCodeCase{"SSTORE reverted", "0x600260015560006000fd", 0})
+	// the txs run concurrently, so they are sent by different senders
+	key, _ := crypto.GenerateKey()
+	env.statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+	txs := types.Transactions{env.tx(&testWriter, common.Big0, nil), env.txFrom(key, 0, &testContract, common.Big0, nil)}
+	fullstate := state.NewFullCacheConcurrent()
+	for _, tx := range txs {
+		rwSet, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, env.chainCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fullstate.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+	}
+
+	pool, _ := ants.NewPool(2)
+	defer pool.Release()
+	ExecuteWithCCFullState(pool, txs, fullstate, env.header, env.chainCtx, &sync.WaitGroup{})
+	slot := common.BigToHash(common.Big1)
+	if got := fullstate.GetState(testWriter, slot); got != common.BigToHash(common.Big2) {
+		t.Errorf("committed write lost, slot %v", got)
+	}
+	if got := fullstate.GetState(testContract, slot); got != (common.Hash{}) {
+		t.Errorf("reverted write kept, slot %v", got)
+	}
+
+	// a revert keeps the balance changes of the other txs
+	balance := fullstate.GetBalance(testBeneficiary)
+	a, b := state.NewConcurrentTxState(fullstate), state.NewConcurrentTxState(fullstate)
+	a.CreateAccount(testBeneficiary)
+	snapshot := a.Snapshot()
+	a.AddBalance(testBeneficiary, common.Big1)
+	b.AddBalance(testBeneficiary, common.Big2)
+	a.RevertToSnapshot(snapshot)
+	if want := new(big.Int).Add(balance, common.Big2); fullstate.GetBalance(testBeneficiary).Cmp(want) != 0 {
+		t.Errorf("balance %v, want %v", fullstate.GetBalance(testBeneficiary), want)
+	}
+}
+
+func TestNonceCheck(t *testing.T) {
+	env := newRWTestEnv(t)
+	first := env.txFrom(env.key, 0, &testReader, common.Big0, nil)
+	second := env.txFrom(env.key, 1, &testReader, common.Big0, nil)
+
+	statedb := env.statedb.Copy()
+	if err := env.execute(statedb, second); !errors.Is(err, core.ErrNonceTooHigh) {
+		t.Errorf("got %v, want %v", err, core.ErrNonceTooHigh)
+	}
+	for _, tx := range []*types.Transaction{first, second} {
+		if err := env.execute(statedb, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the prediction runs a tx without the earlier txs of the sender
+	if _, err := PredictWithTracer(env.statedb.Copy(), second, env.header, env.chainCtx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExecuteGasUsed(t *testing.T) {
+	env := newRWTestEnv(t)
+	txs := types.Transactions{env.tx(&testNonExistent, common.Big1, nil), env.txFrom(env.key, 1, &testWriter, common.Big0, nil)}
+	errs, gasUsed := ExecuteTxs(env.statedb.Copy(), txs, env.header, env.chainCtx)
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gasUsed[0] != params.TxGas {
+		t.Errorf("transfer used %d gas, want %d", gasUsed[0], params.TxGas)
+	}
+	// SSTORE of a fresh slot
+	if gasUsed[1] <= params.TxGas+params.SstoreSetGasEIP2200 {
+		t.Errorf("SSTORE used %d gas", gasUsed[1])
+	}
+}
+
+func TestMergeWriteSet(t *testing.T) {
+	env := newRWTestEnv(t)
+	tx := env.tx(&testWriter, common.Big0, nil)
+	rwSet, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, env.chainCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := state.NewCacheState()
+	cache.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+	if err := env.execute(cache, tx); err != nil {
+		t.Fatal(err)
+	}
+	// an earlier tx changes what tx neither reads nor writes
+	merged := env.statedb.Copy()
+	merged.AddBalance(testWriter, common.Big2)
+	merged.SetState(testWriter, common.BigToHash(common.Big2), common.BigToHash(common.Big3))
+	if err := cache.MergeWriteSet(merged, rwSet.WriteSet); err != nil {
+		t.Fatal(err)
+	}
+	if merged.GetState(testWriter, common.BigToHash(common.Big1)) != common.BigToHash(common.Big2) {
+		t.Error("the write of tx is not merged")
+	}
+	if merged.GetBalance(testWriter).Cmp(common.Big2) != 0 || merged.GetState(testWriter, common.BigToHash(common.Big2)) != common.BigToHash(common.Big3) {
+		t.Error("a field tx didn't write is overwritten")
+	}
+	sender := crypto.PubkeyToAddress(env.key.PublicKey)
+	if merged.GetNonce(sender) != 1 {
+		t.Errorf("sender nonce %d, want 1", merged.GetNonce(sender))
+	}
+}
+
+func TestRollingFullCache(t *testing.T) {
+	env := newRWTestEnv(t)
+	other, _ := crypto.GenerateKey()
+	env.statedb.AddBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(params.Ether))
+	env.statedb.Finalise(true)
+	blocks := []types.Transactions{
+		{env.tx(&testNonExistent, common.Big1, nil)},
+		{env.txFrom(other, 0, &testNonExistent, common.Big2, nil), env.txFrom(env.key, 1, &testBeneficiary, common.Big3, nil)},
+	}
+
+	serial := env.statedb.Copy()
+	rolling := state.NewFullCacheConcurrent()
+	for _, txs := range blocks {
+		// the next block is prefetched aside from the state the blocks started on, its values may be stale
+		staged := state.NewFullCacheConcurrent()
+		for _, tx := range txs {
+			rwSet, err := PredictWithTracer(serial.Copy(), tx, env.header, env.chainCtx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			staged.Prefetch(env.statedb, []*accesslist.RWSet{rwSet})
+		}
+		rolling.Absorb(staged)
+		errs, _ := ExecuteTxs(state.NewConcurrentTxState(rolling), txs, env.header, env.chainCtx)
+		for _, err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		ExecuteTxs(serial, txs, env.header, env.chainCtx)
+	}
+	if rolling.GetBalance(testNonExistent).Cmp(common.Big3) != 0 {
+		t.Errorf("balance %v, want 3", rolling.GetBalance(testNonExistent))
+	}
+	written := env.statedb.Copy()
+	rolling.WriteTo(written)
+	if got, want := written.IntermediateRoot(true), serial.IntermediateRoot(true); got != want {
+		t.Errorf("root %v, want %v", got, want)
+	}
+}
+
+func TestTransientStorage(t *testing.T) {
+	env := newRWTestEnv(t)
+	// cancun brings TLOAD and TSTORE
+	config := *params.AllDevChainProtocolChanges
+	config.CancunTime = new(uint64)
+	env.chainCtx = core.NewFakeChainContextWithConfig(rawdb.NewMemoryDatabase(), &config)
+	storer, loader := common.HexToAddress("0x6000"), common.HexToAddress("0x6001")
+	// TSTORE(1, 7); SSTORE(2, TLOAD(1))
+	env.statedb.SetCode(storer, common.FromHex("0x600760015d60015c60025500"))
+	// SSTORE(3, TLOAD(1)), the transient storage of the previous tx is gone
+	env.statedb.SetCode(loader, common.FromHex("0x60015c60035500"))
+	env.statedb.SetState(loader, common.BigToHash(common.Big3), common.BigToHash(common.Big3))
+	env.statedb.Finalise(true)
+	txs := types.Transactions{env.txFrom(env.key, 0, &storer, common.Big0, nil), env.txFrom(env.key, 1, &loader, common.Big0, nil)}
+
+	rwSets := make(accesslist.RWSetList, len(txs))
+	predicted := env.statedb.Copy()
+	for i, tx := range txs {
+		rwSet, err := PredictWithTracer(predicted, tx, env.header, env.chainCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rwSets[i] = rwSet
+	}
+	if rwSets[0].ReadSet.Contains(storer, common.BigToHash(common.Big1)) || rwSets[0].WriteSet.Contains(storer, common.BigToHash(common.Big1)) {
+		t.Error("transient slot 1 is in the rw sets")
+	}
+
+	cache := state.NewCacheState()
+	cache.Prefetch(env.statedb, rwSets)
+	fullcache, shared := state.NewFullCacheConcurrent(), state.NewFullCacheConcurrent()
+	fullcache.Prefetch(env.statedb, rwSets)
+	shared.Prefetch(env.statedb, rwSets)
+	for name, statedb := range map[string]state.StateInterface{
+		"CacheState":          cache,
+		"FullCacheConcurrent": fullcache,
+		"ConcurrentTxState":   state.NewConcurrentTxState(shared),
+	} {
+		errs, _ := ExecuteTxs(statedb, txs, env.header, env.chainCtx)
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if got := statedb.GetState(storer, common.BigToHash(common.Big2)); got != common.BigToHash(big.NewInt(7)) {
+			t.Errorf("%s: slot 2 is %v, want 7", name, got)
+		}
+		if got := statedb.GetState(loader, common.BigToHash(common.Big3)); got != (common.Hash{}) {
+			t.Errorf("%s: slot 3 is %v, want 0", name, got)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package tracer
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+// rwAccessListTracer is RW_AccessListsTracer, the legacy EVMLogger tracer, as a named tracer:
+// a geth node importing this package can run debug_traceTransaction with {"tracer": "rwAccessListTracer"}.
+// A tracer on the live tracing hooks of go-ethereum (core/tracing) needs v1.14, it waits for the repo to move off v1.13
+func init() {
+	tracers.DefaultDirectory.Register("rwAccessListTracer", newNamedAccessListsTracer, false)
+}
+
+type namedAccessListsTracer struct {
+	*RW_AccessListsTracer
+}
+
+func newNamedAccessListsTracer(ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	return &namedAccessListsTracer{RW_AccessListsTracer: NewRWAccessListTracer(nil, nil)}, nil
+}
+
+func (t *namedAccessListsTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	// the precompiles are known once the rules of the block are
+	rules := env.ChainConfig().Rules(env.Context.BlockNumber, env.Context.Random != nil, env.Context.Time)
+	for _, addr := range vm.ActivePrecompiles(rules) {
+		t.excl[addr] = struct{}{}
+	}
+	t.RW_AccessListsTracer.CaptureStart(env, from, to, create, input, gas, value)
+}
+
+// GetResult returns the RW set as json
+func (t *namedAccessListsTracer) GetResult() (json.RawMessage, error) {
+	return json.Marshal(t.list)
+}
+
+func (t *namedAccessListsTracer) Stop(err error) {}
@@ -5,10 +5,11 @@ import (
 	"math/big"
 
 	"interact/accesslist"
+	"interact/core"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 var (
@@ -17,12 +18,30 @@ var (
 	BALANCE  = common.Hash(sha256.Sum256([]byte("balance")))
 	NONCE    = common.Hash(sha256.Sum256([]byte("nonce")))
 	ALIVE    = common.Hash(sha256.Sum256([]byte("alive")))
+	// BALANCEDELTA is a value transfer of core.TransferDelta, see accesslist.BALANCEDELTA
+	BALANCEDELTA = common.Hash(sha256.Sum256([]byte("balanceDelta")))
 )
 
 // Tracer mainly records the accesslist of each transaction during vm execution (interpreter.run)
+// It records exactly what StateWithRwSets records on the statedb, so the two predictors agree:
+// message calls and creations are recorded when the frame is entered, as the state is touched
+// only if the call really happens, and opcodes are recorded in CaptureState.
+// LOG doesn't touch the state, Exist and Empty are not recorded by either.
 type RW_AccessListsTracer struct {
 	excl map[common.Address]struct{} // only excludes those stateless precompile contracts
 	list *accesslist.RWSet
+
+	env    *vm.EVM
+	rules  params.Rules
+	from   common.Address
+	frames []rwFrame
+}
+
+// rwFrame is a call frame entered by the EVM
+type rwFrame struct {
+	addr     common.Address
+	create   bool // the code is set on a successful exit
+	readOnly bool // inside a STATICCALL, SSTORE fails without writing
 }
 
 func NewRWAccessListTracer(RWSets *accesslist.RWSet, precompiles []common.Address) *RW_AccessListsTracer {
@@ -32,16 +51,18 @@ func NewRWAccessListTracer(RWSets *accesslist.RWSet, precompiles []common.Addres
 	}
 	rwList := accesslist.NewRWSet()
 	if RWSets != nil {
-		for key := range RWSets.ReadSet {
-			addr := common.BytesToAddress(key[:20])
+		for addr, state := range RWSets.ReadSet {
 			if _, ok := excl[addr]; !ok {
-				rwList.ReadSet.Add(addr, common.BytesToHash(key[20:]))
+				for hash := range state {
+					rwList.ReadSet.Add(addr, hash)
+				}
 			}
 		}
-		for key := range RWSets.WriteSet {
-			addr := common.BytesToAddress(key[:20])
+		for addr, state := range RWSets.WriteSet {
 			if _, ok := excl[addr]; !ok {
-				rwList.WriteSet.Add(addr, common.BytesToHash(key[20:]))
+				for hash := range state {
+					rwList.WriteSet.Add(addr, hash)
+				}
 			}
 		}
 	}
@@ -51,7 +72,120 @@ func NewRWAccessListTracer(RWSets *accesslist.RWSet, precompiles []common.Addres
 	}
 }
 
+func (a *RW_AccessListsTracer) addRead(addr common.Address, hash common.Hash) {
+	if _, ok := a.excl[addr]; !ok {
+		a.list.AddReadSet(addr, hash)
+	}
+}
+
+func (a *RW_AccessListsTracer) addWrite(addr common.Address, hash common.Hash) {
+	if _, ok := a.excl[addr]; !ok {
+		a.list.AddWriteSet(addr, hash)
+	}
+}
+
+// addReadWrite records a read-modify-write, e.g. AddBalance
+func (a *RW_AccessListsTracer) addReadWrite(addr common.Address, hash common.Hash) {
+	a.addRead(addr, hash)
+	a.addWrite(addr, hash)
+}
+
 func (a *RW_AccessListsTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	a.env = env
+	a.rules = env.ChainConfig().Rules(env.Context.BlockNumber, env.Context.Random != nil, env.Context.Time)
+	a.from = from
+	a.frames = a.frames[:0]
+	// the sender nonce is increased by the state transition or by evm.Create
+	a.addReadWrite(from, NONCE)
+	// the gas is bought before the call, the strict balance check reads the sender even for free gas
+	if core.GetTransferMode() == core.TransferStrict {
+		a.addRead(from, BALANCE)
+	}
+	a.payGas(from, env.TxContext.GasPrice)
+	if create {
+		a.enter(vm.CREATE, from, to, value)
+	} else {
+		a.enter(vm.CALL, from, to, value)
+	}
+}
+
+// enter records the state touched by evm.Call, evm.Create and so on before running the code
+func (a *RW_AccessListsTracer) enter(typ vm.OpCode, from common.Address, to common.Address, value *big.Int) {
+	frame := rwFrame{addr: to, readOnly: typ == vm.STATICCALL}
+	if len(a.frames) > 0 && a.frames[len(a.frames)-1].readOnly {
+		frame.readOnly = true
+	}
+	switch typ {
+	case vm.CREATE, vm.CREATE2:
+		frame.create = true
+		a.transfer(from, to, value)
+		a.addReadWrite(from, NONCE)
+		// Read to check if the contract to is already occupied
+		a.addRead(to, CODEHASH)
+		a.addRead(to, NONCE)
+		if a.rules.IsEIP158 {
+			a.addWrite(to, NONCE)
+		}
+	case vm.CALL:
+		a.transfer(from, to, value)
+		// calling a non-existent account without value returns before fetching the code
+		if _, ok := a.excl[to]; !ok && a.env.StateDB.Exist(to) {
+			a.addRead(to, CODE)
+			if a.env.StateDB.GetCodeSize(to) > 0 {
+				a.addRead(to, CODEHASH)
+			}
+		}
+	case vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		if typ == vm.CALLCODE && value.Sign() != 0 && core.GetTransferMode() == core.TransferStrict {
+			// CALLCODE checks the balance without transferring
+			a.addRead(from, BALANCE)
+		}
+		a.addRead(to, CODE)
+		a.addRead(to, CODEHASH)
+	case vm.SELFDESTRUCT:
+		a.addRead(from, BALANCE)
+		a.addWrite(from, BALANCE)
+		a.addWrite(from, ALIVE)
+		if !a.rules.IsLondon {
+			// the refund checks whether the contract has been destructed
+			a.addRead(from, ALIVE)
+		}
+		if value.Sign() != 0 {
+			a.addReadWrite(to, BALANCE)
+			if a.rules.IsCancun {
+				a.addReadWrite(from, BALANCE)
+			}
+		}
+	}
+	a.frames = append(a.frames, frame)
+}
+
+// transfer records the value transfer of a message according to core.GetTransferMode
+func (a *RW_AccessListsTracer) transfer(from, to common.Address, value *big.Int) {
+	if value == nil || value.Sign() == 0 {
+		return
+	}
+	switch core.GetTransferMode() {
+	case core.TransferStrict:
+		a.addReadWrite(from, BALANCE)
+		a.addReadWrite(to, BALANCE)
+	case core.TransferDelta:
+		a.addWrite(from, BALANCEDELTA)
+		a.addWrite(to, BALANCEDELTA)
+	}
+}
+
+// exit records the code of a successful creation
+func (a *RW_AccessListsTracer) exit(err error) {
+	if len(a.frames) == 0 {
+		return
+	}
+	frame := a.frames[len(a.frames)-1]
+	a.frames = a.frames[:len(a.frames)-1]
+	if frame.create && err == nil {
+		a.addWrite(frame.addr, CODE)
+		a.addWrite(frame.addr, CODEHASH)
+	}
 }
 
 // CaptureState captures all opcodes that touch storage or addresses and adds them to the accesslist.
@@ -64,40 +198,34 @@ func (a *RW_AccessListsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost u
 		{
 			if stackLen >= 1 {
 				slot := common.Hash(stackData[stackLen-1].Bytes32())
-				a.list.AddReadSet(scope.Contract.Address(), slot)
+				a.addRead(scope.Contract.Address(), slot)
 			}
 		}
 	case vm.SSTORE:
 		{
 			if stackLen >= 1 {
 				slot := common.Hash(stackData[stackLen-1].Bytes32())
-				a.list.AddWriteSet(scope.Contract.Address(), slot)
-			}
-		}
-	case vm.EXTCODECOPY: // read code
-		{
-			if stackLen >= 1 {
-				addr := common.Address(stackData[stackLen-1].Bytes20())
-				if _, ok := a.excl[addr]; !ok {
-					a.list.AddReadSet(addr, CODE)
+				// the gas of SSTORE depends on the current value
+				a.addRead(scope.Contract.Address(), slot)
+				if len(a.frames) == 0 || !a.frames[len(a.frames)-1].readOnly {
+					a.addWrite(scope.Contract.Address(), slot)
 				}
 			}
 		}
-	case vm.EXTCODEHASH:
+	case vm.EXTCODECOPY, vm.EXTCODESIZE: // read code
 		{
 			if stackLen >= 1 {
 				addr := common.Address(stackData[stackLen-1].Bytes20())
-				if _, ok := a.excl[addr]; !ok {
-					a.list.AddReadSet(addr, CODEHASH)
-				}
+				a.addRead(addr, CODE)
 			}
 		}
-	case vm.EXTCODESIZE:
+	case vm.EXTCODEHASH:
 		{
 			if stackLen >= 1 {
 				addr := common.Address(stackData[stackLen-1].Bytes20())
-				if _, ok := a.excl[addr]; !ok {
-					a.list.AddReadSet(addr, CODE)
+				// the code hash of an empty account is not read
+				if !a.env.StateDB.Empty(addr) {
+					a.addRead(addr, CODEHASH)
 				}
 			}
 		}
@@ -105,86 +233,12 @@ func (a *RW_AccessListsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost u
 		{
 			if stackLen >= 1 {
 				addr := common.Address(stackData[stackLen-1].Bytes20())
-				if _, ok := a.excl[addr]; !ok {
-					a.list.AddReadSet(addr, BALANCE)
-				}
+				a.addRead(addr, BALANCE)
 			}
 		}
-	case vm.SELFDESTRUCT:
+	case vm.SELFBALANCE:
 		{
-			if stackLen >= 1 {
-				beneficiary := common.Address(stackData[stackLen-1].Bytes20())
-				if _, ok := a.excl[beneficiary]; !ok {
-					a.list.AddReadSet(beneficiary, BALANCE)
-					a.list.AddWriteSet(beneficiary, BALANCE)
-				}
-				addr := scope.Contract.Address()
-				if _, ok := a.excl[addr]; !ok {
-					a.list.AddWriteSet(addr, BALANCE)
-					a.list.AddWriteSet(addr, ALIVE)
-				}
-			}
-		}
-	case vm.CALL:
-		{
-			if stackLen >= 5 {
-				from := scope.Contract.Address()
-				to := common.Address(stackData[stackLen-2].Bytes20())
-				value := stackData[stackLen-3].ToBig()
-				if _, ok := a.excl[from]; !ok {
-					a.list.AddReadSet(from, BALANCE)
-					a.list.AddWriteSet(from, BALANCE)
-					a.list.AddReadSet(from, NONCE)
-					a.list.AddWriteSet(from, NONCE)
-				}
-				if _, ok := a.excl[to]; !ok {
-					a.list.AddReadSet(to, CODE)
-					a.list.AddReadSet(to, CODEHASH)
-					// if value == 0, we could determine thta to-balance won't be touched
-					if value.Cmp(common.Big0) != 0 {
-						a.list.AddReadSet(to, BALANCE)
-						a.list.AddWriteSet(to, BALANCE)
-					}
-				}
-			}
-		}
-	case vm.STATICCALL, vm.DELEGATECALL, vm.CALLCODE:
-		{
-			if stackLen >= 5 {
-				to := common.Address(stackData[stackLen-2].Bytes20())
-				if _, ok := a.excl[to]; !ok {
-					a.list.AddReadSet(to, CODE)
-					a.list.AddReadSet(to, CODEHASH)
-				}
-			}
-		}
-	case vm.CREATE2: // cannot apply to CREATE, because the addr is dependent on the nonce
-		{
-			if stackLen >= 4 {
-				from := scope.Contract.Address()
-				if _, ok := a.excl[from]; !ok {
-					a.list.AddReadSet(from, BALANCE)
-					a.list.AddWriteSet(from, BALANCE)
-					a.list.AddReadSet(from, NONCE)
-					a.list.AddWriteSet(from, NONCE)
-				}
-
-				offset, size := stackData[stackLen-2].Uint64(), stackData[stackLen-3].Uint64()
-				salt := stackData[stackLen-4].Bytes32()
-				input := scope.Memory.GetCopy(int64(offset), int64(size))
-				codeHash := crypto.Keccak256Hash(input)
-				addr := crypto.CreateAddress2(scope.Contract.Address(), salt, codeHash.Bytes())
-				if _, ok := a.excl[addr]; !ok {
-					a.list.AddWriteSet(addr, BALANCE)
-					a.list.AddWriteSet(addr, CODEHASH)
-					a.list.AddWriteSet(addr, CODE)
-					a.list.AddWriteSet(addr, NONCE)
-					a.list.AddWriteSet(addr, ALIVE)
-					// Read to check if the contract addr is already occupied
-					a.list.AddReadSet(addr, NONCE)
-					a.list.AddReadSet(addr, CODEHASH)
-				}
-			}
+			a.addRead(scope.Contract.Address(), BALANCE)
 		}
 	}
 }
@@ -192,16 +246,44 @@ func (a *RW_AccessListsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost u
 func (*RW_AccessListsTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
 }
 
-func (*RW_AccessListsTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+func (a *RW_AccessListsTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	a.exit(err)
+}
 
-func (*RW_AccessListsTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+func (a *RW_AccessListsTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	a.enter(typ, from, to, value)
 }
 
-func (*RW_AccessListsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (a *RW_AccessListsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	a.exit(err)
+}
 
 func (*RW_AccessListsTracer) CaptureTxStart(gasLimit uint64) {}
 
-func (*RW_AccessListsTracer) CaptureTxEnd(restGas uint64) {}
+func (a *RW_AccessListsTracer) CaptureTxEnd(restGas uint64) {
+	// the remaining gas is refunded to the sender, who has paid for it already, and the tip goes to the coinbase
+	if a.env == nil {
+		return
+	}
+	tip := a.env.TxContext.GasPrice
+	if a.rules.IsLondon {
+		tip = new(big.Int).Sub(tip, a.env.Context.BaseFee)
+	}
+	a.payGas(a.env.Context.Coinbase, tip)
+}
+
+// payGas records a gas payment at price to or from addr according to core.GetTransferMode
+func (a *RW_AccessListsTracer) payGas(addr common.Address, price *big.Int) {
+	if price == nil || price.Sign() == 0 {
+		return
+	}
+	switch core.GetTransferMode() {
+	case core.TransferStrict:
+		a.addReadWrite(addr, BALANCE)
+	case core.TransferDelta:
+		a.addWrite(addr, BALANCEDELTA)
+	}
+}
 
 // AccessList returns the current accesslist maintained by the tracer.
 func (a *RW_AccessListsTracer) RWAccessList() *accesslist.RWSet {
@@ -0,0 +1,213 @@
+package tracer
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"interact/accesslist"
+	"interact/core"
+	"interact/state"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testReader      = common.HexToAddress("0x1001") // SLOAD(1)
+	testWriter      = common.HexToAddress("0x1002") // SSTORE(1, 2)
+	testContract    = common.HexToAddress("0x2000")
+	testBeneficiary = common.HexToAddress("0x3000")
+	testNonExistent = common.HexToAddress("0x4000")
+	testIdentity    = common.HexToAddress("0x04")
+)
+
+type rwTestEnv struct {
+	key      *ecdsa.PrivateKey
+	statedb  *ethState.StateDB
+	header   *types.Header
+	chainCtx core.ChainContext
+}
+
+// newRWTestEnv returns an in-memory state on a shanghai mainnet block
+func newRWTestEnv(t *testing.T) *rwTestEnv {
+	key, _ := crypto.GenerateKey()
+	statedb, err := ethState.New(types.EmptyRootHash, ethState.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(100)))
+	statedb.SetCode(testReader, common.FromHex("0x6001545000"))
+	statedb.SetCode(testWriter, common.FromHex("0x600260015500"))
+	statedb.SetState(testReader, common.BigToHash(common.Big1), common.BigToHash(common.Big1))
+	statedb.Finalise(true)
+
+	header := &types.Header{
+		Number:     big.NewInt(18000000),
+		Time:       1690000000,
+		Difficulty: common.Big0,
+		BaseFee:    big.NewInt(params.GWei),
+		GasLimit:   30000000,
+		Coinbase:   common.HexToAddress("0xc0ffee"),
+	}
+	return &rwTestEnv{
+		key:      key,
+		statedb:  statedb,
+		header:   header,
+		chainCtx: core.NewFakeChainContext(rawdb.NewMemoryDatabase()),
+	}
+}
+
+func (env *rwTestEnv) tx(to *common.Address, value *big.Int, data []byte) *types.Transaction {
+	return env.txFrom(env.key, 0, to, value, data)
+}
+
+func (env *rwTestEnv) txFrom(key *ecdsa.PrivateKey, nonce uint64, to *common.Address, value *big.Int, data []byte) *types.Transaction {
+	legacy := &types.LegacyTx{
+		Nonce:    nonce,
+		Gas:      1000000,
+		GasPrice: big.NewInt(2 * params.GWei),
+		To:       to,
+		Value:    value,
+		Data:     data,
+	}
+	tx, _ := types.SignTx(types.NewTx(legacy), types.LatestSigner(env.chainCtx.Config()), key)
+	return tx
+}
+
+// push20 returns the bytecode pushing addr onto the stack
+func push20(addr common.Address) string {
+	return "73" + common.Bytes2Hex(addr.Bytes())
+}
+
+type rwCodeCase struct {
+	name    string
+	code    string
+	balance int64
+}
+
+// rwCodeCases are the contracts at testContract called by the tests, one per opcode path
+func rwCodeCases() []rwCodeCase {
+	// CALL family: retSize retOffset argSize argOffset [value] addr gas
+	call := func(op string, to common.Address) string {
+		value := "6000"
+		if op == "f4" || op == "fa" {
+			value = ""
+		}
+		return "0x6000600060006000" + value + push20(to) + "5a" + op + "5000"
+	}
+	callWithValue := func(op string, to common.Address) string {
+		return "0x60006000600060006001" + push20(to) + "5a" + op + "5000"
+	}
+	return []rwCodeCase{
+		{"SLOAD", "0x6001545000", 0},
+		{"SSTORE", "0x600260015500", 0},
+		{"SSTORE reverted", "0x600260015560006000fd", 0},
+		{"BALANCE", "0x" + push20(testReader) + "315000", 0},
+		{"BALANCE of precompile", "0x" + push20(testIdentity) + "315000", 0},
+		{"SELFBALANCE", "0x475000", 0},
+		{"EXTCODESIZE", "0x" + push20(testReader) + "3b5000", 0},
+		{"EXTCODECOPY", "0x600060006000" + push20(testReader) + "3c00", 0},
+		{"EXTCODEHASH", "0x" + push20(testReader) + "3f5000", 0},
+		{"EXTCODEHASH of empty account", "0x" + push20(testNonExistent) + "3f5000", 0},
+		{"CALL", call("f1", testReader), 0},
+		{"CALL to non-existent account", call("f1", testNonExistent), 0},
+		{"CALL to precompile", call("f1", testIdentity), 0},
+		{"CALLCODE", call("f2", testWriter), 0},
+		{"DELEGATECALL", call("f4", testWriter), 0},
+		{"STATICCALL to SSTORE", call("fa", testWriter), 0},
+		{"CREATE", "0x600060006000f05000", 0},
+		{"CREATE2", "0x6000600060006000f55000", 0},
+		{"SELFDESTRUCT", "0x" + push20(testBeneficiary) + "ff", params.Ether},
+		{"LOG0", "0x60006000a000", 0},
+		{"CALL with value", callWithValue("f1", testReader), params.Ether},
+		{"CALL with value to non-existent account", callWithValue("f1", testNonExistent), params.Ether},
+		{"CALLCODE with value", callWithValue("f2", testWriter), params.Ether},
+		{"CREATE with value", "0x600060006001f05000", params.Ether},
+	}
+}
+
+// setCode deploys the code of c at testContract
+func (env *rwTestEnv) setCode(c rwCodeCase) {
+	env.statedb.SetCode(testContract, common.FromHex(c.code))
+	env.statedb.AddBalance(testContract, big.NewInt(c.balance))
+	env.statedb.Finalise(true)
+}
+
+func TestTracerAgreesWithStateWithRwSets(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	for _, mode := range []core.TransferMode{core.TransferDisabled, core.TransferStrict, core.TransferDelta} {
+		core.SetTransferMode(mode)
+		testPredictorAgreesWithStateWithRwSets(t, mode.String(), PredictWithTracer)
+	}
+}
+
+func testPredictorAgreesWithStateWithRwSets(t *testing.T, prefix string, predict predictFunc) {
+	for _, c := range rwCodeCases() {
+		env := newRWTestEnv(t)
+		env.setCode(c)
+		compareRWSets(t, prefix+" "+c.name, predict, env, env.tx(&testContract, common.Big0, nil))
+	}
+
+	env := newRWTestEnv(t)
+	compareRWSets(t, prefix+" transfer to new account", predict, env, env.tx(&testNonExistent, common.Big1, nil))
+	compareRWSets(t, prefix+" transfer to contract", predict, env, env.tx(&testReader, common.Big1, nil))
+	compareRWSets(t, prefix+" contract creation", predict, env, env.tx(nil, common.Big1, common.FromHex("0x00")))
+}
+
+type predictFunc func(statedb state.StateInterface, tx *types.Transaction, header *types.Header, chainCtx core.ChainContext) (*accesslist.RWSet, error)
+
+func compareRWSets(t *testing.T, name string, predict predictFunc, env *rwTestEnv, tx *types.Transaction) {
+	traced, err := predict(env.statedb.Copy(), tx, env.header, env.chainCtx)
+	if err != nil {
+		t.Fatalf("%s: tracer: %v", name, err)
+	}
+	recorded, err := ExecToGenerateRWSet(state.NewStateWithRwSets(env.statedb.Copy()), tx, env.header, env.chainCtx)
+	if err != nil {
+		t.Fatalf("%s: state: %v", name, err)
+	}
+	if !traced.Equal(*recorded) {
+		tracedJSON, _ := json.Marshal(traced)
+		recordedJSON, _ := json.Marshal(recorded)
+		t.Errorf("%s: tracer and state disagree\ntracer: %s\nstate:  %s", name, tracedJSON, recordedJSON)
+	}
+}
+
+// TestNamedTracer checks that the named tracer is RW_AccessListsTracer
+func TestNamedTracer(t *testing.T) {
+	env := newRWTestEnv(t)
+	env.setCode(rwCodeCases()[0])
+	tx := env.tx(&testContract, common.Big0, nil)
+
+	named, err := tracers.DefaultDirectory.New("rwAccessListTracer", new(tracers.Context), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb := env.statedb.Copy()
+	evm := vm.NewEVM(core.NewEVMBlockContext(env.header, env.chainCtx, &env.header.Coinbase), vm.TxContext{}, statedb, env.chainCtx.Config(), vm.Config{Tracer: named})
+	if _, err := executeTx(statedb, tx, env.header, env.chainCtx, evm); err != nil {
+		t.Fatal(err)
+	}
+	result, err := named.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := accesslist.NewRWSet()
+	if err := json.Unmarshal(result, got); err != nil {
+		t.Fatal(err)
+	}
+	want, err := PredictWithTracer(env.statedb.Copy(), tx, env.header, env.chainCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(*want) {
+		t.Errorf("named tracer result %s", result)
+	}
+}
@@ -0,0 +1,892 @@
+package tracer
+
+import (
+	"interact/accesslist"
+	"interact/core"
+	"interact/state"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+const (
+	staticMaxSteps     = 200000  // total steps of all paths of one tx
+	staticMaxVisits    = 16      // times a path may pass the same pc, bounding the loops
+	staticMaxCallDepth = 4       // depth of the callees we follow
+	staticMaxMemory    = 1 << 20 // memory beyond this is treated as unknown
+)
+
+// StaticAnalyzer predicts the rw sets of a transaction by symbolically executing the bytecode
+// instead of running the EVM. A stack value is either concrete or unknown (nil), and calldata,
+// caller, callvalue and contract address are resolved from the tx itself, so that the keys
+// derived from calldata and keccak mapping patterns, e.g. keccak(caller . slot), are computed.
+// Both branches of an unknown JUMPI are followed, so the result over-approximates the accesses.
+// The result is confident only if every path is fully explored and every key is concrete.
+type StaticAnalyzer struct {
+	statedb   state.StateInterface
+	header    *types.Header
+	origin    common.Address
+	excl      map[common.Address]struct{}
+	list      *accesslist.RWSet
+	steps     int
+	confident bool
+}
+
+// staticFrame is the environment of a contract being analyzed
+type staticFrame struct {
+	address  common.Address // storage owner
+	caller   common.Address
+	value    *uint256.Int
+	code     []byte
+	input    []byte
+	jumpDest map[uint64]struct{}
+	depth    int
+}
+
+// staticPath is a single symbolic execution path in a frame
+type staticPath struct {
+	pc     uint64
+	stack  []*uint256.Int
+	memory *staticMemory
+	visits map[uint64]int
+}
+
+// staticMemory is a byte addressed memory recording which bytes are known
+type staticMemory struct {
+	data      []byte
+	known     []bool
+	forgotten bool // written at an unknown offset, so even the fresh memory is unknown
+}
+
+func NewStaticAnalyzer(statedb state.StateInterface, header *types.Header, precompiles []common.Address) *StaticAnalyzer {
+	excl := make(map[common.Address]struct{})
+	for _, addr := range precompiles {
+		excl[addr] = struct{}{}
+	}
+	return &StaticAnalyzer{
+		statedb:   statedb,
+		header:    header,
+		excl:      excl,
+		list:      accesslist.NewRWSet(),
+		confident: true,
+	}
+}
+
+// PredictWithStaticAnalysis predicts the rw sets of tx with static analysis on the contract bytecode,
+// the bool reports whether the rw sets are believed to be complete
+func PredictWithStaticAnalysis(statedb state.StateInterface, tx *types.Transaction, header *types.Header, config *params.ChainConfig) (*accesslist.RWSet, bool, error) {
+	from, err := types.Sender(types.MakeSigner(config, header.Number, header.Time), tx)
+	if err != nil {
+		return nil, false, err
+	}
+	isPostMerge := header.Difficulty.Cmp(common.Big0) == 0
+	precompiles := vm.ActivePrecompiles(config.Rules(header.Number, isPostMerge, header.Time))
+	analyzer := NewStaticAnalyzer(statedb, header, precompiles)
+	analyzer.origin = from
+
+	// the gas is bought from the sender and the tip goes to the coinbase
+	analyzer.payGas(from)
+	if core.GetTransferMode() == core.TransferStrict {
+		analyzer.list.AddReadSet(from, BALANCE)
+	}
+	if tip, err := tx.EffectiveGasTip(header.BaseFee); err == nil && tip.Sign() > 0 {
+		analyzer.payGas(header.Coinbase)
+	}
+	analyzer.list.AddReadSet(from, NONCE)
+	analyzer.list.AddWriteSet(from, NONCE)
+
+	value, _ := uint256.FromBig(tx.Value())
+	if tx.To() == nil {
+		to := crypto.CreateAddress(from, tx.Nonce())
+		if !value.IsZero() {
+			analyzer.transfer(from, to)
+		}
+		analyzer.list.AddReadSet(to, CODEHASH)
+		analyzer.list.AddReadSet(to, NONCE)
+		analyzer.list.AddWriteSet(to, NONCE)
+		analyzer.list.AddWriteSet(to, CODE)
+		analyzer.list.AddWriteSet(to, CODEHASH)
+		analyzer.analyze(to, from, value, tx.Data(), nil, 0)
+	} else {
+		if !value.IsZero() && !analyzer.isExcluded(*tx.To()) {
+			analyzer.transfer(from, *tx.To())
+		}
+		analyzer.enter(*tx.To(), from, value, tx.Data(), 0)
+	}
+	return analyzer.list, analyzer.confident, nil
+}
+
+// RWSet returns the rw sets collected so far
+func (s *StaticAnalyzer) RWSet() *accesslist.RWSet {
+	return s.list
+}
+
+// Confident reports whether the rw sets are believed to be complete
+func (s *StaticAnalyzer) Confident() bool {
+	return s.confident
+}
+
+// enter analyzes a message call to addr, whose code is fetched from the statedb
+func (s *StaticAnalyzer) enter(addr, caller common.Address, value *uint256.Int, input []byte, depth int) {
+	if _, ok := s.excl[addr]; ok {
+		return
+	}
+	s.list.AddReadSet(addr, CODE)
+	code := s.statedb.GetCode(addr)
+	if len(code) == 0 {
+		return
+	}
+	s.list.AddReadSet(addr, CODEHASH)
+	s.analyze(addr, caller, value, code, input, depth)
+}
+
+func (s *StaticAnalyzer) analyze(addr, caller common.Address, value *uint256.Int, code, input []byte, depth int) {
+	frame := &staticFrame{
+		address:  addr,
+		caller:   caller,
+		value:    value,
+		code:     code,
+		input:    input,
+		jumpDest: validJumpDest(code),
+		depth:    depth,
+	}
+	paths := []*staticPath{{
+		stack:  make([]*uint256.Int, 0),
+		memory: &staticMemory{},
+		visits: make(map[uint64]int),
+	}}
+	for len(paths) > 0 {
+		path := paths[len(paths)-1]
+		paths = paths[:len(paths)-1]
+		paths = append(paths, s.run(frame, path)...)
+	}
+}
+
+// run executes a path until it ends or forks, the forked paths are returned
+func (s *StaticAnalyzer) run(frame *staticFrame, path *staticPath) []*staticPath {
+	for path.pc < uint64(len(frame.code)) {
+		s.steps++
+		if s.steps > staticMaxSteps {
+			s.confident = false
+			return nil
+		}
+		op := vm.OpCode(frame.code[path.pc])
+
+		switch {
+		case op >= vm.PUSH1 && op <= vm.PUSH32:
+			size := uint64(op - vm.PUSH1 + 1)
+			start := path.pc + 1
+			data := make([]byte, size)
+			if start < uint64(len(frame.code)) {
+				copy(data, frame.code[start:])
+			}
+			path.push(new(uint256.Int).SetBytes(data))
+			path.pc += size + 1
+			continue
+		case op >= vm.DUP1 && op <= vm.DUP16:
+			n := int(op - vm.DUP1 + 1)
+			if len(path.stack) < n {
+				return nil
+			}
+			path.push(path.stack[len(path.stack)-n])
+			path.pc++
+			continue
+		case op >= vm.SWAP1 && op <= vm.SWAP16:
+			n := int(op - vm.SWAP1 + 1)
+			if len(path.stack) < n+1 {
+				return nil
+			}
+			top := len(path.stack) - 1
+			path.stack[top], path.stack[top-n] = path.stack[top-n], path.stack[top]
+			path.pc++
+			continue
+		case op >= vm.LOG0 && op <= vm.LOG4:
+			if !path.pop(2 + int(op-vm.LOG0)) {
+				return nil
+			}
+			path.pc++
+			continue
+		}
+
+		switch op {
+		case vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID:
+			return nil
+
+		case vm.JUMP:
+			dest, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			if !s.jumpTo(frame, path, dest) {
+				return nil
+			}
+			continue
+
+		case vm.JUMPI:
+			args, ok := path.popN(2)
+			if !ok {
+				return nil
+			}
+			dest, cond := args[0], args[1]
+			if cond != nil {
+				if cond.IsZero() {
+					path.pc++
+					continue
+				}
+				if !s.jumpTo(frame, path, dest) {
+					return nil
+				}
+				continue
+			}
+			// unknown condition, follow both branches
+			fallthroughPath := path.copy()
+			fallthroughPath.pc++
+			if !s.jumpTo(frame, path, dest) {
+				return []*staticPath{fallthroughPath}
+			}
+			return []*staticPath{path, fallthroughPath}
+
+		case vm.JUMPDEST:
+			path.visits[path.pc]++
+			if path.visits[path.pc] > staticMaxVisits {
+				s.confident = false
+				return nil
+			}
+
+		case vm.SLOAD:
+			key, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			if key == nil {
+				s.confident = false
+			} else {
+				s.list.AddReadSet(frame.address, common.Hash(key.Bytes32()))
+			}
+			path.push(nil)
+
+		case vm.SSTORE:
+			args, ok := path.popN(2)
+			if !ok {
+				return nil
+			}
+			if args[0] == nil {
+				s.confident = false
+			} else {
+				slot := common.Hash(args[0].Bytes32())
+				s.list.AddReadSet(frame.address, slot)
+				s.list.AddWriteSet(frame.address, slot)
+			}
+
+		case vm.TLOAD:
+			if !path.pop(1) {
+				return nil
+			}
+			path.push(nil)
+
+		case vm.TSTORE:
+			if !path.pop(2) {
+				return nil
+			}
+
+		case vm.ADDRESS:
+			path.push(new(uint256.Int).SetBytes(frame.address.Bytes()))
+		case vm.CALLER:
+			path.push(new(uint256.Int).SetBytes(frame.caller.Bytes()))
+		case vm.ORIGIN:
+			path.push(new(uint256.Int).SetBytes(s.origin.Bytes()))
+		case vm.CALLVALUE:
+			path.push(frame.value)
+		case vm.CALLDATASIZE:
+			path.push(new(uint256.Int).SetUint64(uint64(len(frame.input))))
+		case vm.CODESIZE:
+			path.push(new(uint256.Int).SetUint64(uint64(len(frame.code))))
+		case vm.NUMBER:
+			path.push(uint256.MustFromBig(s.header.Number))
+		case vm.TIMESTAMP:
+			path.push(new(uint256.Int).SetUint64(s.header.Time))
+		case vm.PC:
+			path.push(new(uint256.Int).SetUint64(path.pc))
+
+		case vm.CALLDATALOAD:
+			offset, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			if offset == nil {
+				path.push(nil)
+			} else {
+				path.push(new(uint256.Int).SetBytes(getData(frame.input, offset, 32)))
+			}
+
+		case vm.CALLDATACOPY, vm.CODECOPY:
+			args, ok := path.popN(3)
+			if !ok {
+				return nil
+			}
+			src := frame.input
+			if op == vm.CODECOPY {
+				src = frame.code
+			}
+			memOffset, dataOffset, size := args[0], args[1], args[2]
+			if _, _, ok := path.memory.bounds(memOffset, size); !ok {
+				// an unknown region or one past the memory a tx can pay for, the size is never allocated
+				path.memory.forget()
+			} else if dataOffset == nil {
+				path.memory.setUnknown(memOffset, size)
+			} else {
+				path.memory.set(memOffset, getData(src, dataOffset, size.Uint64()))
+			}
+
+		case vm.RETURNDATACOPY, vm.EXTCODECOPY, vm.MCOPY:
+			n := 3
+			if op == vm.EXTCODECOPY {
+				n = 4
+			}
+			args, ok := path.popN(n)
+			if !ok {
+				return nil
+			}
+			if op == vm.EXTCODECOPY {
+				s.addAccountRead(args[0], CODE)
+				args = args[1:]
+			}
+			if op == vm.MCOPY && args[0] != nil && args[1] != nil && args[2] != nil {
+				path.memory.copyWithin(args[0], args[1], args[2])
+			} else if args[0] == nil || args[len(args)-1] == nil {
+				path.memory.forget()
+			} else {
+				path.memory.setUnknown(args[0], args[len(args)-1])
+			}
+
+		case vm.MLOAD:
+			offset, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			path.push(path.memory.load(offset))
+
+		case vm.MSTORE, vm.MSTORE8:
+			args, ok := path.popN(2)
+			if !ok {
+				return nil
+			}
+			offset, value := args[0], args[1]
+			size := uint64(32)
+			if op == vm.MSTORE8 {
+				size = 1
+			}
+			if offset == nil {
+				path.memory.forget()
+			} else if value == nil {
+				path.memory.setUnknown(offset, new(uint256.Int).SetUint64(size))
+			} else if op == vm.MSTORE8 {
+				path.memory.set(offset, []byte{byte(value.Uint64())})
+			} else {
+				b := value.Bytes32()
+				path.memory.set(offset, b[:])
+			}
+
+		case vm.KECCAK256:
+			args, ok := path.popN(2)
+			if !ok {
+				return nil
+			}
+			data, known := path.memory.get(args[0], args[1])
+			if !known {
+				path.push(nil)
+			} else {
+				path.push(new(uint256.Int).SetBytes(crypto.Keccak256(data)))
+			}
+
+		case vm.BALANCE:
+			addr, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			s.addAccountRead(addr, BALANCE)
+			path.push(nil)
+		case vm.SELFBALANCE:
+			s.list.AddReadSet(frame.address, BALANCE)
+			path.push(nil)
+		case vm.EXTCODESIZE:
+			addr, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			s.addAccountRead(addr, CODE)
+			path.push(nil)
+		case vm.EXTCODEHASH:
+			addr, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			s.addAccountRead(addr, CODEHASH)
+			path.push(nil)
+
+		case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+			n := 6
+			if op == vm.CALL || op == vm.CALLCODE {
+				n = 7
+			}
+			args, ok := path.popN(n)
+			if !ok {
+				return nil
+			}
+			addr, value := args[1], new(uint256.Int)
+			if n == 7 {
+				value = args[2]
+			}
+			inOffset, inSize := args[n-4], args[n-3]
+			s.call(op, frame, path, addr, value, inOffset, inSize)
+			// the return data and the success flag are unknown
+			path.memory.setUnknownIfKnown(args[n-2], args[n-1])
+			path.push(nil)
+
+		case vm.CREATE, vm.CREATE2:
+			n := 3
+			if op == vm.CREATE2 {
+				n = 4
+			}
+			if !path.pop(n) {
+				return nil
+			}
+			// the init code is not analyzed
+			s.list.AddReadSet(frame.address, NONCE)
+			s.list.AddWriteSet(frame.address, NONCE)
+			s.confident = false
+			path.push(nil)
+
+		case vm.SELFDESTRUCT:
+			beneficiary, ok := path.pop1()
+			if !ok {
+				return nil
+			}
+			s.list.AddReadSet(frame.address, BALANCE)
+			s.list.AddWriteSet(frame.address, BALANCE)
+			s.list.AddWriteSet(frame.address, ALIVE)
+			if beneficiary == nil {
+				s.confident = false
+			} else if addr := common.Address(beneficiary.Bytes20()); !s.isExcluded(addr) {
+				s.list.AddReadSet(addr, BALANCE)
+				s.list.AddWriteSet(addr, BALANCE)
+			}
+			return nil
+
+		default:
+			if !s.generic(op, path) {
+				return nil
+			}
+		}
+		path.pc++
+	}
+	return nil
+}
+
+// transfer records a value transfer according to core.GetTransferMode
+func (s *StaticAnalyzer) transfer(from, to common.Address) {
+	switch core.GetTransferMode() {
+	case core.TransferStrict:
+		s.list.AddReadSet(from, BALANCE)
+		s.list.AddWriteSet(from, BALANCE)
+		s.list.AddReadSet(to, BALANCE)
+		s.list.AddWriteSet(to, BALANCE)
+	case core.TransferDelta:
+		s.list.AddWriteSet(from, BALANCEDELTA)
+		s.list.AddWriteSet(to, BALANCEDELTA)
+	}
+}
+
+// payGas records a gas payment to or from addr according to core.GetTransferMode
+func (s *StaticAnalyzer) payGas(addr common.Address) {
+	switch core.GetTransferMode() {
+	case core.TransferStrict:
+		s.list.AddReadSet(addr, BALANCE)
+		s.list.AddWriteSet(addr, BALANCE)
+	case core.TransferDelta:
+		s.list.AddWriteSet(addr, BALANCEDELTA)
+	}
+}
+
+// call follows a message call if the callee and its input are known
+func (s *StaticAnalyzer) call(op vm.OpCode, frame *staticFrame, path *staticPath, addr, value, inOffset, inSize *uint256.Int) {
+	if addr == nil {
+		s.confident = false
+		return
+	}
+	to := common.Address(addr.Bytes20())
+	if s.isExcluded(to) {
+		return
+	}
+	if op == vm.CALL && (value == nil || !value.IsZero()) {
+		s.transfer(frame.address, to)
+	}
+	if op == vm.CALLCODE && (value == nil || !value.IsZero()) && core.GetTransferMode() == core.TransferStrict {
+		// CALLCODE checks the balance without transferring
+		s.list.AddReadSet(frame.address, BALANCE)
+	}
+	input, known := path.memory.get(inOffset, inSize)
+	if !known || frame.depth+1 > staticMaxCallDepth {
+		s.list.AddReadSet(to, CODE)
+		s.list.AddReadSet(to, CODEHASH)
+		s.confident = false
+		return
+	}
+	switch op {
+	case vm.CALL, vm.STATICCALL:
+		s.enter(to, frame.address, value, input, frame.depth+1)
+	case vm.CALLCODE:
+		s.list.AddReadSet(to, CODE)
+		if code := s.statedb.GetCode(to); len(code) > 0 {
+			s.list.AddReadSet(to, CODEHASH)
+			s.analyze(frame.address, frame.address, value, code, input, frame.depth+1)
+		}
+	case vm.DELEGATECALL:
+		s.list.AddReadSet(to, CODE)
+		if code := s.statedb.GetCode(to); len(code) > 0 {
+			s.list.AddReadSet(to, CODEHASH)
+			s.analyze(frame.address, frame.caller, frame.value, code, input, frame.depth+1)
+		}
+	}
+}
+
+func (s *StaticAnalyzer) jumpTo(frame *staticFrame, path *staticPath, dest *uint256.Int) bool {
+	if dest == nil {
+		s.confident = false
+		return false
+	}
+	if !dest.IsUint64() {
+		return false
+	}
+	if _, ok := frame.jumpDest[dest.Uint64()]; !ok {
+		// invalid jump, the path reverts
+		return false
+	}
+	path.pc = dest.Uint64()
+	return true
+}
+
+func (s *StaticAnalyzer) addAccountRead(addr *uint256.Int, hash common.Hash) {
+	if addr == nil {
+		s.confident = false
+		return
+	}
+	if a := common.Address(addr.Bytes20()); !s.isExcluded(a) {
+		s.list.AddReadSet(a, hash)
+	}
+}
+
+func (s *StaticAnalyzer) isExcluded(addr common.Address) bool {
+	_, ok := s.excl[addr]
+	return ok
+}
+
+// generic handles the opcodes that only compute on the stack
+func (s *StaticAnalyzer) generic(op vm.OpCode, path *staticPath) bool {
+	switch op {
+	case vm.ADD, vm.MUL, vm.SUB, vm.DIV, vm.SDIV, vm.MOD, vm.SMOD, vm.EXP, vm.SIGNEXTEND,
+		vm.LT, vm.GT, vm.SLT, vm.SGT, vm.EQ, vm.AND, vm.OR, vm.XOR, vm.BYTE, vm.SHL, vm.SHR, vm.SAR:
+		args, ok := path.popN(2)
+		if !ok {
+			return false
+		}
+		if args[0] == nil || args[1] == nil {
+			path.push(nil)
+		} else {
+			path.push(binaryOp(op, args[0], args[1]))
+		}
+	case vm.ADDMOD, vm.MULMOD:
+		args, ok := path.popN(3)
+		if !ok {
+			return false
+		}
+		if args[0] == nil || args[1] == nil || args[2] == nil {
+			path.push(nil)
+		} else if op == vm.ADDMOD {
+			path.push(new(uint256.Int).AddMod(args[0], args[1], args[2]))
+		} else {
+			path.push(new(uint256.Int).MulMod(args[0], args[1], args[2]))
+		}
+	case vm.ISZERO, vm.NOT:
+		x, ok := path.pop1()
+		if !ok {
+			return false
+		}
+		switch {
+		case x == nil:
+			path.push(nil)
+		case op == vm.NOT:
+			path.push(new(uint256.Int).Not(x))
+		case x.IsZero():
+			path.push(uint256.NewInt(1))
+		default:
+			path.push(new(uint256.Int))
+		}
+	case vm.POP:
+		return path.pop(1)
+	case vm.PUSH0:
+		path.push(new(uint256.Int))
+	case vm.GASPRICE, vm.RETURNDATASIZE, vm.COINBASE, vm.DIFFICULTY, vm.GASLIMIT, vm.CHAINID,
+		vm.BASEFEE, vm.BLOBBASEFEE, vm.MSIZE, vm.GAS:
+		path.push(nil)
+	case vm.BLOCKHASH, vm.BLOBHASH:
+		if !path.pop(1) {
+			return false
+		}
+		path.push(nil)
+	default:
+		// undefined opcode, the path fails
+		return false
+	}
+	return true
+}
+
+func binaryOp(op vm.OpCode, x, y *uint256.Int) *uint256.Int {
+	z := new(uint256.Int)
+	switch op {
+	case vm.ADD:
+		return z.Add(x, y)
+	case vm.MUL:
+		return z.Mul(x, y)
+	case vm.SUB:
+		return z.Sub(x, y)
+	case vm.DIV:
+		return z.Div(x, y)
+	case vm.SDIV:
+		return z.SDiv(x, y)
+	case vm.MOD:
+		return z.Mod(x, y)
+	case vm.SMOD:
+		return z.SMod(x, y)
+	case vm.EXP:
+		return z.Exp(x, y)
+	case vm.SIGNEXTEND:
+		return z.ExtendSign(y, x)
+	case vm.LT:
+		if x.Lt(y) {
+			z.SetOne()
+		}
+	case vm.GT:
+		if x.Gt(y) {
+			z.SetOne()
+		}
+	case vm.SLT:
+		if x.Slt(y) {
+			z.SetOne()
+		}
+	case vm.SGT:
+		if x.Sgt(y) {
+			z.SetOne()
+		}
+	case vm.EQ:
+		if x.Eq(y) {
+			z.SetOne()
+		}
+	case vm.AND:
+		return z.And(x, y)
+	case vm.OR:
+		return z.Or(x, y)
+	case vm.XOR:
+		return z.Xor(x, y)
+	case vm.BYTE:
+		return z.Set(y).Byte(x)
+	case vm.SHL:
+		if x.LtUint64(256) {
+			return z.Lsh(y, uint(x.Uint64()))
+		}
+	case vm.SHR:
+		if x.LtUint64(256) {
+			return z.Rsh(y, uint(x.Uint64()))
+		}
+	case vm.SAR:
+		if x.GtUint64(255) {
+			if y.Sign() >= 0 {
+				return z
+			}
+			return z.SetAllOne()
+		}
+		return z.SRsh(y, uint(x.Uint64()))
+	}
+	return z
+}
+
+// validJumpDest collects the JUMPDESTs which are not part of push data
+func validJumpDest(code []byte) map[uint64]struct{} {
+	dests := make(map[uint64]struct{})
+	for pc := uint64(0); pc < uint64(len(code)); pc++ {
+		op := vm.OpCode(code[pc])
+		if op == vm.JUMPDEST {
+			dests[pc] = struct{}{}
+		} else if op >= vm.PUSH1 && op <= vm.PUSH32 {
+			pc += uint64(op - vm.PUSH1 + 1)
+		}
+	}
+	return dests
+}
+
+// getData returns size bytes of data from offset, right padded with zeros
+func getData(data []byte, offset *uint256.Int, size uint64) []byte {
+	ret := make([]byte, size)
+	if !offset.IsUint64() || offset.Uint64() >= uint64(len(data)) {
+		return ret
+	}
+	copy(ret, data[offset.Uint64():])
+	return ret
+}
+
+// ----------------------- Path ----------------------------
+
+func (p *staticPath) push(v *uint256.Int) {
+	p.stack = append(p.stack, v)
+}
+
+func (p *staticPath) pop(n int) bool {
+	if len(p.stack) < n {
+		return false
+	}
+	p.stack = p.stack[:len(p.stack)-n]
+	return true
+}
+
+func (p *staticPath) pop1() (*uint256.Int, bool) {
+	args, ok := p.popN(1)
+	if !ok {
+		return nil, false
+	}
+	return args[0], true
+}
+
+// popN pops n values, args[0] is the top of the stack
+func (p *staticPath) popN(n int) ([]*uint256.Int, bool) {
+	if len(p.stack) < n {
+		return nil, false
+	}
+	args := make([]*uint256.Int, n)
+	for i := 0; i < n; i++ {
+		args[i] = p.stack[len(p.stack)-1-i]
+	}
+	p.stack = p.stack[:len(p.stack)-n]
+	return args, true
+}
+
+func (p *staticPath) copy() *staticPath {
+	visits := make(map[uint64]int, len(p.visits))
+	for pc, n := range p.visits {
+		visits[pc] = n
+	}
+	return &staticPath{
+		pc:     p.pc,
+		stack:  append([]*uint256.Int(nil), p.stack...),
+		memory: p.memory.copy(),
+		visits: visits,
+	}
+}
+
+// ----------------------- Memory ----------------------------
+
+func (m *staticMemory) copy() *staticMemory {
+	return &staticMemory{
+		data:      append([]byte(nil), m.data...),
+		known:     append([]bool(nil), m.known...),
+		forgotten: m.forgotten,
+	}
+}
+
+// bounds returns the concrete [start, end) of a memory region
+func (m *staticMemory) bounds(offset, size *uint256.Int) (uint64, uint64, bool) {
+	if offset == nil || size == nil || !offset.IsUint64() || !size.IsUint64() {
+		return 0, 0, false
+	}
+	start, end := offset.Uint64(), offset.Uint64()+size.Uint64()
+	if end < start || end > staticMaxMemory {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func (m *staticMemory) grow(end uint64) {
+	if end > uint64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-uint64(len(m.data)))...)
+		for uint64(len(m.known)) < end {
+			// fresh memory is zero, hence known
+			m.known = append(m.known, !m.forgotten)
+		}
+	}
+}
+
+func (m *staticMemory) set(offset *uint256.Int, data []byte) {
+	start, end, ok := m.bounds(offset, new(uint256.Int).SetUint64(uint64(len(data))))
+	if !ok {
+		m.forget()
+		return
+	}
+	m.grow(end)
+	copy(m.data[start:end], data)
+	for i := start; i < end; i++ {
+		m.known[i] = true
+	}
+}
+
+func (m *staticMemory) setUnknown(offset, size *uint256.Int) {
+	start, end, ok := m.bounds(offset, size)
+	if !ok {
+		m.forget()
+		return
+	}
+	m.grow(end)
+	for i := start; i < end; i++ {
+		m.known[i] = false
+	}
+}
+
+// setUnknownIfKnown is setUnknown, but keeps the memory if the region is unknown,
+// as the return data region is usually empty
+func (m *staticMemory) setUnknownIfKnown(offset, size *uint256.Int) {
+	if size != nil && size.IsZero() {
+		return
+	}
+	m.setUnknown(offset, size)
+}
+
+func (m *staticMemory) copyWithin(dst, src, size *uint256.Int) {
+	data, known := m.get(src, size)
+	if !known {
+		m.setUnknown(dst, size)
+		return
+	}
+	m.set(dst, data)
+}
+
+func (m *staticMemory) forget() {
+	m.forgotten = true
+	for i := range m.known {
+		m.known[i] = false
+	}
+}
+
+// get returns the memory region and whether all its bytes are known
+func (m *staticMemory) get(offset, size *uint256.Int) ([]byte, bool) {
+	start, end, ok := m.bounds(offset, size)
+	if !ok {
+		return nil, false
+	}
+	m.grow(end)
+	for i := start; i < end; i++ {
+		if !m.known[i] {
+			return nil, false
+		}
+	}
+	return append([]byte(nil), m.data[start:end]...), true
+}
+
+func (m *staticMemory) load(offset *uint256.Int) *uint256.Int {
+	data, known := m.get(offset, uint256.NewInt(32))
+	if !known {
+		return nil
+	}
+	return new(uint256.Int).SetBytes(data)
+}
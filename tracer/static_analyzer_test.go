@@ -0,0 +1,208 @@
+package tracer
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"interact/core"
+	"interact/state"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestStaticAnalysisMappingKey(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	contract := common.HexToAddress("0x1000")
+	statedb, _ := ethState.New(types.EmptyRootHash, ethState.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	// SLOAD(keccak(caller . 1)); SSTORE(calldata[4:36], 42)
+	statedb.SetCode(contract, common.FromHex("0x33600052600160205260406000205450602a6004355500"))
+
+	header := &types.Header{Number: big.NewInt(18000000), Time: 1690000000, Difficulty: common.Big0}
+	slot := common.HexToHash("0xbeef")
+	data := append([]byte{0xa9, 0x05, 0x9c, 0xbb}, slot.Bytes()...)
+	tx, _ := types.SignTx(types.NewTransaction(0, contract, common.Big0, 100000, common.Big1, data), types.LatestSigner(params.MainnetChainConfig), key)
+
+	list, confident, err := PredictWithStaticAnalysis(statedb, tx, header, params.MainnetChainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confident {
+		t.Error("expected a confident prediction")
+	}
+	mappingKey := crypto.Keccak256Hash(common.LeftPadBytes(sender.Bytes(), 32), common.LeftPadBytes([]byte{1}, 32))
+	if !list.ReadSet.Contains(contract, mappingKey) {
+		t.Errorf("missing mapping read %s", mappingKey.Hex())
+	}
+	if !list.WriteSet.Contains(contract, slot) {
+		t.Errorf("missing calldata write %s", slot.Hex())
+	}
+
+	// SLOAD(SLOAD(0)) has an unknown key
+	statedb.SetCode(contract, common.FromHex("0x6000545450"))
+	list, confident, _ = PredictWithStaticAnalysis(statedb, tx, header, params.MainnetChainConfig)
+	if confident {
+		t.Error("expected an unconfident prediction")
+	}
+	if !list.ReadSet.Contains(contract, common.Hash{}) {
+		t.Error("missing read of slot 0")
+	}
+}
+
+// callCode returns the bytecode of a CALL or DELEGATECALL of to with no input, pushing the value with pushValue
+func callCode(op string, pushValue string, to common.Address) string {
+	return "6000600060006000" + pushValue + push20(to) + "5a" + op + "5000"
+}
+
+func TestStaticAnalysisValueTransfers(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	lib := common.HexToAddress("0x5000")
+	cases := []struct {
+		name     string
+		code     string
+		from, to common.Address
+		transfer bool
+	}{
+		{"CALL with value", "0x" + callCode("f1", "6001", testReader), testContract, testReader, true},
+		{"CALL without value", "0x" + callCode("f1", "6000", testReader), testContract, testReader, false},
+		// an unknown value may be non-zero, so the transfer is kept
+		{"CALL with unknown value", "0x" + callCode("f1", "600054", testReader), testContract, testReader, true},
+		// the library runs in the context of testContract, so testContract pays
+		{"DELEGATECALL to CALL with value", "0x" + callCode("f4", "", lib), testContract, testReader, true},
+	}
+	for _, mode := range []core.TransferMode{core.TransferStrict, core.TransferDelta} {
+		core.SetTransferMode(mode)
+		for _, c := range cases {
+			env := newRWTestEnv(t)
+			env.statedb.SetCode(lib, common.FromHex("0x"+callCode("f1", "6001", testReader)))
+			env.setCode(rwCodeCase{name: c.name, code: c.code, balance: params.Ether})
+			list, confident, err := PredictWithStaticAnalysis(env.statedb, env.tx(&testContract, common.Big0, nil), env.header, env.chainCtx.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := mode.String() + " " + c.name
+			if !confident {
+				t.Errorf("%s: expected a confident prediction", name)
+			}
+			for _, addr := range []common.Address{c.from, c.to} {
+				var written bool
+				if mode == core.TransferStrict {
+					written = list.ReadSet.Contains(addr, BALANCE) && list.WriteSet.Contains(addr, BALANCE)
+				} else {
+					written = list.WriteSet.Contains(addr, BALANCEDELTA) && !list.WriteSet.Contains(addr, BALANCE)
+				}
+				if written != c.transfer {
+					t.Errorf("%s: balance of %s written %v, want %v", name, addr.Hex(), written, c.transfer)
+				}
+			}
+			if list.WriteSet.Contains(lib, BALANCE) || list.WriteSet.Contains(lib, BALANCEDELTA) {
+				t.Errorf("%s: balance of the library written", name)
+			}
+		}
+	}
+}
+
+func TestStaticAnalysisDynamicKeys(t *testing.T) {
+	slot0, slot1, slot2 := common.Hash{}, common.BigToHash(common.Big1), common.BigToHash(common.Big2)
+	cases := []struct {
+		name      string
+		code      string
+		confident bool
+		reads     []common.Hash
+		writes    []common.Hash
+	}{
+		// SLOAD(SLOAD(0)), the known read is kept
+		{"SLOAD of a loaded key", "0x6000545450", false, []common.Hash{slot0}, nil},
+		// SSTORE(SLOAD(0), 1); SSTORE(2, 1)
+		{"SSTORE of a loaded key", "0x60016000545560016002550000", false, []common.Hash{slot0, slot2}, []common.Hash{slot2}},
+		// JUMPI on SLOAD(0) to SSTORE(2, 1), else SSTORE(1, 1), both branches are followed
+		{"SSTORE on both branches", "0x600054600c57600160015500" + "5b600160025500", true,
+			[]common.Hash{slot0, slot1, slot2}, []common.Hash{slot1, slot2}},
+		// CALL to SLOAD(0)
+		{"CALL to a loaded address", "0x" + "6000600060006000600060005454" + "5af15000", false, []common.Hash{slot0}, nil},
+	}
+	for _, c := range cases {
+		env := newRWTestEnv(t)
+		env.setCode(rwCodeCase{name: c.name, code: c.code})
+		list, confident, err := PredictWithStaticAnalysis(env.statedb, env.tx(&testContract, common.Big0, nil), env.header, env.chainCtx.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confident != c.confident {
+			t.Errorf("%s: confident %v, want %v", c.name, confident, c.confident)
+		}
+		for _, slot := range c.reads {
+			if !list.ReadSet.Contains(testContract, slot) {
+				t.Errorf("%s: missing read of %s", c.name, slot.Hex())
+			}
+		}
+		for _, slot := range c.writes {
+			if !list.WriteSet.Contains(testContract, slot) {
+				t.Errorf("%s: missing write of %s", c.name, slot.Hex())
+			}
+		}
+	}
+}
+
+func TestStaticAnalysisHugeCopy(t *testing.T) {
+	huge := "7f" + strings.Repeat("ff", 32)
+	cases := []struct {
+		name string
+		code string
+	}{
+		// CALLDATACOPY(0, 0, 2^256-1); SLOAD(1)
+		{"CALLDATACOPY past uint64", "0x" + huge + "6000600037" + "6001545000"},
+		// CODECOPY(0, 0, 2^256-1); SLOAD(1)
+		{"CODECOPY past uint64", "0x" + huge + "6000600039" + "6001545000"},
+		// CALLDATACOPY(0, 0, 2^64-1); SLOAD(1)
+		{"CALLDATACOPY past the memory", "0x67" + strings.Repeat("ff", 8) + "6000600037" + "6001545000"},
+	}
+	for _, c := range cases {
+		env := newRWTestEnv(t)
+		env.setCode(rwCodeCase{name: c.name, code: c.code})
+		list, _, err := PredictWithStaticAnalysis(env.statedb, env.tx(&testContract, common.Big0, nil), env.header, env.chainCtx.Config())
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		// the path goes on past the copy
+		if !list.ReadSet.Contains(testContract, common.BigToHash(common.Big1)) {
+			t.Errorf("%s: missing read of slot 1", c.name)
+		}
+	}
+}
+
+// TestStaticAnalysisCovers checks that a confident prediction covers the rw sets recorded by the execution
+func TestStaticAnalysisCovers(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	for _, mode := range []core.TransferMode{core.TransferDisabled, core.TransferStrict, core.TransferDelta} {
+		core.SetTransferMode(mode)
+		for _, c := range rwCodeCases() {
+			env := newRWTestEnv(t)
+			env.setCode(c)
+			tx := env.tx(&testContract, common.Big0, nil)
+			list, confident, err := PredictWithStaticAnalysis(env.statedb, tx, env.header, env.chainCtx.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !confident {
+				continue
+			}
+			recorded, err := ExecToGenerateRWSet(state.NewStateWithRwSets(env.statedb.Copy()), tx, env.header, env.chainCtx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !list.Covers(*recorded) {
+				listJSON, _ := json.Marshal(list)
+				recordedJSON, _ := json.Marshal(recorded)
+				t.Errorf("%s %s: confident prediction misses accesses\nstatic: %s\nstate:  %s", mode, c.name, listJSON, recordedJSON)
+			}
+		}
+	}
+}
@@ -31,11 +31,12 @@ func AriaOneRound(antsPool *ants.Pool, txs types.Transactions, header *types.Hea
 		txListIndex[i] = i
 	}
 
-	errs := tracer.ExecWithSnapshotState(antsPool, txs, txListIndex, snapshots, header, fakeChainCtx, antsWG, readReserve, writeReserve)
+	errs, _ := tracer.ExecWithSnapshotState(antsPool, txs, txListIndex, snapshots, header, fakeChainCtx, antsWG, readReserve, writeReserve)
 
 	restTx := make(types.Transactions, 0)
 	restPredictRwSets := make([]*accesslist.RWSet, 0)
 	commitStates := make(interactState.CacheStateList, 0)
+	commitIndex := make([]int, 0)
 
 	for i, tx := range txs {
 		if errs[i] != nil && errs[i] != tracer.ErrFalsePredict {
@@ -55,9 +56,18 @@ func AriaOneRound(antsPool *ants.Pool, txs types.Transactions, header *types.Hea
 		} else {
 			// can be committed
 			commitStates = append(commitStates, snapshots[i].GetStateDB().(*interactState.CacheState))
+			commitIndex = append(commitIndex, i)
+		}
+	}
+	mergeErrs := MergeToCacheStateConcurrent(antsPool, commitStates, fullcache, antsWG)
+	for j, err := range mergeErrs {
+		if err != nil {
+			// the balance deltas are invalid, i.e. insufficient balance for the value transfer
+			i := commitIndex[j]
+			restTx = append(restTx, txs[i])
+			restPredictRwSets = append(restPredictRwSets, snapshots[i].GetRWSet())
 		}
 	}
-	MergeToCacheStateConcurrent(antsPool, commitStates, fullcache, antsWG)
 	fmt.Println("End Aria One Round Execution")
 	fmt.Println("Cost:", time.Since(st))
 
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// BarrierState is a cache state the barrier round can prefetch into while executing,
+// i.e. a CacheState or a ConcurrentTxState
+type BarrierState interface {
+	interactState.StateInterface
+	Prefetch(statedb vm.StateDB, rwSets []*accesslist.RWSet)
+	IsPrefetched(addr common.Address, hash common.Hash) bool
+}
+
+// WholeState is a BarrierState over a state holding every value, e.g. the StateDB the groups are merged into
+type WholeState struct {
+	interactState.StateInterface
+}
+
+func (WholeState) Prefetch(statedb vm.StateDB, rwSets []*accesslist.RWSet) {}
+
+func (WholeState) IsPrefetched(addr common.Address, hash common.Hash) bool {
+	return true
+}
+
+// BarrierTxs returns the txs the schedulers leave out, in block order:
+// the txs without a prediction and the later txs of their senders
+func BarrierTxs(txs types.Transactions, predictRWSets accesslist.RWSetList) []uint {
+	ok := schedulable(predictRWSets, senderPredecessors(txs))
+	barrier := make([]uint, 0)
+	for i := range ok {
+		if !ok[i] {
+			barrier = append(barrier, uint(i))
+		}
+	}
+	return barrier
+}
+
+// ExecBarrierRound executes the barrier txs one after another on cache, once all the rounds are merged in it.
+// As they have no prediction, a tx touching what is not in cache is reverted, the missing values
+// are prefetched from statedb and the tx is executed again. The values not in cache are untouched
+// by the scheduled txs, so statedb, the state the cache was prefetched from, still holds them
+func ExecBarrierRound(statedb vm.StateDB, cache BarrierState, barrier []uint, txs types.Transactions, header *types.Header, chainCtx core.ChainContext) (types.Transactions, []error, []uint64) {
+	txsToExec := GenerateTxToExec(barrier, txs)
+	errs := make([]error, len(txsToExec))
+	gasUsed := make([]uint64, len(txsToExec))
+	for i, tx := range txsToExec {
+		for {
+			rwSet := accesslist.NewRWSet()
+			fulldb := interactState.NewStateWithRwSets(cache)
+			fulldb.SetRWSet(rwSet)
+			snapshot := cache.Snapshot()
+			txErrs, txGasUsed := tracer.ExecuteTxs(fulldb, types.Transactions{tx}, header, chainCtx)
+			missing := missingRWSet(cache, rwSet)
+			if missing == nil {
+				errs[i], gasUsed[i] = txErrs[0], txGasUsed[0]
+				break
+			}
+			cache.RevertToSnapshot(snapshot)
+			cache.Prefetch(statedb, accesslist.RWSetList{missing})
+		}
+	}
+	return txsToExec, errs, gasUsed
+}
+
+// missingRWSet returns the accesses of rwSet not prefetched in cache, nil if there is none.
+// A delta is on the balance, so a balance the rounds updated is not prefetched again over their updates
+func missingRWSet(cache BarrierState, rwSet *accesslist.RWSet) *accesslist.RWSet {
+	var missing *accesslist.RWSet
+	for _, set := range []accesslist.ALTuple{rwSet.ReadSet, rwSet.WriteSet} {
+		for addr, state := range set {
+			for hash := range state {
+				if hash == accesslist.BALANCEDELTA {
+					hash = accesslist.BALANCE
+				}
+				if cache.IsPrefetched(addr, hash) {
+					continue
+				}
+				if missing == nil {
+					missing = accesslist.NewRWSet()
+				}
+				missing.AddReadSet(addr, hash)
+			}
+		}
+	}
+	return missing
+}
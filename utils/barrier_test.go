@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// execEnv is a mainnet block after the merge with the first senders of testKey funded
+type execEnv struct {
+	statedb  *ethState.StateDB
+	header   *types.Header
+	chainCtx core.ChainContext
+}
+
+func newExecEnv(t *testing.T) *execEnv {
+	statedb, err := ethState.New(types.EmptyRootHash, ethState.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		statedb.AddBalance(testSender(i), big.NewInt(params.Ether))
+	}
+	statedb.Finalise(true)
+	return &execEnv{
+		statedb: statedb,
+		header: &types.Header{
+			Number:     big.NewInt(18000000),
+			Time:       1690000000,
+			Difficulty: common.Big0,
+			BaseFee:    big.NewInt(params.GWei),
+			GasLimit:   30000000,
+			Coinbase:   testCoinbase,
+		},
+		chainCtx: core.NewFakeChainContext(rawdb.NewMemoryDatabase()),
+	}
+}
+
+func testSender(i int) common.Address {
+	return crypto.PubkeyToAddress(testKey(i).PublicKey)
+}
+
+// call is a signed tx of sender to to with value wei and data
+func (env *execEnv) call(sender int, nonce uint64, to common.Address, value int64, data []byte) *types.Transaction {
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		Gas:      100000,
+		GasPrice: big.NewInt(2 * params.GWei),
+		To:       &to,
+		Value:    big.NewInt(value),
+		Data:     data,
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(env.chainCtx.Config().ChainID), testKey(sender))
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func TestBarrierTxs(t *testing.T) {
+	txs := types.Transactions{
+		testTx(0, 0, 21000, 1),
+		testTx(1, 0, 21000, 1),
+		testTx(1, 1, 21000, 1),
+		testTx(2, 0, 21000, 1),
+		testTx(0, 1, 21000, 1),
+	}
+	rwSet := accesslist.NewRWSet()
+	// tx 1 has no prediction, so tx 2 of the same sender can't run ahead of the barrier either
+	predictRWSets := accesslist.RWSetList{rwSet, nil, rwSet, rwSet, rwSet}
+	if barrier, want := BarrierTxs(txs, predictRWSets), []uint{1, 2}; !reflect.DeepEqual(barrier, want) {
+		t.Fatalf("barrier %v, want %v", barrier, want)
+	}
+	if barrier := BarrierTxs(txs, accesslist.RWSetList{rwSet, rwSet, rwSet, rwSet, rwSet}); len(barrier) != 0 {
+		t.Fatalf("barrier %v with all the txs predicted", barrier)
+	}
+}
+
+func TestExecBarrierRound(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	core.SetTransferMode(core.TransferDelta)
+	env := newExecEnv(t)
+	payee := common.HexToAddress("0xbeef")
+	env.statedb.AddBalance(payee, big.NewInt(100))
+
+	// the rounds prefetched the balance of payee and paid it 400 more
+	fullcache := interactState.NewFullCacheConcurrent()
+	fullcache.Prefetch(env.statedb, accesslist.RWSetList{{ReadSet: accesslist.ALTuple{payee: {accesslist.BALANCE: struct{}{}}}}})
+	fullcache.SetBalance(payee, big.NewInt(500))
+
+	txs := types.Transactions{env.call(0, 0, payee, 1, nil), env.call(0, 1, payee, 2, nil)}
+	barrierTxs, errs, gasUsed := ExecBarrierRound(env.statedb, interactState.NewConcurrentTxState(fullcache), []uint{0, 1}, txs, env.header, env.chainCtx)
+	if barrierTxs.Len() != 2 {
+		t.Fatalf("executed %d barrier txs, want 2", barrierTxs.Len())
+	}
+	for i := range errs {
+		if errs[i] != nil || gasUsed[i] != params.TxGas {
+			t.Fatalf("barrier tx %d: err %v, gas used %d", i, errs[i], gasUsed[i])
+		}
+	}
+	// the sender was missing and is prefetched, the delta to payee adds to the balance of the rounds
+	if got := fullcache.GetBalance(payee); got.Cmp(big.NewInt(503)) != 0 {
+		t.Fatalf("payee balance %v, want 503", got)
+	}
+	if got := fullcache.GetNonce(testSender(0)); got != 2 {
+		t.Fatalf("sender nonce %d, want 2", got)
+	}
+}
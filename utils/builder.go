@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"fmt"
+	"interact/accesslist"
+	conflictgraph "interact/conflictGraph"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PendingTx is a tx of the mempool with its predicted RW set
+type PendingTx struct {
+	Tx    *types.Transaction
+	RWSet *accesslist.RWSet
+	Gas   uint64 // the estimated gas used, the weight of the tx in the schedule, tx.Gas() if 0
+}
+
+func (p PendingTx) weight() uint64 {
+	if p.Gas > 0 {
+		return p.Gas
+	}
+	return p.Tx.Gas()
+}
+
+type BuilderConfig struct {
+	GasLimit uint64
+	BaseFee  *big.Int // nil before London
+	MinTip   *big.Int // the fee-priority floor, the txs tipping less stay in the pool
+	Workers  int      // at least 1
+}
+
+// BuiltBlock is the body of a block with its schedule precomputed for the executors
+type BuiltBlock struct {
+	Txs      types.Transactions
+	RWSets   accesslist.RWSetList
+	Weights  []uint64
+	Schedule *CriticalPathSchedule // for ExecWithCriticalPath
+	Rounds   [][]uint              // the in-degree layers, for the round executors
+}
+
+// BuildParallelBlock chooses and orders the txs of a block from the pending ones to shorten its critical path.
+// The txs are picked one at a time among the next tx of each sender: first those that keep the critical path
+// within the balanced load of the workers, i.e. that don't make the block slower to run in parallel,
+// then the highest tip. So the hot-key chains are cut short once they would dominate the block,
+// and the fee order decides otherwise. The txs without a prediction or tipping less than MinTip are left out
+func BuildParallelBlock(pending []PendingTx, cfg BuilderConfig) (*BuiltBlock, error) {
+	return buildBlock(pending, cfg, true)
+}
+
+// BuildBlockByFee is the fee-ordered builder, the highest tip first in nonce order like the miner,
+// the baseline of BuildParallelBlock
+func BuildBlockByFee(pending []PendingTx, cfg BuilderConfig) (*BuiltBlock, error) {
+	return buildBlock(pending, cfg, false)
+}
+
+func buildBlock(pending []PendingTx, cfg BuilderConfig, parallel bool) (*BuiltBlock, error) {
+	if cfg.Workers <= 0 {
+		return nil, fmt.Errorf("%w: %d workers", ErrNoWorkers, cfg.Workers)
+	}
+	queues, tips := senderQueues(pending, cfg)
+	poolGas := uint64(0)
+	for _, queue := range queues {
+		for _, k := range queue {
+			poolGas += pending[k].weight()
+		}
+	}
+	if poolGas > cfg.GasLimit {
+		poolGas = cfg.GasLimit
+	}
+	// a critical path up to the balanced load doesn't slow the block down
+	target := (poolGas + uint64(cfg.Workers) - 1) / uint64(cfg.Workers)
+
+	graph := conflictgraph.NewIncrementalGraph()
+	level := make(map[uint]uint64) // the heaviest path ending at each chosen tx
+	bound, used := uint64(0), uint64(0)
+	next := make([]int, len(queues))
+	last := make([]uint, len(queues)) // the last chosen tx of each sender, a nonce conflict the prediction may miss
+	block := &BuiltBlock{}
+	for {
+		best, bestGrowth, bestLevel := -1, uint64(0), uint64(0)
+		for q, queue := range queues {
+			if next[q] == len(queue) {
+				continue
+			}
+			p := pending[queue[next[q]]]
+			if used+p.Tx.Gas() > cfg.GasLimit {
+				continue
+			}
+			l := uint64(0)
+			if next[q] > 0 {
+				l = level[last[q]]
+			}
+			for _, id := range graph.Conflicting(p.RWSet) {
+				if level[id] > l {
+					l = level[id]
+				}
+			}
+			l += p.weight()
+			growth := uint64(0)
+			if parallel && l > bound && l > target {
+				if bound > target {
+					growth = l - bound
+				} else {
+					growth = l - target
+				}
+			}
+			if best == -1 || growth < bestGrowth ||
+				(growth == bestGrowth && tips[queue[next[q]]].Cmp(tips[queues[best][next[best]]]) > 0) {
+				best, bestGrowth, bestLevel = q, growth, l
+			}
+		}
+		if best == -1 {
+			break
+		}
+		p := pending[queues[best][next[best]]]
+		next[best]++
+		id, _ := graph.AddTx(p.Tx.Hash(), p.RWSet)
+		level[id] = bestLevel
+		last[best] = id
+		if bestLevel > bound {
+			bound = bestLevel
+		}
+		used += p.Tx.Gas()
+		block.Txs = append(block.Txs, p.Tx)
+		block.RWSets = append(block.RWSets, p.RWSet)
+		block.Weights = append(block.Weights, p.weight())
+	}
+	block.Schedule = GenerateCriticalPathSchedule(block.Txs, block.RWSets, block.Weights)
+	rounds, err := GenerateDegreeZeroGroups(block.Txs, block.RWSets)
+	if err != nil {
+		return nil, err
+	}
+	block.Rounds = rounds
+	return block, nil
+}
+
+// senderQueues groups the pending txs by sender in nonce order, in the order the senders first appear.
+// A queue ends before the first tx that can't be included, the later txs of the sender would have a nonce gap
+func senderQueues(pending []PendingTx, cfg BuilderConfig) ([][]int, map[int]*big.Int) {
+	bySender := make(map[common.Address][]int)
+	senders := make([]common.Address, 0)
+	for k, p := range pending {
+		from, err := types.Sender(types.LatestSignerForChainID(p.Tx.ChainId()), p.Tx)
+		if err != nil {
+			continue
+		}
+		if _, ok := bySender[from]; !ok {
+			senders = append(senders, from)
+		}
+		bySender[from] = append(bySender[from], k)
+	}
+	queues := make([][]int, 0, len(senders))
+	tips := make(map[int]*big.Int, len(pending))
+	for _, from := range senders {
+		txs := bySender[from]
+		sort.SliceStable(txs, func(i, j int) bool {
+			return pending[txs[i]].Tx.Nonce() < pending[txs[j]].Tx.Nonce()
+		})
+		queue := make([]int, 0, len(txs))
+		for i, k := range txs {
+			if i > 0 && pending[k].Tx.Nonce() != pending[txs[i-1]].Tx.Nonce()+1 {
+				break
+			}
+			tip, err := pending[k].Tx.EffectiveGasTip(cfg.BaseFee)
+			if err != nil || pending[k].RWSet == nil || (cfg.MinTip != nil && tip.Cmp(cfg.MinTip) < 0) {
+				break
+			}
+			tips[k] = tip
+			queue = append(queue, k)
+		}
+		if len(queue) > 0 {
+			queues = append(queues, queue)
+		}
+	}
+	return queues, tips
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"errors"
+	"interact/accesslist"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pendingTx is a tx of sender writing slot s of testContract
+func pendingTx(sender int, nonce uint64, tip int64, s int) PendingTx {
+	rwSet := accesslist.NewRWSet()
+	rwSet.AddWriteSet(testContract, slot(s))
+	return PendingTx{Tx: testTx(sender, nonce, 21000, tip), RWSet: rwSet}
+}
+
+// builders are the parallel and the fee-ordered builder
+var builders = []struct {
+	name  string
+	build func([]PendingTx, BuilderConfig) (*BuiltBlock, error)
+}{
+	{"parallel", BuildParallelBlock},
+	{"fee", BuildBlockByFee},
+}
+
+func TestBuildBlockNonceOrder(t *testing.T) {
+	pending := []PendingTx{
+		pendingTx(0, 2, 10, 100),
+		pendingTx(1, 0, 10, 101),
+		pendingTx(0, 0, 10, 102),
+		pendingTx(1, 2, 50, 103), // after a nonce gap
+		pendingTx(0, 1, 10, 104),
+		pendingTx(2, 0, 20, 105),
+	}
+	// the unpredicted tx ends the queue of sender 3
+	pending = append(pending, PendingTx{Tx: testTx(3, 0, 21000, 90)}, pendingTx(3, 1, 90, 106))
+	for _, builder := range builders {
+		block, err := builder.build(pending, BuilderConfig{GasLimit: 30000000, Workers: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Txs.Len() != 5 || len(block.RWSets) != 5 || len(block.Weights) != 5 {
+			t.Fatalf("%s: %d txs, want the 3 of sender 0, 1 of sender 1 and 1 of sender 2", builder.name, block.Txs.Len())
+		}
+		// the block runs in its order, as one group
+		if err := ValidateGroupOrder(block.Txs, []types.Transactions{block.Txs}); err != nil {
+			t.Fatalf("%s: %v", builder.name, err)
+		}
+		nonces := make(map[uint64]int)
+		for _, tx := range block.Txs {
+			if tx.Hash() == pending[3].Tx.Hash() || tx.Hash() == pending[7].Tx.Hash() {
+				t.Fatalf("%s: tx of nonce %d included past a gap or an unpredicted tx", builder.name, tx.Nonce())
+			}
+			nonces[tx.Nonce()]++
+		}
+		if nonces[0] != 3 || nonces[1] != 1 || nonces[2] != 1 {
+			t.Fatalf("%s: nonces %v", builder.name, nonces)
+		}
+	}
+}
+
+func TestBuildBlockMinTip(t *testing.T) {
+	pending := []PendingTx{
+		pendingTx(0, 0, 10, 100),
+		pendingTx(0, 1, 2, 101),
+		pendingTx(0, 2, 10, 102), // behind a tx under the floor
+		pendingTx(1, 0, 5, 103),
+		pendingTx(2, 0, 4, 104),
+	}
+	for _, builder := range builders {
+		block, err := builder.build(pending, BuilderConfig{GasLimit: 30000000, MinTip: big.NewInt(5), Workers: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Txs.Len() != 2 || block.Txs[0].Hash() != pending[0].Tx.Hash() || block.Txs[1].Hash() != pending[3].Tx.Hash() {
+			t.Fatalf("%s: %d txs, want the tx tipping 10 then the tx tipping 5", builder.name, block.Txs.Len())
+		}
+	}
+
+	// with a base fee the effective tip is capped by the fee cap, tip + 100 for testTx
+	block, err := BuildBlockByFee(pending, BuilderConfig{GasLimit: 30000000, BaseFee: big.NewInt(103), MinTip: big.NewInt(5), Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Txs.Len() != 1 || block.Txs[0].Hash() != pending[0].Tx.Hash() {
+		t.Fatalf("%d txs above the floor with a base fee, want only the tx tipping 10", block.Txs.Len())
+	}
+}
+
+func TestBuildBlockGasLimit(t *testing.T) {
+	pending := []PendingTx{
+		pendingTx(0, 0, 10, 100),
+		{Tx: testTx(1, 0, 50000, 30), RWSet: accesslist.NewRWSet()},
+		pendingTx(2, 0, 20, 101),
+		pendingTx(3, 0, 5, 102),
+	}
+	cfg := BuilderConfig{GasLimit: 71000, Workers: 4}
+	for _, builder := range builders {
+		block, err := builder.build(pending, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		included := make(map[int]bool)
+		gas := uint64(0)
+		for _, tx := range block.Txs {
+			gas += tx.Gas()
+			for k := range pending {
+				if tx.Hash() == pending[k].Tx.Hash() {
+					included[k] = true
+				}
+			}
+		}
+		if gas > cfg.GasLimit {
+			t.Fatalf("%s: %d gas over the limit of %d", builder.name, gas, cfg.GasLimit)
+		}
+		// a tx is only left out if it doesn't fit
+		for k := range pending {
+			if !included[k] && gas+pending[k].Tx.Gas() <= cfg.GasLimit {
+				t.Fatalf("%s: tx %d of %d gas left out with %d gas left", builder.name, k, pending[k].Tx.Gas(), cfg.GasLimit-gas)
+			}
+		}
+	}
+
+	// by fee the tx of 50000 gas goes first, then there is only room for the tx tipping 20
+	block, err := BuildBlockByFee(pending, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Txs.Len() != 2 || block.Txs[0].Hash() != pending[1].Tx.Hash() || block.Txs[1].Hash() != pending[2].Tx.Hash() {
+		t.Fatalf("%d txs by fee, want the tx of 50000 gas and the tx tipping 20", block.Txs.Len())
+	}
+}
+
+func TestBuildParallelBlockCriticalPath(t *testing.T) {
+	// 6 txs on a hot slot tipping 100 and 10 txs apart tipping 10, room for 8 txs on 4 workers
+	pending := make([]PendingTx, 0)
+	for i := 0; i < 6; i++ {
+		pending = append(pending, pendingTx(i, 0, 100, 0))
+	}
+	for i := 6; i < 16; i++ {
+		pending = append(pending, pendingTx(i, 0, 10, i))
+	}
+	cfg := BuilderConfig{GasLimit: 8 * 21000, Workers: 4}
+
+	byFee, err := BuildBlockByFee(pending, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := BuildParallelBlock(pending, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byFee.Txs.Len() != 8 || parallel.Txs.Len() != 8 {
+		t.Fatalf("%d txs by fee, %d in parallel, want full blocks of 8", byFee.Txs.Len(), parallel.Txs.Len())
+	}
+	// by fee the whole hot chain is in, in parallel it stops at the balanced load of 2 txs per worker
+	if byFee.Schedule.Bound != 6*21000 || parallel.Schedule.Bound != 2*21000 {
+		t.Fatalf("critical path %d by fee, %d in parallel, want %d and %d", byFee.Schedule.Bound, parallel.Schedule.Bound, 6*21000, 2*21000)
+	}
+	if parallel.Schedule.Total != byFee.Schedule.Total {
+		t.Fatalf("total %d in parallel, %d by fee, want the same gas", parallel.Schedule.Total, byFee.Schedule.Total)
+	}
+	if len(parallel.Rounds) != 2 {
+		t.Fatalf("%d rounds in parallel, want 2", len(parallel.Rounds))
+	}
+}
+
+func TestBuildBlockNoWorkers(t *testing.T) {
+	pending := []PendingTx{pendingTx(0, 0, 10, 100)}
+	for _, builder := range builders {
+		if _, err := builder.build(pending, BuilderConfig{GasLimit: 30000000}); !errors.Is(err, ErrNoWorkers) {
+			t.Fatalf("%s: %v, want %v", builder.name, err, ErrNoWorkers)
+		}
+	}
+}
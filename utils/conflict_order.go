@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"interact/accesslist"
+)
+
+// ErrConflictOrder means a schedule runs a tx no later than an earlier tx conflicting with it,
+// so the result may not match the block order
+var ErrConflictOrder = errors.New("conflicting txs scheduled out of block order")
+
+// ValidateConflictOrder checks that rounds preserve the block order under rwSets, i.e.
+// a scheduled tx is in a later round than every earlier scheduled tx it conflicts with.
+// With the predicted rw sets it checks the scheduler, with the true ones it checks the schedule
+func ValidateConflictOrder(rwSets accesslist.RWSetList, rounds [][]uint) error {
+	roundOf := make(map[uint]int)
+	for r, round := range rounds {
+		for _, id := range round {
+			roundOf[id] = r
+		}
+	}
+	for i := range rwSets {
+		ri, ok := roundOf[uint(i)]
+		if !ok || rwSets[i] == nil {
+			continue
+		}
+		for j := i + 1; j < len(rwSets); j++ {
+			rj, ok := roundOf[uint(j)]
+			if !ok || rwSets[j] == nil || rj > ri {
+				continue
+			}
+			if rwSets[i].HasConflict(*rwSets[j]) {
+				return fmt.Errorf("%w: tx %d in round %d, tx %d in round %d", ErrConflictOrder, j, rj, i, ri)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package utils
+
+import (
+	"fmt"
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/panjf2000/ants/v2"
+)
+
+type hotKey struct {
+	addr common.Address
+	hash common.Hash
+}
+
+// keyCounts counts the txs of a block by the keys they touch, a balance delta counts on the balance
+type keyCounts struct {
+	txs     int
+	touches map[hotKey]int
+	writes  map[hotKey]int // the txs writing the key, not by a delta
+	deltas  map[hotKey]int // the txs only adding a delta to the balance, they don't conflict with each other
+}
+
+func countKeys(rwSets accesslist.RWSetList) *keyCounts {
+	counts := &keyCounts{
+		touches: make(map[hotKey]int),
+		writes:  make(map[hotKey]int),
+		deltas:  make(map[hotKey]int),
+	}
+	for _, rwSet := range rwSets {
+		if rwSet == nil {
+			continue
+		}
+		counts.txs++
+		touched := make(map[hotKey]struct{})
+		for addr, state := range rwSet.ReadSet {
+			for hash := range state {
+				touched[hotKey{addr, hash}] = struct{}{}
+			}
+		}
+		for addr, state := range rwSet.WriteSet {
+			for hash := range state {
+				if hash == accesslist.BALANCEDELTA {
+					key := hotKey{addr, accesslist.BALANCE}
+					if _, ok := touched[key]; !ok && !rwSet.WriteSet.Contains(addr, accesslist.BALANCE) {
+						counts.deltas[key]++
+					}
+					touched[key] = struct{}{}
+					continue
+				}
+				touched[hotKey{addr, hash}] = struct{}{}
+				counts.writes[hotKey{addr, hash}]++
+			}
+		}
+		for key := range touched {
+			counts.touches[key]++
+		}
+	}
+	return counts
+}
+
+// ContentionManager detects the hot keys, i.e. the keys written and touched by a large part of the txs
+// of the current and the recent blocks, e.g. the reserves of a DEX pool or the balances of WETH.
+// Such a key puts most of a block into one connected component, so the txs touching it run in a serial lane
+// while the rest of the block runs in parallel, see PlanHotLane
+type ContentionManager struct {
+	Window    int     // the number of recent blocks counted along with the current one
+	Threshold float64 // the least fraction of the txs touching a hot key
+	recent    []*keyCounts
+}
+
+func NewContentionManager(window int, threshold float64) *ContentionManager {
+	return &ContentionManager{
+		Window:    window,
+		Threshold: threshold,
+		recent:    make([]*keyCounts, 0, window),
+	}
+}
+
+// Observe records the rw sets of an executed block, the oldest block beyond the window is forgotten
+func (m *ContentionManager) Observe(rwSets accesslist.RWSetList) {
+	if m.Window <= 0 {
+		return
+	}
+	if len(m.recent) == m.Window {
+		m.recent = m.recent[1:]
+	}
+	m.recent = append(m.recent, countKeys(rwSets))
+}
+
+// HotKeys returns the hot keys of the recent blocks and the current one with the predicted rwSets.
+// A key is hot if at least Threshold of the txs, and two of them, touch it and some of them write it,
+// the keys only changed by balance deltas are not, the deltas commute
+func (m *ContentionManager) HotKeys(rwSets accesslist.RWSetList) accesslist.ALTuple {
+	txs := 0
+	touches := make(map[hotKey]int)
+	writes := make(map[hotKey]int)
+	deltas := make(map[hotKey]int)
+	for _, counts := range append(append([]*keyCounts{}, m.recent...), countKeys(rwSets)) {
+		txs += counts.txs
+		for key, n := range counts.touches {
+			touches[key] += n
+		}
+		for key, n := range counts.writes {
+			writes[key] += n
+		}
+		for key, n := range counts.deltas {
+			deltas[key] += n
+		}
+	}
+	least := int(m.Threshold * float64(txs))
+	if least < 2 {
+		least = 2
+	}
+	hot := make(accesslist.ALTuple)
+	for key, n := range touches {
+		if n >= least && writes[key]+deltas[key] > 0 && n > deltas[key] {
+			hot.Add(key.addr, key.hash)
+		}
+	}
+	return hot
+}
+
+// touchesHotKey reports whether rwSet touches a key of hot, a balance delta touches the balance
+func touchesHotKey(rwSet *accesslist.RWSet, hot accesslist.ALTuple) bool {
+	for _, tuple := range []accesslist.ALTuple{rwSet.ReadSet, rwSet.WriteSet} {
+		for addr, state := range tuple {
+			if _, ok := hot[addr]; !ok {
+				continue
+			}
+			for hash := range state {
+				if hash == accesslist.BALANCEDELTA {
+					hash = accesslist.BALANCE
+				}
+				if hot.Contains(addr, hash) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// HotLanePlan splits a block into a serial lane of the txs touching the hot keys and the rounds of the other txs,
+// which run alongside it. A tx of the rounds conflicting with the lane is ordered with dependency edges on the lane
+// positions instead of joining it
+type HotLanePlan struct {
+	HotKeys accesslist.ALTuple
+	Hot     []uint       // the serial lane in block order
+	Rounds  [][]uint     // the in-degree layers of the other txs, ordered along with the lane
+	After   map[uint]int // the lane position a tx of the rounds waits for, the last hot tx ordered before it
+	Waits   [][]uint     // the txs of the rounds each lane position waits for, those ordered before it
+	Barrier []uint       // the txs without a prediction, after both
+	HotGas  uint64       // of the lane
+	Gas     uint64       // of all the txs
+}
+
+// PlanHotLane puts the txs touching a hot key in the serial lane. The other txs are layered on the conflict graph
+// of the block with the lane chained in block order, so a tx of the rounds is in a later round than the txs ordered
+// before it and the lane positions it waits for never wait for it or a later round. Each tx weighs weights[i]
+func PlanHotLane(txs types.Transactions, predictRWSets accesslist.RWSetList, hot accesslist.ALTuple, weights []uint64) (*HotLanePlan, error) {
+	plan := &HotLanePlan{HotKeys: hot, After: make(map[uint]int), Barrier: BarrierTxs(txs, predictRWSets)}
+	graph := generateDiGraph(txs, predictRWSets)
+	position := make(map[uint]int)
+	for id := range graph.Vertices {
+		if touchesHotKey(predictRWSets[id], hot) {
+			plan.Hot = append(plan.Hot, id)
+		}
+	}
+	sort.Slice(plan.Hot, func(i, j int) bool {
+		return plan.Hot[i] < plan.Hot[j]
+	})
+	for p, id := range plan.Hot {
+		position[id] = p
+		if p > 0 {
+			graph.AddEdge(plan.Hot[p-1], id)
+		}
+	}
+
+	plan.Waits = make([][]uint, len(plan.Hot))
+	for id, neighbors := range graph.AdjacencyMap {
+		for neighbor := range neighbors {
+			p, fromLane := position[id]
+			q, toLane := position[neighbor]
+			switch {
+			case fromLane && !toLane:
+				if last, ok := plan.After[neighbor]; !ok || p > last {
+					plan.After[neighbor] = p
+				}
+			case !fromLane && toLane:
+				plan.Waits[q] = append(plan.Waits[q], id)
+			}
+		}
+	}
+	for _, waits := range plan.Waits {
+		sort.Slice(waits, func(i, j int) bool {
+			return waits[i] < waits[j]
+		})
+	}
+
+	for _, layer := range graph.GetDegreeZero() {
+		round := make([]uint, 0, len(layer))
+		for _, id := range layer {
+			if _, ok := position[id]; !ok {
+				round = append(round, id)
+			}
+		}
+		if len(round) > 0 {
+			plan.Rounds = append(plan.Rounds, round)
+		}
+	}
+	for i := range txs {
+		plan.Gas += weights[i]
+	}
+	for _, id := range plan.Hot {
+		plan.HotGas += weights[id]
+	}
+	return plan, nil
+}
+
+func (p *HotLanePlan) String() string {
+	hotKeys := 0
+	for _, state := range p.HotKeys {
+		hotKeys += len(state)
+	}
+	share := 0.0
+	if p.Gas > 0 {
+		share = float64(p.HotGas) / float64(p.Gas)
+	}
+	return fmt.Sprintf("Hot Keys: %d Hot Lane Txs: %d Rounds: %d Barrier Txs: %d Hot Lane Gas: %d / %d (%.2f)",
+		hotKeys, len(p.Hot), len(p.Rounds), len(p.Barrier), p.HotGas, p.Gas, share)
+}
+
+// ExecWithHotLane executes the serial lane of plan on a goroutine of its own while the rounds run in the pool,
+// both on fullcache. A lane position waits for the txs of the rounds of plan.Waits and a tx of the rounds
+// waits for the lane position of plan.After. The barrier txs are left to the caller. It returns the errors
+// and the gas used of each tx of the block, and the time the lane and the rounds took
+func ExecWithHotLane(pool *ants.Pool, plan *HotLanePlan, txs types.Transactions, fullcache *interactState.FullCacheConcurrent,
+	header *types.Header, chainCtx core.ChainContext, meter *BlockGasMeter) ([]error, []uint64, time.Duration, time.Duration, error) {
+	errs := make([]error, txs.Len())
+	gasUsed := make([]uint64, txs.Len())
+	hotTxs := GenerateTxToExec(plan.Hot, txs)
+	if err := meter.Admit(hotTxs); err != nil {
+		return errs, gasUsed, 0, 0, err
+	}
+
+	laneDone := make([]chan struct{}, len(plan.Hot))
+	for p := range laneDone {
+		laneDone[p] = make(chan struct{})
+	}
+	txDone := make(map[uint]chan struct{})
+	for _, round := range plan.Rounds {
+		for _, id := range round {
+			txDone[id] = make(chan struct{})
+		}
+	}
+	// the lane stops waiting for the rounds if they stop early
+	abort := make(chan struct{})
+
+	var hotTime time.Duration
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st := time.Now()
+		defer func() { hotTime = time.Since(st) }()
+		for p, id := range plan.Hot {
+			for _, waitid := range plan.Waits[p] {
+				select {
+				case <-txDone[waitid]:
+				case <-abort:
+					return
+				}
+			}
+			txErrs, txGasUsed := tracer.ExecuteTxs(interactState.NewConcurrentTxState(fullcache), types.Transactions{txs[id]}, header, chainCtx)
+			errs[id], gasUsed[id] = txErrs[0], txGasUsed[0]
+			close(laneDone[p])
+		}
+	}()
+	stop := func() {
+		close(abort)
+		<-done
+	}
+
+	var antsWG sync.WaitGroup
+	st := time.Now()
+	for _, round := range plan.Rounds {
+		txsToExec := GenerateTxToExec(round, txs)
+		if err := meter.Admit(txsToExec); err != nil {
+			stop()
+			return errs, gasUsed, hotTime, time.Since(st), err
+		}
+		var submitErr error
+		antsWG.Add(len(round))
+		for _, id := range round {
+			id := id
+			err := pool.Submit(func() {
+				defer antsWG.Done()
+				if p, ok := plan.After[id]; ok {
+					<-laneDone[p]
+				}
+				txErrs, txGasUsed := tracer.ExecuteTxs(interactState.NewConcurrentTxState(fullcache), types.Transactions{txs[id]}, header, chainCtx)
+				errs[id], gasUsed[id] = txErrs[0], txGasUsed[0]
+				close(txDone[id])
+			})
+			if err != nil {
+				// the later txs may depend on it, it can't be skipped
+				errs[id] = fmt.Errorf("submit tx %d: %w", id, err)
+				submitErr = errs[id]
+				close(txDone[id])
+				antsWG.Done()
+			}
+		}
+		antsWG.Wait()
+		if submitErr != nil {
+			stop()
+			return errs, gasUsed, hotTime, time.Since(st), submitErr
+		}
+		roundErrs := make([]error, len(round))
+		roundGasUsed := make([]uint64, len(round))
+		for k, id := range round {
+			roundErrs[k], roundGasUsed[k] = errs[id], gasUsed[id]
+		}
+		if err := meter.Commit(txsToExec, roundGasUsed, roundErrs); err != nil {
+			stop()
+			return errs, gasUsed, hotTime, time.Since(st), err
+		}
+	}
+	roundsTime := time.Since(st)
+	<-done
+
+	hotErrs := make([]error, len(plan.Hot))
+	hotGasUsed := make([]uint64, len(plan.Hot))
+	for k, id := range plan.Hot {
+		hotErrs[k], hotGasUsed[k] = errs[id], gasUsed[id]
+	}
+	return errs, gasUsed, hotTime, roundsTime, meter.Commit(hotTxs, hotGasUsed, hotErrs)
+}
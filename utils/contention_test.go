@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"errors"
+	"interact/accesslist"
+	"interact/core"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/panjf2000/ants/v2"
+)
+
+var testPayee = common.HexToAddress("0xbeef")
+
+func TestCountKeys(t *testing.T) {
+	rwSets := make(accesslist.RWSetList, 5)
+	for i := range rwSets {
+		rwSets[i] = accesslist.NewRWSet()
+	}
+	rwSets[0].AddReadSet(testContract, slot(0))
+	rwSets[0].AddWriteSet(testContract, slot(1))
+	// a delta alone, a delta over a read of the balance and a delta along with a write of it
+	rwSets[1].AddWriteSet(testPayee, accesslist.BALANCEDELTA)
+	rwSets[2].AddReadSet(testPayee, accesslist.BALANCE)
+	rwSets[2].AddWriteSet(testPayee, accesslist.BALANCEDELTA)
+	rwSets[3].AddWriteSet(testPayee, accesslist.BALANCE)
+	rwSets[3].AddWriteSet(testPayee, accesslist.BALANCEDELTA)
+	rwSets[4].AddReadSet(testContract, slot(1))
+	rwSets[4].AddWriteSet(testContract, slot(1))
+	rwSets = append(rwSets, nil)
+
+	counts := countKeys(rwSets)
+	balance := hotKey{testPayee, accesslist.BALANCE}
+	if counts.txs != 5 {
+		t.Fatalf("%d txs, want the 5 predicted", counts.txs)
+	}
+	if want := map[hotKey]int{{testContract, slot(0)}: 1, {testContract, slot(1)}: 2, balance: 3}; !reflect.DeepEqual(counts.touches, want) {
+		t.Fatalf("touches %v, want %v", counts.touches, want)
+	}
+	if want := map[hotKey]int{{testContract, slot(1)}: 2, balance: 1}; !reflect.DeepEqual(counts.writes, want) {
+		t.Fatalf("writes %v, want %v", counts.writes, want)
+	}
+	if want := map[hotKey]int{balance: 1}; !reflect.DeepEqual(counts.deltas, want) {
+		t.Fatalf("deltas %v, want %v", counts.deltas, want)
+	}
+}
+
+// contendedBlock is n txs touching slot 0 of testContract, the first writing it, and n txs adding to the balance of testPayee
+func contendedBlock(n int, hotSlot common.Hash) accesslist.RWSetList {
+	rwSets := make(accesslist.RWSetList, 0, 2*n)
+	for i := 0; i < n; i++ {
+		rwSet := accesslist.NewRWSet()
+		if i == 0 {
+			rwSet.AddWriteSet(testContract, hotSlot)
+		} else {
+			rwSet.AddReadSet(testContract, hotSlot)
+		}
+		rwSets = append(rwSets, rwSet)
+	}
+	for i := 0; i < n; i++ {
+		rwSet := accesslist.NewRWSet()
+		rwSet.AddWriteSet(testPayee, accesslist.BALANCEDELTA)
+		rwSets = append(rwSets, rwSet)
+	}
+	return rwSets
+}
+
+func TestHotKeys(t *testing.T) {
+	m := NewContentionManager(1, 0.4)
+	// half of the txs touch slot 0, the deltas commute
+	if hot, want := m.HotKeys(contendedBlock(4, slot(0))), (accesslist.ALTuple{testContract: {slot(0): struct{}{}}}); !reflect.DeepEqual(hot, want) {
+		t.Fatalf("hot keys %v, want %v", hot, want)
+	}
+	// a key read by every tx and written by none is not hot
+	readOnly := contendedBlock(4, slot(0))
+	readOnly[0] = accesslist.NewRWSet()
+	readOnly[0].AddReadSet(testContract, slot(0))
+	if hot := m.HotKeys(readOnly); len(hot) != 0 {
+		t.Fatalf("hot keys %v of a read only key", hot)
+	}
+	// a single tx is never contended
+	if hot := m.HotKeys(contendedBlock(1, slot(0))); len(hot) != 0 {
+		t.Fatalf("hot keys %v of a single tx", hot)
+	}
+
+	// slot 1 of the recent block is still hot with a quiet block, it is forgotten past the window
+	m.Observe(contendedBlock(4, slot(1)))
+	quiet := contendedBlock(4, slot(2))[4:]
+	if hot := m.HotKeys(quiet); !hot.Contains(testContract, slot(1)) || len(hot[testContract]) != 1 {
+		t.Fatalf("hot keys %v, want slot 1 of the window", hot)
+	}
+	m.Observe(quiet)
+	if hot := m.HotKeys(quiet); len(hot) != 0 {
+		t.Fatalf("hot keys %v past the window", hot)
+	}
+}
+
+func TestPlanHotLane(t *testing.T) {
+	// 1 and 2 are hot, 0 is ordered before the lane, 3 after 0, 4 after the lane, 5 apart and 6 unpredicted
+	txs := meterTxs(21000, 21000, 21000, 21000, 21000, 21000, 21000)
+	rwSets := make(accesslist.RWSetList, txs.Len())
+	for i := 0; i < 6; i++ {
+		rwSets[i] = accesslist.NewRWSet()
+	}
+	rwSets[0].AddWriteSet(testContract, slot(1))
+	rwSets[1].AddReadSet(testContract, slot(1))
+	rwSets[1].AddWriteSet(testContract, slot(0))
+	rwSets[2].AddWriteSet(testContract, slot(0))
+	rwSets[2].AddWriteSet(testContract, slot(10))
+	rwSets[3].AddReadSet(testContract, slot(1))
+	rwSets[4].AddReadSet(testContract, slot(10))
+	rwSets[5].AddWriteSet(testContract, slot(20))
+	hot := accesslist.ALTuple{testContract: {slot(0): struct{}{}}}
+
+	plan, err := PlanHotLane(txs, rwSets, hot, []uint64{10, 20, 30, 40, 50, 60, 70})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{1, 2}; !reflect.DeepEqual(plan.Hot, want) {
+		t.Fatalf("lane %v, want only the hot txs %v", plan.Hot, want)
+	}
+	if want := [][]uint{{0, 5}, {3}, {4}}; !reflect.DeepEqual(plan.Rounds, want) {
+		t.Fatalf("rounds %v, want %v", plan.Rounds, want)
+	}
+	if want := map[uint]int{4: 1}; !reflect.DeepEqual(plan.After, want) {
+		t.Fatalf("after %v, want tx 4 after lane position 1", plan.After)
+	}
+	if want := [][]uint{{0}, nil}; !reflect.DeepEqual(plan.Waits, want) {
+		t.Fatalf("waits %v, want lane position 0 waiting for tx 0", plan.Waits)
+	}
+	if !reflect.DeepEqual(plan.Barrier, []uint{6}) {
+		t.Fatalf("barrier %v, want tx 6", plan.Barrier)
+	}
+	if plan.HotGas != 50 || plan.Gas != 280 {
+		t.Fatalf("hot gas %d of %d, want 50 of 280", plan.HotGas, plan.Gas)
+	}
+
+	// without hot keys the rounds are the in-degree layers
+	plan, err = PlanHotLane(txs, rwSets, accesslist.ALTuple{}, uniformWeights(txs.Len(), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rounds, err := GenerateDegreeZeroGroups(txs, rwSets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Hot) != 0 || len(plan.After) != 0 || plan.HotGas != 0 || !reflect.DeepEqual(plan.Rounds, rounds) {
+		t.Fatalf("plan %v rounds %v, want the layers %v", plan, plan.Rounds, rounds)
+	}
+}
+
+func TestExecWithHotLane(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	for _, mode := range []core.TransferMode{core.TransferStrict, core.TransferDelta} {
+		core.SetTransferMode(mode)
+		env := newExecEnv(t)
+		txs, payees := env.chainBlock()
+		rwSets, serial := env.serialRWSets(t, txs)
+		block := types.NewBlockWithHeader(env.header).WithBody(txs, nil)
+
+		// on 0xbeef the later txs of sender 0 wait for the lane, on 0xcafe the lane waits for them
+		for _, payee := range payees[:2] {
+			plan, err := PlanHotLane(txs, rwSets, accesslist.ALTuple{payee: {accesslist.BALANCE: struct{}{}}}, uniformWeights(txs.Len(), 21000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan.Hot) != 1 || len(plan.After)+len(plan.Waits[0]) == 0 {
+				t.Fatalf("mode %v payee %v: lane %v after %v waits %v, want one hot tx ordered with the rounds", mode, payee, plan.Hot, plan.After, plan.Waits)
+			}
+
+			pool, _ := ants.NewPool(4)
+			fullcache := PrepareFullCache(env.statedb.Copy(), block, env.chainCtx, nil, rwSets)
+			meter := NewBlockGasMeter(txs, env.header)
+			errs, gasUsed, _, _, err := ExecWithHotLane(pool, plan, txs, fullcache, env.header, env.chainCtx, meter)
+			pool.Release()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range errs {
+				if errs[i] != nil || gasUsed[i] == 0 {
+					t.Fatalf("mode %v payee %v tx %d: err %v, gas used %d", mode, payee, i, errs[i], gasUsed[i])
+				}
+			}
+			if err := meter.Check(); err != nil {
+				t.Fatal(err)
+			}
+			for _, addr := range append(payees, testSender(0), testSender(1), testSender(2), testSender(3)) {
+				if fullcache.GetBalance(addr).Cmp(serial.GetBalance(addr)) != 0 || fullcache.GetNonce(addr) != serial.GetNonce(addr) {
+					t.Fatalf("mode %v payee %v account %v: balance %v nonce %d, serial %v nonce %d", mode, payee, addr,
+						fullcache.GetBalance(addr), fullcache.GetNonce(addr), serial.GetBalance(addr), serial.GetNonce(addr))
+				}
+			}
+		}
+	}
+}
+
+func TestExecWithHotLaneSubmitError(t *testing.T) {
+	env := newExecEnv(t)
+	txs, payees := env.chainBlock()
+	rwSets, _ := env.serialRWSets(t, txs)
+	// the lane waits for the txs of the rounds that fail to be submitted, it must not hang
+	plan, err := PlanHotLane(txs, rwSets, accesslist.ALTuple{payees[1]: {accesslist.BALANCE: struct{}{}}}, uniformWeights(txs.Len(), 21000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullcache := PrepareFullCache(env.statedb.Copy(), types.NewBlockWithHeader(env.header).WithBody(txs, nil), env.chainCtx, nil, rwSets)
+	pool, _ := ants.NewPool(4)
+	pool.Release()
+	if _, _, _, _, err := ExecWithHotLane(pool, plan, txs, fullcache, env.header, env.chainCtx, NewBlockGasMeter(txs, env.header)); !errors.Is(err, ants.ErrPoolClosed) {
+		t.Fatalf("err %v, want %v", err, ants.ErrPoolClosed)
+	}
+}
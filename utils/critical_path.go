@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"container/heap"
+	"fmt"
+	"interact/accesslist"
+	conflictgraph "interact/conflictGraph"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/panjf2000/ants/v2"
+)
+
+// CriticalPathSchedule is a list schedule over the directed conflict graph,
+// a ready tx with the heaviest remaining path is dispatched first
+type CriticalPathSchedule struct {
+	Graph    *conflictgraph.DirectedGraph
+	Priority map[uint]uint64 // the heaviest path starting from each tx
+	Bound    uint64          // the heaviest path of the block, no schedule takes less gas
+	Total    uint64          // the gas of all the scheduled txs
+}
+
+// TxGasWeights weights the txs of block by the gas they used, read from the receipts,
+// the gas limits are used instead if the receipts are missing
+func TxGasWeights(chainDB ethdb.Database, block *types.Block, config *params.ChainConfig) []uint64 {
+	txs := block.Transactions()
+	weights := make([]uint64, txs.Len())
+	receipts := rawdb.ReadReceipts(chainDB, block.Hash(), block.NumberU64(), block.Time(), config)
+	for i, tx := range txs {
+		if len(receipts) == txs.Len() {
+			weights[i] = receipts[i].GasUsed
+		} else {
+			weights[i] = tx.Gas()
+		}
+	}
+	return weights
+}
+
+func GenerateCriticalPathSchedule(txs types.Transactions, predictRWSets accesslist.RWSetList, weights []uint64) *CriticalPathSchedule {
+	graph := generateDiGraph(txs, predictRWSets)
+	priority, bound := graph.CriticalPath(func(id uint) uint64 {
+		return weights[id]
+	})
+	total := uint64(0)
+	for id := range graph.Vertices {
+		total += weights[id]
+	}
+	return &CriticalPathSchedule{
+		Graph:    graph,
+		Priority: priority,
+		Bound:    bound,
+		Total:    total,
+	}
+}
+
+// TimeBound is the critical path of the schedule weighted by the measured execution time of each tx
+func (s *CriticalPathSchedule) TimeBound(durations []time.Duration) time.Duration {
+	_, bound := s.Graph.CriticalPath(func(id uint) uint64 {
+		return uint64(durations[id])
+	})
+	return time.Duration(bound)
+}
+
+// readyQueue is a max heap of the ready txs by priority, the earlier tx first on ties
+type readyQueue struct {
+	ids      []uint
+	priority map[uint]uint64
+}
+
+func (q *readyQueue) Len() int { return len(q.ids) }
+func (q *readyQueue) Less(i, j int) bool {
+	pi, pj := q.priority[q.ids[i]], q.priority[q.ids[j]]
+	if pi != pj {
+		return pi > pj
+	}
+	return q.ids[i] < q.ids[j]
+}
+func (q *readyQueue) Swap(i, j int) { q.ids[i], q.ids[j] = q.ids[j], q.ids[i] }
+func (q *readyQueue) Push(x any)    { q.ids = append(q.ids, x.(uint)) }
+func (q *readyQueue) Pop() any {
+	old := q.ids
+	n := len(old)
+	id := old[n-1]
+	q.ids = old[:n-1]
+	return id
+}
+
+// ExecWithCriticalPath executes the scheduled txs on fullcache without round barriers:
+// a tx is dispatched to the pool as soon as all its predecessors have committed,
+// and at most pool.Cap() txs are in flight so that the priority decides which ready tx runs next.
+// It returns the errors, the gas used and the execution time of each tx of the block
+func ExecWithCriticalPath(pool *ants.Pool, s *CriticalPathSchedule, txs types.Transactions, fullcache *interactState.FullCacheConcurrent,
+	header *types.Header, chainCtx core.ChainContext, meter *BlockGasMeter) ([]error, []uint64, []time.Duration, error) {
+	errs := make([]error, txs.Len())
+	gasUsed := make([]uint64, txs.Len())
+	durations := make([]time.Duration, txs.Len())
+
+	inDegree := make(map[uint]uint, len(s.Graph.Vertices))
+	ready := &readyQueue{priority: s.Priority}
+	for id, v := range s.Graph.Vertices {
+		inDegree[id] = v.Degree
+		if v.Degree == 0 {
+			heap.Push(ready, id)
+		}
+	}
+	done := make(chan uint, len(s.Graph.Vertices))
+	inFlight, remaining := 0, len(s.Graph.Vertices)
+	// the txs in flight write into errs, gasUsed and fullcache, so they are waited for before returning early
+	abort := func(err error) ([]error, []uint64, []time.Duration, error) {
+		for ; inFlight > 0; inFlight-- {
+			<-done
+		}
+		return errs, gasUsed, durations, err
+	}
+	for remaining > 0 {
+		for ready.Len() > 0 && inFlight < pool.Cap() {
+			id := heap.Pop(ready).(uint)
+			if err := meter.Admit(types.Transactions{txs[id]}); err != nil {
+				return abort(err)
+			}
+			err := pool.Submit(func() {
+				st := time.Now()
+				txErrs, txGasUsed := tracer.ExecuteTxs(interactState.NewConcurrentTxState(fullcache), types.Transactions{txs[id]}, header, chainCtx)
+				errs[id], gasUsed[id], durations[id] = txErrs[0], txGasUsed[0], time.Since(st)
+				done <- id
+			})
+			if err != nil {
+				// the later txs may depend on it, it can't be skipped
+				errs[id] = fmt.Errorf("submit tx %d: %w", id, err)
+				return abort(errs[id])
+			}
+			inFlight++
+		}
+		id := <-done
+		inFlight--
+		remaining--
+		if err := meter.Commit(types.Transactions{txs[id]}, gasUsed[id:id+1], errs[id:id+1]); err != nil {
+			return abort(err)
+		}
+		for neighborid := range s.Graph.AdjacencyMap[id] {
+			inDegree[neighborid]--
+			if inDegree[neighborid] == 0 {
+				heap.Push(ready, neighborid)
+			}
+		}
+	}
+	return errs, gasUsed, durations, nil
+}
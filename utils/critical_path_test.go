@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"errors"
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/panjf2000/ants/v2"
+)
+
+// serialRWSets executes txs one after another on a copy of the state, it returns their rw sets and the post state
+func (env *execEnv) serialRWSets(t *testing.T, txs types.Transactions) (accesslist.RWSetList, *ethState.StateDB) {
+	serial := env.statedb.Copy()
+	rwSets := make(accesslist.RWSetList, txs.Len())
+	for i, tx := range txs {
+		fulldb := interactState.NewStateWithRwSets(serial)
+		rwSets[i] = accesslist.NewRWSet()
+		fulldb.SetRWSet(rwSets[i])
+		if errs, _ := tracer.ExecuteTxs(fulldb, types.Transactions{tx}, env.header, env.chainCtx); errs[0] != nil {
+			t.Fatalf("serial tx %d: %v", i, errs[0])
+		}
+	}
+	return rwSets, serial
+}
+
+// chainBlock is a chain of transfers over payee 0xbeef and 0xcafe, and two txs apart from it
+func (env *execEnv) chainBlock() (types.Transactions, []common.Address) {
+	payees := []common.Address{common.HexToAddress("0xbeef"), common.HexToAddress("0xcafe"), common.HexToAddress("0xf00d")}
+	return types.Transactions{
+		env.call(0, 0, payees[0], 1, nil),
+		env.call(1, 0, payees[2], 2, nil),
+		env.call(2, 0, testSender(0), 3, nil),
+		env.call(0, 1, payees[1], 4, nil),
+		env.call(3, 0, payees[2], 5, nil),
+	}, payees
+}
+
+func TestGenerateCriticalPathSchedule(t *testing.T) {
+	// 0 -> 1 -> 3 and 2 -> 3 on the slots, 4 apart
+	txs := meterTxs(21000, 21000, 21000, 21000, 21000)
+	rwSets := make(accesslist.RWSetList, txs.Len())
+	for i := range rwSets {
+		rwSets[i] = accesslist.NewRWSet()
+	}
+	rwSets[0].AddWriteSet(testContract, slot(0))
+	rwSets[1].AddReadSet(testContract, slot(0))
+	rwSets[1].AddWriteSet(testContract, slot(1))
+	rwSets[2].AddWriteSet(testContract, slot(2))
+	rwSets[3].AddReadSet(testContract, slot(1))
+	rwSets[3].AddReadSet(testContract, slot(2))
+	rwSets[4].AddWriteSet(testContract, slot(4))
+	weights := []uint64{10, 20, 100, 30, 50}
+
+	s := GenerateCriticalPathSchedule(txs, rwSets, weights)
+	if s.Total != 210 {
+		t.Fatalf("total %d, want 210", s.Total)
+	}
+	if s.Bound != 130 {
+		t.Fatalf("bound %d, want 130, the path 2 -> 3", s.Bound)
+	}
+	for id, want := range map[uint]uint64{0: 60, 1: 50, 2: 130, 3: 30, 4: 50} {
+		if s.Priority[id] != want {
+			t.Fatalf("priority of tx %d is %d, want %d", id, s.Priority[id], want)
+		}
+	}
+}
+
+func TestExecWithCriticalPath(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	for _, mode := range []core.TransferMode{core.TransferStrict, core.TransferDelta} {
+		core.SetTransferMode(mode)
+		env := newExecEnv(t)
+		txs, payees := env.chainBlock()
+		rwSets, serial := env.serialRWSets(t, txs)
+
+		pool, _ := ants.NewPool(4)
+		fullcache := PrepareFullCache(env.statedb.Copy(), types.NewBlockWithHeader(env.header).WithBody(txs, nil), env.chainCtx, nil, rwSets)
+		meter := NewBlockGasMeter(txs, env.header)
+		s := GenerateCriticalPathSchedule(txs, rwSets, []uint64{21000, 21000, 21000, 21000, 21000})
+		errs, gasUsed, _, err := ExecWithCriticalPath(pool, s, txs, fullcache, env.header, env.chainCtx, meter)
+		pool.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range errs {
+			if errs[i] != nil || gasUsed[i] == 0 {
+				t.Fatalf("mode %v tx %d: err %v, gas used %d", mode, i, errs[i], gasUsed[i])
+			}
+		}
+		if err := meter.Check(); err != nil {
+			t.Fatal(err)
+		}
+		for _, addr := range append(payees, testSender(0), testSender(1), testSender(2), testSender(3)) {
+			if fullcache.GetBalance(addr).Cmp(serial.GetBalance(addr)) != 0 || fullcache.GetNonce(addr) != serial.GetNonce(addr) {
+				t.Fatalf("mode %v account %v: balance %v nonce %d, serial %v nonce %d", mode, addr,
+					fullcache.GetBalance(addr), fullcache.GetNonce(addr), serial.GetBalance(addr), serial.GetNonce(addr))
+			}
+		}
+	}
+}
+
+func TestExecWithCriticalPathSubmitError(t *testing.T) {
+	env := newExecEnv(t)
+	txs, _ := env.chainBlock()
+	rwSets, _ := env.serialRWSets(t, txs)
+	fullcache := PrepareFullCache(env.statedb.Copy(), types.NewBlockWithHeader(env.header).WithBody(txs, nil), env.chainCtx, nil, rwSets)
+	meter := NewBlockGasMeter(txs, env.header)
+	s := GenerateCriticalPathSchedule(txs, rwSets, []uint64{21000, 21000, 21000, 21000, 21000})
+
+	pool, _ := ants.NewPool(4)
+	pool.Release()
+	errs, gasUsed, _, err := ExecWithCriticalPath(pool, s, txs, fullcache, env.header, env.chainCtx, meter)
+	if !errors.Is(err, ants.ErrPoolClosed) {
+		t.Fatalf("err %v, want %v", err, ants.ErrPoolClosed)
+	}
+	failed := 0
+	for i := range errs {
+		if errs[i] != nil {
+			failed++
+		}
+		if gasUsed[i] != 0 {
+			t.Fatalf("tx %d used %d gas in a closed pool", i, gasUsed[i])
+		}
+	}
+	// the tx failing to submit is not committed as a success
+	if failed != 1 || meter.GasUsed() != 0 || meter.Check() == nil {
+		t.Fatalf("%d txs failed, gas used %d, want the failed tx recorded and nothing accounted", failed, meter.GasUsed())
+	}
+}
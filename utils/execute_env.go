@@ -3,14 +3,15 @@ package utils
 import (
 	"fmt"
 	"interact/accesslist"
+	"interact/coloring"
 	conflictgraph "interact/conflictGraph"
 	"interact/core"
 	interactState "interact/state"
 	"interact/tracer"
 	"sort"
 	"sync"
+	"time"
 
-	"github.com/ethereum/go-ethereum/core/rawdb"
 	ethState "github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -20,37 +21,77 @@ import (
 
 // PredictRWSets predict a tx rwsets in a block with accesslist
 func PredictRWSets(tx *types.Transaction, chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) *accesslist.RWSet {
-
-	baseHeadHash := rawdb.ReadCanonicalHash(chainDB, num-1)
-	baseHeader := rawdb.ReadHeader(chainDB, baseHeadHash, num-1)
-
-	state, err := ethState.New(baseHeader.Root, sdbBackend, nil)
+	list, err := PredictRWSetsWithStaleState(tx, chainDB, sdbBackend, num, 0)
 	if err != nil {
 		panic(err)
 	}
+	return list
+}
+
+// PredictRWSetsWithStaleState predict a tx rwsets in block[num] with the state of block[num-1-k],
+// k = 0 means the exact parent state of the block. It fails with ErrMissingState if that state is not retained
+func PredictRWSetsWithStaleState(tx *types.Transaction, chainDB ethdb.Database, sdbBackend ethState.Database, num, k uint64) (*accesslist.RWSet, error) {
+	state, err := GetState(chainDB, sdbBackend, num-1-k)
+	if err != nil {
+		return nil, err
+	}
 	fulldb := interactState.NewStateWithRwSets(state)
 
-	headHash := rawdb.ReadCanonicalHash(chainDB, num)
-	header := rawdb.ReadHeader(chainDB, headHash, num)
+	_, header := GetBlockAndHeader(chainDB, num)
 	fakeChainCtx := core.NewFakeChainContext(chainDB)
 	list, err := tracer.ExecToGenerateRWSet(fulldb, tx, header, fakeChainCtx)
 	if err != nil {
 		fmt.Println("NIL tx hash:", tx.Hash())
 	}
-	return list
+	return list, nil
+}
+
+// PredictRWSetsWithPendingTxs predict the rwsets of txs in block[num] with the state of block[num-1-k]
+// plus the pending txs, i.e. each tx is executed after all the txs ahead of it on the same stale state.
+// It fails with ErrMissingState if that state is not retained
+func PredictRWSetsWithPendingTxs(txs types.Transactions, chainDB ethdb.Database, sdbBackend ethState.Database, num, k uint64) (accesslist.RWSetList, error) {
+	state, err := GetState(chainDB, sdbBackend, num-1-k)
+	if err != nil {
+		return nil, err
+	}
+	fulldb := interactState.NewStateWithRwSets(state)
+
+	_, header := GetBlockAndHeader(chainDB, num)
+	fakeChainCtx := core.NewFakeChainContext(chainDB)
+	lists, errs := tracer.CreateRWSetsWithTransactions(fulldb, txs, header, fakeChainCtx)
+	for i, err := range errs {
+		if err != nil {
+			fmt.Println("NIL tx hash:", txs[i].Hash())
+		}
+	}
+	return lists, nil
+}
+
+// schedulable reports the txs to be put in the conflict graph, a tx can't be scheduled
+// without a prediction or if an earlier tx of the same sender can't
+func schedulable(predictRWSets []*accesslist.RWSet, prev map[uint]uint) []bool {
+	ok := make([]bool, len(predictRWSets))
+	for i := range predictRWSets {
+		ok[i] = predictRWSets[i] != nil
+		if p, has := prev[uint(i)]; has && !ok[p] {
+			ok[i] = false
+		}
+	}
+	return ok
 }
 
 func generateUndiGraph(txs types.Transactions, predictRWSets []*accesslist.RWSet) *conflictgraph.UndirectedGraph {
 	undiConfGraph := conflictgraph.NewUndirectedGraph()
+	ok := schedulable(predictRWSets, senderPredecessors(txs))
 	for i, tx := range txs {
-		if predictRWSets[i] == nil {
+		if !ok[i] {
 			continue
 		}
 		undiConfGraph.AddVertex(tx.Hash(), uint(i))
 	}
 	for i := 0; i < txs.Len(); i++ {
 		for j := i + 1; j < txs.Len(); j++ {
-			if predictRWSets[i] == nil || predictRWSets[j] == nil {
+			if !ok[i] || !ok[j] {
 				continue
 			}
 			if predictRWSets[i].HasConflict(*predictRWSets[j]) {
@@ -58,6 +99,12 @@ func generateUndiGraph(txs types.Transactions, predictRWSets []*accesslist.RWSet
 			}
 		}
 	}
+	// same-sender txs conflict on the nonce even if the predictions miss it
+	for i, p := range senderPredecessors(txs) {
+		if ok[i] {
+			undiConfGraph.AddEdge(p, i)
+		}
+	}
 	return undiConfGraph
 }
 
@@ -108,7 +155,7 @@ func GetTxsPredictsAndHeaders(chainDB ethdb.Database, sdbBackend ethState.Databa
 	return txs, predictRWSets, headers
 }
 
-func GenerateTxAndRWSetGroups(txs types.Transactions, predictRWSets accesslist.RWSetList) ([]types.Transactions, []accesslist.RWSetList) {
+func GenerateTxAndRWSetGroups(txs types.Transactions, predictRWSets accesslist.RWSetList) ([]types.Transactions, []accesslist.RWSetList, error) {
 	vertexGroup := generateVertexGroups(txs, predictRWSets)
 	// From vertex group to transaction group
 	txsGroup := make([]types.Transactions, len(vertexGroup))
@@ -123,25 +170,79 @@ func GenerateTxAndRWSetGroups(txs types.Transactions, predictRWSets accesslist.R
 			RWSetsGroup[i] = append(RWSetsGroup[i], predictRWSets[vertexGroup[i][j].TxId])
 		}
 	}
-	return txsGroup, RWSetsGroup
+	if err := ValidateGroupOrder(txs, txsGroup); err != nil {
+		return nil, nil, err
+	}
+	return txsGroup, RWSetsGroup, nil
+}
+
+func GenerateMISGroups(txs types.Transactions, predictRWSets accesslist.RWSetList) ([][]uint, error) {
+	undiGraph := generateUndiGraph(txs, predictRWSets)
+	groups := solveMISInTurn(undiGraph, senderPredecessors(txs))
+	if err := ValidateRoundOrder(txs, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GenerateOrderedMISGroups is GenerateMISGroups preserving the block order,
+// a tx runs after all the earlier txs conflicting with it
+func GenerateOrderedMISGroups(txs types.Transactions, predictRWSets accesslist.RWSetList) ([][]uint, error) {
+	undiGraph := generateUndiGraph(txs, predictRWSets)
+	groups := solveOrderedMISInTurn(undiGraph)
+	if err := ValidateRoundOrder(txs, groups); err != nil {
+		return nil, err
+	}
+	if err := ValidateConflictOrder(predictRWSets, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
 }
 
-func GenerateMISGroups(txs types.Transactions, predictRWSets accesslist.RWSetList) [][]uint {
+// GenerateWeightedMISGroups is GenerateMISGroups with the gas as weights, each round takes the
+// maximum weight set of non-conflicting txs, so the expensive txs run in the first rounds
+func GenerateWeightedMISGroups(txs types.Transactions, predictRWSets accesslist.RWSetList, weights []uint64, budget time.Duration) ([][]uint, error) {
 	undiGraph := generateUndiGraph(txs, predictRWSets)
-	return solveMISInTurn(undiGraph)
+	weightOf := make(map[uint]uint64, len(weights))
+	for id, w := range weights {
+		weightOf[uint(id)] = w
+	}
+	groups := solveWeightedMISInTurn(undiGraph, senderPredecessors(txs), weightOf, budget)
+	if err := ValidateRoundOrder(txs, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// ConflictGraph is the undirected conflict graph of the schedulable txs
+func ConflictGraph(txs types.Transactions, predictRWSets accesslist.RWSetList) *conflictgraph.UndirectedGraph {
+	return generateUndiGraph(txs, predictRWSets)
+}
+
+// GenerateColoringGroups colors the conflict graph once instead of solving a MIS per round,
+// the rounds come in the same form as GenerateMISGroups
+func GenerateColoringGroups(txs types.Transactions, predictRWSets accesslist.RWSetList, solve coloring.Coloring) ([][]uint, error) {
+	undiGraph := generateUndiGraph(txs, predictRWSets)
+	groups := solve(undiGraph, senderPredecessors(txs))
+	if err := ValidateRoundOrder(txs, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
 }
 
 func generateDiGraph(txs types.Transactions, predictRWSets []*accesslist.RWSet) *conflictgraph.DirectedGraph {
 	Graph := conflictgraph.NewDirectedGraph()
+	prev := senderPredecessors(txs)
+	ok := schedulable(predictRWSets, prev)
 	for i, tx := range txs {
-		if predictRWSets[i] == nil {
+		if !ok[i] {
 			continue
 		}
 		Graph.AddVertex(tx.Hash(), uint(i))
 	}
 	for i := 0; i < txs.Len(); i++ {
 		for j := i + 1; j < txs.Len(); j++ {
-			if predictRWSets[i] == nil || predictRWSets[j] == nil {
+			if !ok[i] || !ok[j] {
 				continue
 			}
 			if predictRWSets[i].HasConflict(*predictRWSets[j]) {
@@ -149,12 +250,21 @@ func generateDiGraph(txs types.Transactions, predictRWSets []*accesslist.RWSet)
 			}
 		}
 	}
+	for i, p := range prev {
+		if ok[i] {
+			Graph.AddEdge(p, i)
+		}
+	}
 	return Graph
 }
 
-func GenerateDegreeZeroGroups(txs types.Transactions, predictRWSets []*accesslist.RWSet) [][]uint {
+func GenerateDegreeZeroGroups(txs types.Transactions, predictRWSets []*accesslist.RWSet) ([][]uint, error) {
 	graph := generateDiGraph(txs, predictRWSets)
-	return graph.GetDegreeZero()
+	groups := graph.GetDegreeZero()
+	if err := ValidateRoundOrder(txs, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
 }
 
 func GenerateCacheStates(db vm.StateDB, RWSetsGroups []accesslist.RWSetList) interactState.CacheStateList {
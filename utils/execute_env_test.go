@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"errors"
+	"interact/accesslist"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// pointerCode reads slot 0 of itself and then the slot it points to
+var pointerCode = common.FromHex("0x6000545400")
+
+// staleChain is block num on a chain whose last two states are retained: slot 0 of testContract is 1
+// after block num-2 and 2 after block num-1, the state after block num-3 is pruned
+func staleChain(t *testing.T, num uint64) (ethdb.Database, ethState.Database) {
+	chainDB := rawdb.NewMemoryDatabase()
+	sdbBackend := ethState.NewDatabase(chainDB)
+	writeHeader := func(number uint64, root common.Hash) {
+		header := &types.Header{
+			Number:     new(big.Int).SetUint64(number),
+			Time:       1690000000 + number,
+			Difficulty: common.Big0,
+			BaseFee:    big.NewInt(params.GWei),
+			GasLimit:   30000000,
+			Coinbase:   testCoinbase,
+			Root:       root,
+		}
+		rawdb.WriteHeader(chainDB, header)
+		rawdb.WriteCanonicalHash(chainDB, header.Hash(), number)
+	}
+
+	root := types.EmptyRootHash
+	for _, value := range []int64{1, 2} {
+		statedb, err := ethState.New(root, sdbBackend, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statedb.SetBalance(testSender(0), big.NewInt(params.Ether))
+		statedb.SetCode(testContract, pointerCode)
+		statedb.SetState(testContract, slot(0), common.BigToHash(big.NewInt(value)))
+		if root, err = statedb.Commit(num-3+uint64(value), true); err != nil {
+			t.Fatal(err)
+		}
+		writeHeader(num-3+uint64(value), root)
+	}
+	writeHeader(num-3, common.HexToHash("0x01"))
+	writeHeader(num, common.Hash{})
+	return chainDB, sdbBackend
+}
+
+func TestPredictRWSetsWithStaleState(t *testing.T) {
+	const num = 18000000
+	chainDB, sdbBackend := staleChain(t, num)
+	txs := types.Transactions{newExecEnv(t).call(0, 0, testContract, 0, nil)}
+
+	// the parent state points to slot 2, the state before it to slot 1
+	for k, pointed := range []int{2, 1} {
+		rwSet, err := PredictRWSetsWithStaleState(txs[0], chainDB, sdbBackend, num, uint64(k))
+		if err != nil {
+			t.Fatalf("k = %d: %v", k, err)
+		}
+		pending, err := PredictRWSetsWithPendingTxs(txs, chainDB, sdbBackend, num, uint64(k))
+		if err != nil {
+			t.Fatalf("k = %d: %v", k, err)
+		}
+		for _, list := range []*accesslist.RWSet{rwSet, pending[0]} {
+			if !list.ReadSet.Contains(testContract, slot(pointed)) || list.ReadSet.Contains(testContract, slot(3-pointed)) {
+				t.Fatalf("k = %d: read set %v, want slot %d", k, list.ReadSet[testContract], pointed)
+			}
+		}
+	}
+	if rwSet := PredictRWSets(txs[0], chainDB, sdbBackend, num); !rwSet.ReadSet.Contains(testContract, slot(2)) {
+		t.Fatalf("read set %v, want slot 2 of the parent state", rwSet.ReadSet[testContract])
+	}
+
+	// the pruned state and the state before the chain are missing, they don't panic
+	for _, k := range []uint64{2, 3} {
+		if _, err := PredictRWSetsWithStaleState(txs[0], chainDB, sdbBackend, num, k); !errors.Is(err, ErrMissingState) {
+			t.Fatalf("k = %d: %v, want %v", k, err, ErrMissingState)
+		}
+		if _, err := PredictRWSetsWithPendingTxs(txs, chainDB, sdbBackend, num, k); !errors.Is(err, ErrMissingState) {
+			t.Fatalf("k = %d: %v, want %v", k, err, ErrMissingState)
+		}
+	}
+}
@@ -3,25 +3,32 @@ package utils
 import (
 	"fmt"
 	"interact/state"
+	"sort"
 	"sync"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/panjf2000/ants/v2"
 )
 
 // MergeToState merge all cacheState to fullstate.State
-func MergeToState(cacheStates state.CacheStateList, db state.StateInterface) {
+// a cacheState with an invalid balance delta is not merged, and its error is returned
+func MergeToState(cacheStates state.CacheStateList, db state.StateInterface) []error {
+	errs := make([]error, len(cacheStates))
 	for i := 0; i < len(cacheStates); i++ {
-		cacheStates[i].MergeState(db)
+		errs[i] = cacheStates[i].MergeState(db)
 	}
+	return errs
 }
 
 // MergeToStateConcurrent merge all cacheState to origin FullCacheConcurrent concurrently
-func MergeToCacheStateConcurrent(pool *ants.Pool, cacheStates state.CacheStateList, db *state.FullCacheConcurrent, wg *sync.WaitGroup) {
+func MergeToCacheStateConcurrent(pool *ants.Pool, cacheStates state.CacheStateList, db *state.FullCacheConcurrent, wg *sync.WaitGroup) []error {
+	errs := make([]error, len(cacheStates))
 	wg.Add(len(cacheStates))
 	for i := 0; i < len(cacheStates); i++ {
 		index := i
 		err := pool.Submit(func() {
-			cacheStates[index].MergeState(db)
+			errs[index] = cacheStates[index].MergeState(db)
 			wg.Done() // Mark the task as completed
 		})
 		if err != nil {
@@ -30,4 +37,38 @@ func MergeToCacheStateConcurrent(pool *ants.Pool, cacheStates state.CacheStateLi
 		}
 	}
 	wg.Wait()
+	return errs
+}
+
+// FailedGroups returns the txs of the groups failing to merge in block order.
+// A failed merge merges nothing, so they are executed again one after another like the barrier txs, see ExecBarrierRound
+func FailedGroups(txs types.Transactions, groups []types.Transactions, mergeErrs []error) []uint {
+	index := make(map[common.Hash]uint, len(txs))
+	for i, tx := range txs {
+		index[tx.Hash()] = uint(i)
+	}
+	failed := make([]uint, 0)
+	for i, group := range groups {
+		if mergeErrs[i] == nil {
+			continue
+		}
+		for _, tx := range group {
+			failed = append(failed, index[tx.Hash()])
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i] < failed[j]
+	})
+	return failed
+}
+
+// FailedRound returns the txs of round failing to merge, each tx of the round merged on its own
+func FailedRound(round []uint, mergeErrs []error) []uint {
+	failed := make([]uint, 0)
+	for k, id := range round {
+		if mergeErrs[k] != nil {
+			failed = append(failed, id)
+		}
+	}
+	return failed
 }
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// PrepareBlock applies what comes ahead of the txs of block, i.e. the EIP-4788 beacon root system call
+func PrepareBlock(statedb interactState.StateInterface, block *types.Block, chainCtx core.ChainContext) {
+	header := block.Header()
+	if header.ParentBeaconRoot == nil {
+		return
+	}
+	evm := vm.NewEVM(core.NewEVMBlockContext(header, chainCtx, &header.Coinbase), vm.TxContext{}, statedb, chainCtx.Config(), vm.Config{})
+	core.ProcessBeaconBlockRoot(*header.ParentBeaconRoot, evm, statedb)
+}
+
+// FinalizeBlock applies what follows the txs of block on the merged state, in consensus order:
+// the ethash block and uncle rewards before the merge, the withdrawals after it. A clique block has neither
+func FinalizeBlock(statedb interactState.StateInterface, block *types.Block, chainCtx core.ChainContext) {
+	header := block.Header()
+	config := chainCtx.Config()
+	if config.Ethash != nil && !isPoSHeader(config, header) {
+		core.AccumulateRewards(config, statedb, header, block.Uncles())
+		return
+	}
+	core.ProcessWithdrawals(statedb, block.Withdrawals())
+}
+
+// isPoSHeader reports whether header is past the merge, as the beacon engine tells it: the chain has a terminal
+// total difficulty and the header has no difficulty
+func isPoSHeader(config *params.ChainConfig, header *types.Header) bool {
+	return config.TerminalTotalDifficulty != nil && header.Difficulty.Sign() == 0
+}
+
+// PrepareFullCache applies PrepareBlock on state and prefetches rwSets and the accesses of FinalizeBlock into a new cache.
+// The beacon root system call comes ahead of the txs, so it is applied before prefetching.
+// The cache reads through warm, nil for none, see InvalidatePrepare and InvalidateBlock
+func PrepareFullCache(state *ethState.StateDB, block *types.Block, chainCtx core.ChainContext, warm *interactState.WarmCache,
+	rwSets ...accesslist.RWSetList) *interactState.FullCacheConcurrent {
+	InvalidatePrepare(warm, state, block, chainCtx)
+	PrepareBlock(state, block, chainCtx)
+	fullcache := interactState.NewFullCacheConcurrent()
+	fullcache.SetWarmCache(warm)
+	for _, list := range rwSets {
+		fullcache.Prefetch(state, list)
+	}
+	fullcache.Prefetch(state, accesslist.RWSetList{PredictFinalizeRWSet(state, block, chainCtx)})
+	return fullcache
+}
+
+// InvalidatePrepare drops from warm the values PrepareBlock writes, it is called on state before PrepareBlock
+// when block is prefetched from the prepared state. A nil warm is no cache
+func InvalidatePrepare(warm *interactState.WarmCache, state *ethState.StateDB, block *types.Block, chainCtx core.ChainContext) {
+	if warm == nil || block.Header().ParentBeaconRoot == nil {
+		return
+	}
+	warm.Invalidate(PredictPrepareRWSet(state, block, chainCtx).WriteSet)
+}
+
+// RecordWrites wraps state so that the writes merged into it, e.g. by MergeToState, FinishBlock and FinalizeBlock,
+// are recorded in the returned rw set, they are the values InvalidateBlock drops once the block is executed
+func RecordWrites(state interactState.StateInterface) (*interactState.StateWithRwSets, *accesslist.RWSet) {
+	rwSet := accesslist.NewRWSet()
+	recorder := interactState.NewStateWithRwSets(state)
+	recorder.SetRWSet(rwSet)
+	return recorder, rwSet
+}
+
+// InvalidateBlock drops from warm the values the executor has written for a block, i.e. the write sets of the merged
+// cache states, of the barrier txs and of FinalizeBlock, it is called once the block is executed, before the next
+// block is prefetched. A nil warm is no cache
+func InvalidateBlock(warm *interactState.WarmCache, writeSets ...accesslist.ALTuple) {
+	if warm == nil {
+		return
+	}
+	for _, writeSet := range writeSets {
+		warm.Invalidate(writeSet)
+	}
+}
+
+// FinishBlock applies what follows the scheduled txs of block on cache. The txs without a prediction are left out
+// of the schedules, so they run serially once the scheduled ones are merged, see ExecBarrierRound.
+// Then every tx must be accounted by meter, nil for the executors not accounting the gas, and FinalizeBlock is applied.
+// It returns the number of barrier txs
+func FinishBlock(statedb vm.StateDB, cache BarrierState, block *types.Block, predictRWSets accesslist.RWSetList,
+	chainCtx core.ChainContext, meter *BlockGasMeter) (int, error) {
+	barrier := BarrierTxs(block.Transactions(), predictRWSets)
+	barrierTxs, barrierErrs, barrierGasUsed := ExecBarrierRound(statedb, cache, barrier, block.Transactions(), block.Header(), chainCtx)
+	if meter != nil {
+		if err := meter.Commit(barrierTxs, barrierGasUsed, barrierErrs); err != nil {
+			return len(barrier), err
+		}
+		if err := meter.Check(); err != nil {
+			return len(barrier), err
+		}
+	}
+	FinalizeBlock(cache, block, chainCtx)
+	return len(barrier), nil
+}
+
+// PredictPrepareRWSet records the accesses of PrepareBlock, for a cache state not prefetched from the parent state,
+// e.g. the rolling state of a pipeline
+func PredictPrepareRWSet(state *ethState.StateDB, block *types.Block, chainCtx core.ChainContext) *accesslist.RWSet {
+	fulldb := interactState.NewStateWithRwSets(state.Copy())
+	rwSet := accesslist.NewRWSet()
+	fulldb.SetRWSet(rwSet)
+	PrepareBlock(fulldb, block, chainCtx)
+	return rwSet
+}
+
+// PredictFinalizeRWSet records the accesses of FinalizeBlock, so that a cache state prefetches them along with the txs.
+// PrepareBlock is applied on the parent state before prefetching, so it needs no prediction.
+func PredictFinalizeRWSet(state *ethState.StateDB, block *types.Block, chainCtx core.ChainContext) *accesslist.RWSet {
+	fulldb := interactState.NewStateWithRwSets(state.Copy())
+	rwSet := accesslist.NewRWSet()
+	fulldb.SetRWSet(rwSet)
+	FinalizeBlock(fulldb, block, chainCtx)
+	return rwSet
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testCoinbase = common.HexToAddress("0xc0ffee")
+	testUncle    = common.HexToAddress("0xdecaf")
+)
+
+func newFinalizeEnv(t *testing.T, config *params.ChainConfig) (*ethState.StateDB, core.ChainContext) {
+	statedb, err := ethState.New(types.EmptyRootHash, ethState.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return statedb, core.NewFakeChainContextWithConfig(rawdb.NewMemoryDatabase(), config)
+}
+
+func TestFinalizeBlockRewards(t *testing.T) {
+	statedb, chainCtx := newFinalizeEnv(t, params.MainnetChainConfig)
+	header := &types.Header{Number: big.NewInt(15000000), Difficulty: big.NewInt(1), Coinbase: testCoinbase}
+	uncle := &types.Header{Number: big.NewInt(14999999), Difficulty: big.NewInt(1), Coinbase: testUncle}
+	FinalizeBlock(statedb, types.NewBlockWithHeader(header).WithBody(nil, []*types.Header{uncle}), chainCtx)
+
+	reward := ethash.ConstantinopleBlockReward
+	want := new(big.Int).Add(reward, new(big.Int).Div(reward, big.NewInt(32)))
+	if got := statedb.GetBalance(testCoinbase); got.Cmp(want) != 0 {
+		t.Fatalf("coinbase balance %v, want %v", got, want)
+	}
+	// an uncle one block behind gets 7/8 of the reward
+	want = new(big.Int).Div(new(big.Int).Mul(reward, big.NewInt(7)), big.NewInt(8))
+	if got := statedb.GetBalance(testUncle); got.Cmp(want) != 0 {
+		t.Fatalf("uncle balance %v, want %v", got, want)
+	}
+}
+
+func TestFinalizeBlockClique(t *testing.T) {
+	// a clique block has a difficulty but no reward
+	statedb, chainCtx := newFinalizeEnv(t, params.AllCliqueProtocolChanges)
+	header := &types.Header{Number: big.NewInt(10), Difficulty: big.NewInt(2), Coinbase: testCoinbase}
+	FinalizeBlock(statedb, types.NewBlockWithHeader(header), chainCtx)
+	if got := statedb.GetBalance(testCoinbase); got.Sign() != 0 {
+		t.Fatalf("coinbase balance %v, want 0", got)
+	}
+}
+
+func TestFinalizeBlockWithdrawals(t *testing.T) {
+	statedb, chainCtx := newFinalizeEnv(t, params.MainnetChainConfig)
+	header := &types.Header{Number: big.NewInt(18000000), Difficulty: common.Big0, Coinbase: testCoinbase}
+	withdrawals := []*types.Withdrawal{
+		{Index: 0, Validator: 1, Address: testUncle, Amount: 3},
+		{Index: 1, Validator: 2, Address: testUncle, Amount: 4},
+		{Index: 2, Validator: 3, Address: testCoinbase, Amount: 0},
+	}
+	FinalizeBlock(statedb, types.NewBlockWithHeader(header).WithWithdrawals(withdrawals), chainCtx)
+
+	if got, want := statedb.GetBalance(testUncle), big.NewInt(7*params.GWei); got.Cmp(want) != 0 {
+		t.Fatalf("withdrawal balance %v, want %v", got, want)
+	}
+	// no block reward after the merge, and a zero withdrawal doesn't touch the account
+	if statedb.GetBalance(testCoinbase).Sign() != 0 || statedb.Exist(testCoinbase) {
+		t.Fatalf("coinbase balance %v, exists %v, want untouched", statedb.GetBalance(testCoinbase), statedb.Exist(testCoinbase))
+	}
+}
+
+func TestPrepareBlockBeaconRoot(t *testing.T) {
+	statedb, chainCtx := newFinalizeEnv(t, params.AllDevChainProtocolChanges)
+	// stores the calldata at the slot of the timestamp, like the ring buffer of EIP-4788
+	statedb.SetCode(params.BeaconRootsStorageAddress, common.FromHex("0x600035425500"))
+	root := common.HexToHash("0xbeac0")
+	header := &types.Header{Number: big.NewInt(1), Time: 1700000000, Difficulty: common.Big0, GasLimit: 30000000, ParentBeaconRoot: &root}
+	PrepareBlock(statedb, types.NewBlockWithHeader(header), chainCtx)
+
+	if got := statedb.GetState(params.BeaconRootsStorageAddress, common.BigToHash(new(big.Int).SetUint64(header.Time))); got != root {
+		t.Fatalf("beacon root %v, want %v", got, root)
+	}
+
+	// a block without a beacon root calls nothing
+	statedb, chainCtx = newFinalizeEnv(t, params.AllDevChainProtocolChanges)
+	statedb.SetCode(params.BeaconRootsStorageAddress, common.FromHex("0x600035425500"))
+	header.ParentBeaconRoot = nil
+	PrepareBlock(statedb, types.NewBlockWithHeader(header), chainCtx)
+	if got := statedb.GetState(params.BeaconRootsStorageAddress, common.BigToHash(new(big.Int).SetUint64(header.Time))); got != (common.Hash{}) {
+		t.Fatalf("beacon root %v without a beacon root in the header", got)
+	}
+}
+
+// TestInvalidateBlock runs a block like the degree zero executor, the warm cache must not keep the values it wrote
+func TestInvalidateBlock(t *testing.T) {
+	env := newExecEnv(t)
+	env.statedb.SetCode(testContract, copierCode)
+	env.statedb.Finalise(true)
+	// tx 0 is scheduled and stores 3 at slot 0, tx 1 has no prediction and pays testPayee, the withdrawal pays testUncle
+	txs := types.Transactions{
+		env.call(0, 0, testContract, 0, common.BigToHash(common.Big3).Bytes()),
+		env.call(1, 0, testPayee, 5, nil),
+	}
+	block := types.NewBlockWithHeader(env.header).WithBody(txs, nil).WithWithdrawals([]*types.Withdrawal{{Address: testUncle, Amount: 1}})
+	rwSet, err := tracer.PredictWithTracer(env.statedb.Copy(), txs[0], env.header, env.chainCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	predicts := accesslist.RWSetList{rwSet, nil}
+
+	warm := interactState.NewWarmCache(1 << 20)
+	keys := []struct {
+		addr common.Address
+		read func(vm.StateDB) any
+	}{
+		{testContract, func(db vm.StateDB) any { return db.GetState(testContract, slot(0)) }},
+		{testPayee, func(db vm.StateDB) any { return db.GetBalance(testPayee) }},
+		{testUncle, func(db vm.StateDB) any { return db.GetBalance(testUncle) }},
+		{testSender(1), func(db vm.StateDB) any { return db.GetNonce(testSender(1)) }},
+		{testCoinbase, func(db vm.StateDB) any { return db.GetBalance(testCoinbase) }},
+	}
+	for _, key := range keys {
+		key.read(warm.Reader(env.statedb))
+	}
+
+	fullcache := interactState.NewCacheState()
+	fullcache.SetWarmCache(warm)
+	fullcache.Prefetch(env.statedb, predicts)
+	if errs, _ := tracer.ExecuteTxs(fullcache, txs[:1], env.header, env.chainCtx); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	merged, written := RecordWrites(env.statedb)
+	MergeToState(interactState.CacheStateList{fullcache}, merged)
+	if _, err := FinishBlock(env.statedb, WholeState{StateInterface: merged}, block, predicts, env.chainCtx, nil); err != nil {
+		t.Fatal(err)
+	}
+	InvalidateBlock(warm, written.WriteSet)
+
+	for _, key := range keys {
+		if got, want := key.read(warm.Reader(env.statedb)), key.read(env.statedb); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: warm %v, state %v", key.addr, got, want)
+		}
+	}
+}
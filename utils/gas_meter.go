@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ErrBlockGasLimit means a tx is scheduled or committed past the block gas limit
+var ErrBlockGasLimit = errors.New("tx exceeds the block gas limit")
+
+// ErrTxNotCommitted means a tx of the block is never committed, e.g. it failed, so the gas used is of the txs ahead of it only
+var ErrTxNotCommitted = errors.New("tx is not committed")
+
+// BlockGasMeter accounts the gas of a block executed in parallel. Each tx executes with a gas pool of its own,
+// so the block gas limit is checked here instead: the gas used by the committed txs is accounted in block order,
+// and like core.GasPool, a tx must fit its gas limit in the gas left by the txs ahead of it.
+// It is used by the goroutine scheduling the rounds, not by the executing ones.
+type BlockGasMeter struct {
+	txs      types.Transactions
+	index    map[common.Hash]int
+	gasLimit uint64
+
+	gasUsed   []uint64
+	committed []bool
+	next      int    // txs[:next] are accounted
+	total     uint64 // gas used by txs[:next]
+}
+
+func NewBlockGasMeter(txs types.Transactions, header *types.Header) *BlockGasMeter {
+	index := make(map[common.Hash]int, len(txs))
+	for i, tx := range txs {
+		index[tx.Hash()] = i
+	}
+	return &BlockGasMeter{
+		txs:       txs,
+		index:     index,
+		gasLimit:  header.GasLimit,
+		gasUsed:   make([]uint64, len(txs)),
+		committed: make([]bool, len(txs)),
+	}
+}
+
+// Admit rejects a round scheduling a tx that can't fit in the block whatever the txs ahead of it use,
+// a tx ahead not committed yet uses at least params.TxGas
+func (m *BlockGasMeter) Admit(txs types.Transactions) error {
+	for _, tx := range txs {
+		i, ok := m.index[tx.Hash()]
+		if !ok {
+			continue
+		}
+		least := m.total
+		for j := m.next; j < i; j++ {
+			if m.committed[j] {
+				least += m.gasUsed[j]
+			} else {
+				least += params.TxGas
+			}
+		}
+		if least+tx.Gas() > m.gasLimit {
+			return fmt.Errorf("%w: tx %d, gas limit %d, at least %d used ahead", ErrBlockGasLimit, i, tx.Gas(), least)
+		}
+	}
+	return nil
+}
+
+// Commit records the gas used by the committed txs, and accounts the txs in block order as far as they are committed.
+// A tx failing in any of errs, e.g. the execution errors and the merge errors, is not committed.
+func (m *BlockGasMeter) Commit(txs types.Transactions, gasUsed []uint64, errs ...[]error) error {
+	for k, tx := range txs {
+		if failed(errs, k) {
+			continue
+		}
+		if i, ok := m.index[tx.Hash()]; ok {
+			m.gasUsed[i] = gasUsed[k]
+			m.committed[i] = true
+		}
+	}
+	for ; m.next < len(m.txs) && m.committed[m.next]; m.next++ {
+		if m.total+m.txs[m.next].Gas() > m.gasLimit {
+			return fmt.Errorf("%w: tx %d, gas limit %d, %d used ahead", ErrBlockGasLimit, m.next, m.txs[m.next].Gas(), m.total)
+		}
+		m.total += m.gasUsed[m.next]
+	}
+	return nil
+}
+
+func failed(errs [][]error, k int) bool {
+	for _, e := range errs {
+		if e[k] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GasUsed returns the cumulative gas used by the txs accounted so far
+func (m *BlockGasMeter) GasUsed() uint64 {
+	return m.total
+}
+
+// TxGasUsed returns the gas used by the i'th tx, 0 if it isn't committed
+func (m *BlockGasMeter) TxGasUsed(i int) uint64 {
+	return m.gasUsed[i]
+}
+
+// Done reports whether all the txs are accounted
+func (m *BlockGasMeter) Done() bool {
+	return m.next == len(m.txs)
+}
+
+// Check returns ErrTxNotCommitted unless all the txs are accounted, an executor checks it before reporting the gas used
+func (m *BlockGasMeter) Check() error {
+	if m.Done() {
+		return nil
+	}
+	return fmt.Errorf("%w: tx %d of %d, %d used ahead", ErrTxNotCommitted, m.next, len(m.txs), m.total)
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var testChainID = big.NewInt(1)
+
+// testKey is the i'th sender of the tests
+func testKey(i int) *ecdsa.PrivateKey {
+	key, err := crypto.ToECDSA(common.BigToHash(big.NewInt(int64(i + 1))).Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// testTx is a signed tx of sender with a gas limit of gas and a tip of tip wei
+func testTx(sender int, nonce, gas uint64, tip int64) *types.Transaction {
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   testChainID,
+		Nonce:     nonce,
+		Gas:       gas,
+		GasTipCap: big.NewInt(tip),
+		GasFeeCap: big.NewInt(tip + 100),
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(testChainID), testKey(sender))
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// meterTxs are txs of different senders with the gas limits of gas
+func meterTxs(gas ...uint64) types.Transactions {
+	txs := make(types.Transactions, len(gas))
+	for i, g := range gas {
+		txs[i] = testTx(i, 0, g, 1)
+	}
+	return txs
+}
+
+func TestBlockGasMeterCommitInOrder(t *testing.T) {
+	txs := meterTxs(50000, 60000, 70000)
+	meter := NewBlockGasMeter(txs, &types.Header{GasLimit: 1000000})
+
+	// the later txs are recorded but not accounted until the txs ahead are committed
+	if err := meter.Commit(txs[1:], []uint64{30000, 40000}); err != nil {
+		t.Fatal(err)
+	}
+	if meter.GasUsed() != 0 || meter.Done() {
+		t.Fatalf("accounted ahead of tx 0: gas used %d, done %v", meter.GasUsed(), meter.Done())
+	}
+	if meter.TxGasUsed(2) != 40000 {
+		t.Fatalf("tx 2 gas used %d, want 40000", meter.TxGasUsed(2))
+	}
+	if err := meter.Commit(txs[:1], []uint64{21000}); err != nil {
+		t.Fatal(err)
+	}
+	if meter.GasUsed() != 91000 || !meter.Done() {
+		t.Fatalf("gas used %d, done %v, want 91000 and done", meter.GasUsed(), meter.Done())
+	}
+	if err := meter.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockGasMeterFailedTx(t *testing.T) {
+	txs := meterTxs(50000, 60000, 70000)
+	meter := NewBlockGasMeter(txs, &types.Header{GasLimit: 1000000})
+	execErrs := []error{nil, nil, nil}
+	mergeErrs := []error{nil, errors.New("merge failed"), nil}
+	if err := meter.Commit(txs, []uint64{21000, 30000, 40000}, execErrs, mergeErrs); err != nil {
+		t.Fatal(err)
+	}
+	// tx 1 isn't committed, so tx 2 isn't accounted either
+	if meter.GasUsed() != 21000 || meter.Done() {
+		t.Fatalf("gas used %d, done %v, want 21000 and not done", meter.GasUsed(), meter.Done())
+	}
+	if err := meter.Check(); !errors.Is(err, ErrTxNotCommitted) {
+		t.Fatalf("check: %v, want %v", err, ErrTxNotCommitted)
+	}
+	// executed again, e.g. after the merge failed
+	if err := meter.Commit(txs[1:2], []uint64{35000}); err != nil {
+		t.Fatal(err)
+	}
+	if meter.GasUsed() != 96000 {
+		t.Fatalf("gas used %d, want 96000", meter.GasUsed())
+	}
+	if err := meter.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockGasMeterLimit(t *testing.T) {
+	txs := meterTxs(50000, 60000, 70000)
+	meter := NewBlockGasMeter(txs, &types.Header{GasLimit: 120000})
+
+	// tx 2 fits behind the least the txs ahead can use, 2 * params.TxGas
+	if err := meter.Admit(txs[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := meter.Commit(txs[:1], []uint64{50000}); err != nil {
+		t.Fatal(err)
+	}
+	// 50000 + params.TxGas + 70000 is over the limit
+	if err := meter.Admit(txs[2:]); !errors.Is(err, ErrBlockGasLimit) {
+		t.Fatalf("admit: %v, want %v", err, ErrBlockGasLimit)
+	}
+	if err := meter.Commit(txs[1:2], []uint64{params.TxGas}); err != nil {
+		t.Fatal(err)
+	}
+	// like core.GasPool, the gas limit of tx 2 must fit in the gas left, not its gas used
+	if err := meter.Commit(txs[2:], []uint64{21000}); !errors.Is(err, ErrBlockGasLimit) {
+		t.Fatalf("commit: %v, want %v", err, ErrBlockGasLimit)
+	}
+}
+
+func TestFailedGroups(t *testing.T) {
+	txs := meterTxs(21000, 21000, 21000, 21000, 21000)
+	groups := []types.Transactions{{txs[1], txs[4]}, {txs[0]}, {txs[2], txs[3]}}
+	failed := FailedGroups(txs, groups, []error{errors.New("merge failed"), nil, errors.New("merge failed")})
+	if want := []uint{1, 2, 3, 4}; !reflect.DeepEqual(failed, want) {
+		t.Fatalf("failed %v, want %v", failed, want)
+	}
+}
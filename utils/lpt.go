@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"interact/accesslist"
+	conflictgraph "interact/conflictGraph"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var ErrNoWorkers = errors.New("no workers to schedule the txs on")
+
+// packUnit is a set of txs packed into one bucket, a connected component,
+// or a part of an oversized component pinned to the stage of its sub-batch
+type packUnit struct {
+	ids   []uint
+	gas   uint64
+	stage int
+}
+
+// GenerateLPTStages packs the connected components into exactly workers buckets by estimated gas,
+// the longest processing time first. A component heavier than the balanced load of a bucket is split
+// along the directed conflict graph into sub-batches of consecutive layers.
+// The sub-batches run in sequential stages and the independent parts of a sub-batch are spread over the buckets,
+// while the other components fill the stages around them. A component that is mostly a chain is not split,
+// it gains nothing from it. The buckets of a stage run concurrently, and the stages one after another
+func GenerateLPTStages(txs types.Transactions, predictRWSets accesslist.RWSetList, weights []uint64, workers int) ([][]types.Transactions, [][]accesslist.RWSetList, error) {
+	if workers <= 0 {
+		return nil, nil, fmt.Errorf("%w: %d workers", ErrNoWorkers, workers)
+	}
+	undiGraph := generateUndiGraph(txs, predictRWSets)
+	vertexGroups := undiGraph.GetConnectedComponents()
+	total := uint64(0)
+	for _, group := range vertexGroups {
+		for _, v := range group {
+			total += weights[v.TxId]
+		}
+	}
+	target := (total + uint64(workers) - 1) / uint64(workers)
+
+	diGraph := generateDiGraph(txs, predictRWSets)
+	pathGas, _ := diGraph.CriticalPath(func(id uint) uint64 {
+		return weights[id]
+	})
+	depth := make(map[uint]int)
+	for layer, ids := range diGraph.GetDegreeZero() {
+		for _, id := range ids {
+			depth[id] = layer
+		}
+	}
+
+	pinned := make([]packUnit, 0)
+	free := make([]packUnit, 0)
+	stages := 1
+	for _, group := range vertexGroups {
+		unit := packUnit{}
+		longest := uint64(0)
+		for _, v := range group {
+			unit.ids = append(unit.ids, v.TxId)
+			unit.gas += weights[v.TxId]
+			if pathGas[v.TxId] > longest {
+				longest = pathGas[v.TxId]
+			}
+		}
+		if unit.gas <= target || unit.gas < 2*longest {
+			free = append(free, unit)
+			continue
+		}
+		subBatches := splitComponent(undiGraph, unit.ids, depth, weights)
+		for stage, subBatch := range subBatches {
+			for _, part := range subBatch {
+				part.stage = stage
+				pinned = append(pinned, part)
+			}
+		}
+		if len(subBatches) > stages {
+			stages = len(subBatches)
+		}
+	}
+
+	loads := make([][]uint64, stages)
+	buckets := make([][][]uint, stages)
+	for s := range loads {
+		loads[s] = make([]uint64, workers)
+		buckets[s] = make([][]uint, workers)
+	}
+	place := func(unit packUnit, s, b int) {
+		loads[s][b] += unit.gas
+		buckets[s][b] = append(buckets[s][b], unit.ids...)
+	}
+	heaviestFirst := func(units []packUnit) {
+		sort.SliceStable(units, func(i, j int) bool {
+			return units[i].gas > units[j].gas
+		})
+	}
+
+	// the parts of the oversized components go to the least loaded bucket of their stage
+	heaviestFirst(pinned)
+	for _, unit := range pinned {
+		place(unit, unit.stage, lightestBucket(loads[unit.stage]))
+	}
+	// a component goes where it lengthens the stages the least, i.e. into the idle time of a stage if it fits
+	heaviestFirst(free)
+	for _, unit := range free {
+		bestStage, bestBucket := 0, 0
+		bestGrowth, bestLoad := ^uint64(0), ^uint64(0)
+		for s := range loads {
+			b := lightestBucket(loads[s])
+			growth := uint64(0)
+			if longest := heaviestLoad(loads[s]); loads[s][b]+unit.gas > longest {
+				growth = loads[s][b] + unit.gas - longest
+			}
+			if growth < bestGrowth || (growth == bestGrowth && loads[s][b] < bestLoad) {
+				bestStage, bestBucket, bestGrowth, bestLoad = s, b, growth, loads[s][b]
+			}
+		}
+		place(unit, bestStage, bestBucket)
+	}
+
+	txsStages := make([][]types.Transactions, stages)
+	RWSetsStages := make([][]accesslist.RWSetList, stages)
+	for s := range buckets {
+		for _, ids := range buckets[s] {
+			if len(ids) == 0 {
+				continue
+			}
+			// the components of a bucket are independent, the block order keeps each of them in order
+			sort.Slice(ids, func(i, j int) bool {
+				return ids[i] < ids[j]
+			})
+			group := make(types.Transactions, len(ids))
+			rwSets := make(accesslist.RWSetList, len(ids))
+			for i, id := range ids {
+				group[i] = txs[id]
+				rwSets[i] = predictRWSets[id]
+			}
+			txsStages[s] = append(txsStages[s], group)
+			RWSetsStages[s] = append(RWSetsStages[s], rwSets)
+		}
+	}
+	if err := ValidateStageOrder(txs, txsStages); err != nil {
+		return nil, nil, err
+	}
+	return txsStages, RWSetsStages, nil
+}
+
+func lightestBucket(loads []uint64) int {
+	lightest := 0
+	for b := range loads {
+		if loads[b] < loads[lightest] {
+			lightest = b
+		}
+	}
+	return lightest
+}
+
+func heaviestLoad(loads []uint64) uint64 {
+	heaviest := uint64(0)
+	for _, load := range loads {
+		if load > heaviest {
+			heaviest = load
+		}
+	}
+	return heaviest
+}
+
+// splitComponent cuts a component into sub-batches along its layers, a wide layer is a sub-batch on its own
+// and a run of single tx layers, i.e. a piece of chain, is kept in one sub-batch to save the stages.
+// Each sub-batch is then split into its parts that don't conflict with each other
+func splitComponent(undiGraph *conflictgraph.UndirectedGraph, ids []uint, depth map[uint]int, weights []uint64) [][]packUnit {
+	layers := make(map[int][]uint)
+	maxDepth := 0
+	for _, id := range ids {
+		layers[depth[id]] = append(layers[depth[id]], id)
+		if depth[id] > maxDepth {
+			maxDepth = depth[id]
+		}
+	}
+	subBatches := make([][]packUnit, 0)
+	chain := make([]uint, 0)
+	for d := 0; d <= maxDepth; d++ {
+		layer := layers[d]
+		if len(layer) == 1 {
+			chain = append(chain, layer[0])
+			continue
+		}
+		if len(chain) > 0 {
+			subBatches = append(subBatches, partsOf(undiGraph, chain, weights))
+			chain = make([]uint, 0)
+		}
+		if len(layer) > 0 {
+			subBatches = append(subBatches, partsOf(undiGraph, layer, weights))
+		}
+	}
+	if len(chain) > 0 {
+		subBatches = append(subBatches, partsOf(undiGraph, chain, weights))
+	}
+	return subBatches
+}
+
+// partsOf returns the connected components of the subgraph induced by ids
+func partsOf(undiGraph *conflictgraph.UndirectedGraph, ids []uint, weights []uint64) []packUnit {
+	partOf := make(map[uint]int, len(ids))
+	for _, id := range ids {
+		partOf[id] = -1
+	}
+	parts := make([]packUnit, 0)
+	for _, id := range ids {
+		if partOf[id] != -1 {
+			continue
+		}
+		part := packUnit{}
+		partOf[id] = len(parts)
+		stack := []uint{id}
+		for len(stack) > 0 {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			part.ids = append(part.ids, v)
+			part.gas += weights[v]
+			for _, neighborid := range undiGraph.AdjacencyMap[v] {
+				if p, ok := partOf[neighborid]; ok && p == -1 {
+					partOf[neighborid] = len(parts)
+					stack = append(stack, neighborid)
+				}
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
@@ -0,0 +1,280 @@
+package utils
+
+import (
+	"errors"
+	"interact/accesslist"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// singletons are n txs of the senders from on, each writing a slot of its own
+func singletons(from, n int) (types.Transactions, accesslist.RWSetList) {
+	txs := make(types.Transactions, n)
+	rwSets := make(accesslist.RWSetList, n)
+	for i := range txs {
+		txs[i] = testTx(from+i, 0, 21000, 1)
+		rwSets[i] = accesslist.NewRWSet()
+		rwSets[i].AddWriteSet(testContract, slot(1000+from+i))
+	}
+	return txs, rwSets
+}
+
+// slotChain is n txs of the senders from on, each reading the slot the tx ahead writes
+func slotChain(from, n int) (types.Transactions, accesslist.RWSetList) {
+	txs := make(types.Transactions, n)
+	rwSets := make(accesslist.RWSetList, n)
+	for i := range txs {
+		txs[i] = testTx(from+i, 0, 21000, 1)
+		rwSets[i] = accesslist.NewRWSet()
+		if i > 0 {
+			rwSets[i].AddReadSet(testContract, slot(from+i-1))
+		}
+		rwSets[i].AddWriteSet(testContract, slot(from+i))
+	}
+	return txs, rwSets
+}
+
+// sameSender is n txs of sender in nonce order, the predictions miss the nonce
+func sameSender(sender, n int) (types.Transactions, accesslist.RWSetList) {
+	txs := make(types.Transactions, n)
+	rwSets := make(accesslist.RWSetList, n)
+	for i := range txs {
+		txs[i] = testTx(sender, uint64(i), 21000, 1)
+		rwSets[i] = accesslist.NewRWSet()
+	}
+	return txs, rwSets
+}
+
+func joinBlocks(blocks ...func() (types.Transactions, accesslist.RWSetList)) (types.Transactions, accesslist.RWSetList) {
+	txs := make(types.Transactions, 0)
+	rwSets := make(accesslist.RWSetList, 0)
+	for _, block := range blocks {
+		t, rw := block()
+		txs = append(txs, t...)
+		rwSets = append(rwSets, rw...)
+	}
+	return txs, rwSets
+}
+
+func uniformWeights(n int, w uint64) []uint64 {
+	weights := make([]uint64, n)
+	for i := range weights {
+		weights[i] = w
+	}
+	return weights
+}
+
+// checkStages checks every tx is scheduled once, in nonce order and after the txs it conflicts with,
+// it returns the stage of each tx and the makespan, the heaviest group of each stage one after another
+func checkStages(t *testing.T, txs types.Transactions, rwSets accesslist.RWSetList, weights []uint64, stages [][]types.Transactions) ([]int, uint64) {
+	type position struct{ stage, group, index int }
+	idOf := make(map[common.Hash]int, txs.Len())
+	for i, tx := range txs {
+		idOf[tx.Hash()] = i
+	}
+	posOf := make(map[int]position, txs.Len())
+	makespan := uint64(0)
+	for s, groups := range stages {
+		heaviest := uint64(0)
+		for g, group := range groups {
+			load := uint64(0)
+			for i, tx := range group {
+				id := idOf[tx.Hash()]
+				if _, ok := posOf[id]; ok {
+					t.Fatalf("tx %d scheduled twice", id)
+				}
+				posOf[id] = position{s, g, i}
+				load += weights[id]
+			}
+			if load > heaviest {
+				heaviest = load
+			}
+		}
+		makespan += heaviest
+	}
+	if len(posOf) != txs.Len() {
+		t.Fatalf("scheduled %d of %d txs", len(posOf), txs.Len())
+	}
+	if err := ValidateStageOrder(txs, stages); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < txs.Len(); i++ {
+		for j := i + 1; j < txs.Len(); j++ {
+			if !rwSets[i].HasConflict(*rwSets[j]) {
+				continue
+			}
+			pi, pj := posOf[i], posOf[j]
+			if pi.stage > pj.stage || (pi.stage == pj.stage && (pi.group != pj.group || pi.index > pj.index)) {
+				t.Fatalf("tx %d at %v runs concurrently with or ahead of the conflicting tx %d at %v", j, pj, i, pi)
+			}
+		}
+	}
+	stageOf := make([]int, txs.Len())
+	for id, p := range posOf {
+		stageOf[id] = p.stage
+	}
+	return stageOf, makespan
+}
+
+func TestGenerateLPTStages(t *testing.T) {
+	tests := []struct {
+		name     string
+		block    func() (types.Transactions, accesslist.RWSetList)
+		weights  []uint64
+		workers  int
+		stages   int
+		makespan uint64
+	}{
+		{
+			name:     "singletons are packed longest first",
+			block:    func() (types.Transactions, accesslist.RWSetList) { return singletons(0, 5) },
+			weights:  []uint64{40, 30, 20, 10, 10},
+			workers:  2,
+			stages:   1,
+			makespan: 60,
+		},
+		{
+			// the oversized star is split into tx 0 and its 4 leaves, the singletons fill the stages around them
+			name: "one large component and many singletons",
+			block: func() (types.Transactions, accesslist.RWSetList) {
+				return joinBlocks(func() (types.Transactions, accesslist.RWSetList) { return starBlock(4) },
+					func() (types.Transactions, accesslist.RWSetList) { return singletons(5, 8) })
+			},
+			weights:  uniformWeights(13, 10),
+			workers:  4,
+			stages:   2,
+			makespan: 40,
+		},
+		{
+			name: "a chain is not split",
+			block: func() (types.Transactions, accesslist.RWSetList) {
+				return joinBlocks(func() (types.Transactions, accesslist.RWSetList) { return slotChain(20, 4) },
+					func() (types.Transactions, accesslist.RWSetList) { return singletons(30, 2) })
+			},
+			weights:  uniformWeights(6, 10),
+			workers:  2,
+			stages:   1,
+			makespan: 40,
+		},
+		{
+			name: "same-sender txs stay in nonce order",
+			block: func() (types.Transactions, accesslist.RWSetList) {
+				return joinBlocks(func() (types.Transactions, accesslist.RWSetList) { return sameSender(0, 3) },
+					func() (types.Transactions, accesslist.RWSetList) { return singletons(1, 3) })
+			},
+			weights:  uniformWeights(6, 10),
+			workers:  3,
+			stages:   1,
+			makespan: 30,
+		},
+		{
+			name:     "one worker runs the block serially",
+			block:    func() (types.Transactions, accesslist.RWSetList) { return starBlock(4) },
+			weights:  uniformWeights(5, 10),
+			workers:  1,
+			stages:   1,
+			makespan: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txs, rwSets := tt.block()
+			stages, rwStages, err := GenerateLPTStages(txs, rwSets, tt.weights, tt.workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stages) != tt.stages || len(rwStages) != tt.stages {
+				t.Fatalf("%d stages, %d rw set stages, want %d", len(stages), len(rwStages), tt.stages)
+			}
+			for s := range stages {
+				if len(stages[s]) > tt.workers {
+					t.Fatalf("stage %d has %d groups for %d workers", s, len(stages[s]), tt.workers)
+				}
+			}
+			if _, makespan := checkStages(t, txs, rwSets, tt.weights, stages); makespan != tt.makespan {
+				t.Fatalf("makespan %d, want %d", makespan, tt.makespan)
+			}
+		})
+	}
+}
+
+func TestGenerateLPTStagesSplit(t *testing.T) {
+	txs, rwSets := joinBlocks(func() (types.Transactions, accesslist.RWSetList) { return starBlock(4) },
+		func() (types.Transactions, accesslist.RWSetList) { return singletons(5, 8) })
+	weights := uniformWeights(txs.Len(), 10)
+	stages, _, err := GenerateLPTStages(txs, rwSets, weights, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageOf, _ := checkStages(t, txs, rwSets, weights, stages)
+	// the leaves don't conflict with each other, they are spread over the buckets of the stage after tx 0
+	if stageOf[0] != 0 {
+		t.Fatalf("tx 0 in stage %d, want 0", stageOf[0])
+	}
+	leafGroups := make(map[int]struct{})
+	for g, group := range stages[1] {
+		for _, tx := range group {
+			for leaf := 1; leaf <= 4; leaf++ {
+				if tx.Hash() == txs[leaf].Hash() {
+					leafGroups[g] = struct{}{}
+				}
+			}
+		}
+	}
+	if len(leafGroups) != 4 {
+		t.Fatalf("the 4 leaves are in %d groups of stage 1, want 4", len(leafGroups))
+	}
+}
+
+func TestGenerateLPTStagesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 50; k++ {
+		txs, rwSets := randomBlock(r, 40, 16, 12)
+		weights := make([]uint64, txs.Len())
+		for i := range weights {
+			weights[i] = 21000 + uint64(r.Intn(100000))
+		}
+		stages, _, err := GenerateLPTStages(txs, rwSets, weights, 1+r.Intn(8))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkStages(t, txs, rwSets, weights, stages)
+	}
+}
+
+func TestGenerateLPTStagesNoWorkers(t *testing.T) {
+	txs, rwSets := singletons(0, 3)
+	for _, workers := range []int{0, -1} {
+		if _, _, err := GenerateLPTStages(txs, rwSets, uniformWeights(3, 10), workers); !errors.Is(err, ErrNoWorkers) {
+			t.Fatalf("%d workers: %v, want %v", workers, err, ErrNoWorkers)
+		}
+	}
+}
+
+func TestValidateStageOrder(t *testing.T) {
+	txs, _ := sameSender(0, 3)
+	tests := []struct {
+		name   string
+		stages [][]types.Transactions
+		ok     bool
+	}{
+		{"in order in a group", [][]types.Transactions{{{txs[0], txs[1], txs[2]}}}, true},
+		{"in order over the stages", [][]types.Transactions{{{txs[0]}}, {{txs[1]}, {}}, {{txs[2]}}}, true},
+		{"out of order in a group", [][]types.Transactions{{{txs[1], txs[0], txs[2]}}}, false},
+		{"concurrent groups of a stage", [][]types.Transactions{{{txs[0]}, {txs[1], txs[2]}}}, false},
+		{"a later stage ahead", [][]types.Transactions{{{txs[1], txs[2]}}, {{txs[0]}}}, false},
+		{"the tx ahead not scheduled", [][]types.Transactions{{{txs[0], txs[2]}}}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateStageOrder(txs, tt.stages)
+		if tt.ok && err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrSenderOrder) {
+			t.Fatalf("%s: %v, want %v", tt.name, err, ErrSenderOrder)
+		}
+	}
+}
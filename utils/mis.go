@@ -3,31 +3,77 @@ package utils
 import (
 	conflictgraph "interact/conflictGraph"
 	"interact/mis"
+	"time"
 )
 
-// solveMISInTurn an approximation algorithm to solve MIS problem
-func solveMISInTurn(undiConfGraph *conflictgraph.UndirectedGraph) [][]uint {
-	ans := make([][]uint, 0)
-	for {
-		MisSolution := mis.NewSolution(undiConfGraph)
-		MisSolution.Solve()
-		ansSlice := MisSolution.IndependentSet.ToSlice()
-		ansSliceUint := make([]uint, len(ansSlice))
-		for i, v := range ansSlice {
-			ansSliceUint[i] = v.(uint)
+// solveMISInTurn an approximation algorithm to solve MIS problem,
+// a tx is only a candidate once the previous tx of its sender (prev) is in an earlier round
+func solveMISInTurn(undiConfGraph *conflictgraph.UndirectedGraph, prev map[uint]uint) [][]uint {
+	return solveMISRounds(undiConfGraph, senderBlocked(prev), linearMIS)
+}
+
+// solveWeightedMISInTurn is solveMISInTurn with an exact maximum weight independent set per round,
+// so the heaviest txs that don't conflict go first. Each round gets the time budget,
+// past it the round takes the best set found so far
+func solveWeightedMISInTurn(undiConfGraph *conflictgraph.UndirectedGraph, prev map[uint]uint, weights map[uint]uint64, budget time.Duration) [][]uint {
+	return solveMISRounds(undiConfGraph, senderBlocked(prev), func(g *conflictgraph.UndirectedGraph) []uint {
+		solution := mis.NewWeightedSolution(g, weights, budget)
+		solution.Solve()
+		return solution.IndependentSet.ToSlice()
+	})
+}
+
+// senderBlocked blocks a tx while the previous tx of its sender is still in the graph
+func senderBlocked(prev map[uint]uint) func(*conflictgraph.UndirectedGraph, uint) bool {
+	return func(g *conflictgraph.UndirectedGraph, id uint) bool {
+		p, ok := prev[id]
+		if !ok {
+			return false
 		}
-		ans = append(ans, ansSliceUint)
-		for _, v := range undiConfGraph.Vertices {
-			v.IsDeleted = false
-			v.Degree = uint(len(undiConfGraph.AdjacencyMap[v.TxId]))
+		_, ok = g.Vertices[p]
+		return ok
+	}
+}
+
+func linearMIS(g *conflictgraph.UndirectedGraph) []uint {
+	solution := mis.NewSolution(g)
+	solution.Solve()
+	return solution.IndependentSet.ToSlice()
+}
+
+// solveOrderedMISInTurn is the order-aware variant of solveMISInTurn,
+// a tx is only a candidate once all its earlier neighbours are in earlier rounds,
+// so the rounds are equivalent to the block order rather than to some serial order
+func solveOrderedMISInTurn(undiConfGraph *conflictgraph.UndirectedGraph) [][]uint {
+	return solveMISRounds(undiConfGraph, func(g *conflictgraph.UndirectedGraph, id uint) bool {
+		for _, n := range g.AdjacencyMap[id] {
+			if n < id {
+				return true
+			}
 		}
+		return false
+	}, linearMIS)
+}
+
+// solveMISRounds solves a MIS per round among the vertices not blocked in the remaining graph,
+// the rounds run on working copies and undiConfGraph is left unchanged
+func solveMISRounds(undiConfGraph *conflictgraph.UndirectedGraph, blocked func(*conflictgraph.UndirectedGraph, uint) bool,
+	solve func(*conflictgraph.UndirectedGraph) []uint) [][]uint {
+	ans := make([][]uint, 0)
+	remaining := undiConfGraph.CopyGraphWithDeletion()
+	for len(remaining.Vertices) > 0 {
+		candidates := remaining.Subgraph(func(id uint) bool {
+			return !blocked(remaining, id)
+		})
+		ansSlice := solve(candidates)
+		ans = append(ans, ansSlice)
+		scheduled := make(map[uint]bool, len(ansSlice))
 		for _, v := range ansSlice {
-			undiConfGraph.Vertices[v.(uint)].IsDeleted = true
-		}
-		undiConfGraph = undiConfGraph.CopyGraphWithDeletion()
-		if len(undiConfGraph.Vertices) == 0 {
-			break
+			scheduled[v] = true
 		}
+		remaining = remaining.Subgraph(func(id uint) bool {
+			return !scheduled[id]
+		})
 	}
 	return ans
 }
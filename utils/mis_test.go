@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"errors"
+	"interact/accesslist"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var testContract = common.HexToAddress("0xc0de")
+
+// slot is the i'th slot of testContract
+func slot(i int) common.Hash {
+	return common.BigToHash(big.NewInt(int64(i)))
+}
+
+// starBlock is tx 0 writing a slot every later tx reads, the MIS of the graph is the later txs
+func starBlock(leaves int) (types.Transactions, accesslist.RWSetList) {
+	txs := make(types.Transactions, leaves+1)
+	rwSets := make(accesslist.RWSetList, leaves+1)
+	for i := range txs {
+		txs[i] = testTx(i, 0, 21000, 1)
+		rwSets[i] = accesslist.NewRWSet()
+		if i == 0 {
+			rwSets[i].AddWriteSet(testContract, slot(0))
+		} else {
+			rwSets[i].AddReadSet(testContract, slot(0))
+			rwSets[i].AddWriteSet(testContract, slot(i))
+		}
+	}
+	return txs, rwSets
+}
+
+// randomBlock is n txs of a few senders in nonce order touching a few slots
+func randomBlock(r *rand.Rand, n, senders, slots int) (types.Transactions, accesslist.RWSetList) {
+	txs := make(types.Transactions, n)
+	rwSets := make(accesslist.RWSetList, n)
+	nonces := make([]uint64, senders)
+	for i := range txs {
+		sender := r.Intn(senders)
+		txs[i] = testTx(sender, nonces[sender], 21000, 1)
+		nonces[sender]++
+		rwSets[i] = accesslist.NewRWSet()
+		for k := 0; k < 1+r.Intn(2); k++ {
+			if r.Intn(2) == 0 {
+				rwSets[i].AddReadSet(testContract, slot(r.Intn(slots)))
+			} else {
+				rwSets[i].AddWriteSet(testContract, slot(r.Intn(slots)))
+			}
+		}
+	}
+	return txs, rwSets
+}
+
+func TestOrderedMISStar(t *testing.T) {
+	txs, rwSets := starBlock(4)
+	groups, err := GenerateMISGroups(txs, rwSets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the largest set is the leaves, they run ahead of the tx they read from
+	if err := ValidateConflictOrder(rwSets, groups); !errors.Is(err, ErrConflictOrder) {
+		t.Fatalf("MIS rounds %v: %v, want %v", groups, err, ErrConflictOrder)
+	}
+
+	ordered, err := GenerateOrderedMISGroups(txs, rwSets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 2 || len(ordered[0]) != 1 || ordered[0][0] != 0 || len(ordered[1]) != 4 {
+		t.Fatalf("ordered MIS rounds %v, want tx 0 then the 4 others", ordered)
+	}
+}
+
+func TestOrderedMISRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	violated := 0
+	for k := 0; k < 50; k++ {
+		txs, rwSets := randomBlock(r, 30, 12, 8)
+		ordered, err := GenerateOrderedMISGroups(txs, rwSets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scheduled := 0
+		for _, round := range ordered {
+			scheduled += len(round)
+		}
+		if scheduled != txs.Len() {
+			t.Fatalf("ordered MIS scheduled %d of %d txs", scheduled, txs.Len())
+		}
+		if err := ValidateConflictOrder(rwSets, ordered); err != nil {
+			t.Fatalf("ordered MIS rounds: %v", err)
+		}
+
+		groups, err := GenerateMISGroups(txs, rwSets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ValidateConflictOrder(rwSets, groups) != nil {
+			violated++
+		}
+	}
+	if violated == 0 {
+		t.Fatal("the MIS rounds never broke the block order, the graphs don't test the ordered variant")
+	}
+}
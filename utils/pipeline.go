@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// StageMeter measures the busy time of a stage of a pipeline, the time it waits for the other stages is left out
+type StageMeter struct {
+	Name   string
+	Blocks int
+	Txs    int
+	Busy   time.Duration
+}
+
+func NewStageMeter(name string) *StageMeter {
+	return &StageMeter{Name: name}
+}
+
+// Record adds a block of txs the stage was busy with for d
+func (m *StageMeter) Record(txs int, d time.Duration) {
+	m.Blocks++
+	m.Txs += txs
+	m.Busy += d
+}
+
+// Throughput returns the blocks and txs per second of busy time
+func (m *StageMeter) Throughput() (float64, float64) {
+	if m.Busy == 0 {
+		return 0, 0
+	}
+	return float64(m.Blocks) / m.Busy.Seconds(), float64(m.Txs) / m.Busy.Seconds()
+}
+
+func (m *StageMeter) String() string {
+	blocks, txs := m.Throughput()
+	return fmt.Sprintf("%s: %d blocks %d txs in %v, %.2f blocks/s %.0f txs/s", m.Name, m.Blocks, m.Txs, m.Busy, blocks, txs)
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrSenderOrder means a schedule may run a tx before an earlier tx of the same sender,
+// which then fails the nonce check
+var ErrSenderOrder = errors.New("same-sender txs scheduled out of nonce order")
+
+// senderPredecessors maps each tx to the previous tx of the same sender,
+// the txs of a block are in nonce order for each sender
+func senderPredecessors(txs types.Transactions) map[uint]uint {
+	prev := make(map[uint]uint)
+	last := make(map[common.Address]uint)
+	for i, tx := range txs {
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			continue
+		}
+		if p, ok := last[from]; ok {
+			prev[uint(i)] = p
+		}
+		last[from] = uint(i)
+	}
+	return prev
+}
+
+// ValidateRoundOrder checks the rounds of GenerateMISGroups and GenerateDegreeZeroGroups,
+// the rounds run one after another and the txs of a round run concurrently
+func ValidateRoundOrder(txs types.Transactions, rounds [][]uint) error {
+	roundOf := make(map[uint]int)
+	for r, round := range rounds {
+		for _, id := range round {
+			roundOf[id] = r
+		}
+	}
+	for id, p := range senderPredecessors(txs) {
+		r, ok := roundOf[id]
+		if !ok {
+			continue
+		}
+		pr, ok := roundOf[p]
+		if !ok {
+			return fmt.Errorf("%w: tx %d in round %d, tx %d not scheduled", ErrSenderOrder, id, r, p)
+		}
+		if pr >= r {
+			return fmt.Errorf("%w: tx %d in round %d, tx %d in round %d", ErrSenderOrder, id, r, p, pr)
+		}
+	}
+	return nil
+}
+
+// ValidateGroupOrder checks the groups of GenerateTxAndRWSetGroups,
+// the groups run concurrently and the txs of a group run one after another
+func ValidateGroupOrder(txs types.Transactions, groups []types.Transactions) error {
+	type position struct{ group, index int }
+	posOf := make(map[common.Hash]position)
+	for g, group := range groups {
+		for i, tx := range group {
+			posOf[tx.Hash()] = position{g, i}
+		}
+	}
+	for id, p := range senderPredecessors(txs) {
+		pos, ok := posOf[txs[id].Hash()]
+		if !ok {
+			continue
+		}
+		ppos, ok := posOf[txs[p].Hash()]
+		if !ok {
+			return fmt.Errorf("%w: tx %d in group %d, tx %d not scheduled", ErrSenderOrder, id, pos.group, p)
+		}
+		if ppos.group != pos.group || ppos.index >= pos.index {
+			return fmt.Errorf("%w: tx %d at %d of group %d, tx %d at %d of group %d", ErrSenderOrder, id, pos.index, pos.group, p, ppos.index, ppos.group)
+		}
+	}
+	return nil
+}
+
+// ValidateStageOrder checks the stages of GenerateLPTStages,
+// the stages run one after another, the groups of a stage concurrently and the txs of a group one after another
+func ValidateStageOrder(txs types.Transactions, stages [][]types.Transactions) error {
+	type position struct{ stage, group, index int }
+	posOf := make(map[common.Hash]position)
+	for s, groups := range stages {
+		for g, group := range groups {
+			for i, tx := range group {
+				posOf[tx.Hash()] = position{s, g, i}
+			}
+		}
+	}
+	for id, p := range senderPredecessors(txs) {
+		pos, ok := posOf[txs[id].Hash()]
+		if !ok {
+			continue
+		}
+		ppos, ok := posOf[txs[p].Hash()]
+		if !ok {
+			return fmt.Errorf("%w: tx %d in stage %d, tx %d not scheduled", ErrSenderOrder, id, pos.stage, p)
+		}
+		if ppos.stage < pos.stage {
+			continue
+		}
+		if ppos.stage != pos.stage || ppos.group != pos.group || ppos.index >= pos.index {
+			return fmt.Errorf("%w: tx %d at %d of group %d in stage %d, tx %d at %d of group %d in stage %d",
+				ErrSenderOrder, id, pos.index, pos.group, pos.stage, p, ppos.index, ppos.group, ppos.stage)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/panjf2000/ants/v2"
+)
+
+// SpeculativeResult is a pending tx pre-executed on the state of version, e.g. the block number of the state
+type SpeculativeResult struct {
+	Tx      *types.Transaction
+	Version uint64
+	Header  *types.Header // the pending header the tx was run in
+	RWSet   *accesslist.RWSet
+	Writes  *interactState.CacheState // the values of the WriteSet of RWSet, see CacheState.MergeWriteSet
+	GasUsed uint64
+	Err     error
+}
+
+// SpeculativeCache keeps the speculative results by tx hash and pre-state version, it is safe for concurrent use
+type SpeculativeCache struct {
+	mu      sync.RWMutex
+	results map[common.Hash]map[uint64]*SpeculativeResult
+}
+
+func NewSpeculativeCache() *SpeculativeCache {
+	return &SpeculativeCache{
+		results: make(map[common.Hash]map[uint64]*SpeculativeResult),
+	}
+}
+
+func (c *SpeculativeCache) Put(result *SpeculativeResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash := result.Tx.Hash()
+	if _, ok := c.results[hash]; !ok {
+		c.results[hash] = make(map[uint64]*SpeculativeResult)
+	}
+	c.results[hash][result.Version] = result
+}
+
+// Get returns the result of the tx pre-executed on the state of version, nil if there is none
+func (c *SpeculativeCache) Get(hash common.Hash, version uint64) *SpeculativeResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.results[hash][version]
+}
+
+// Prune drops the results on the states older than version, they can't be reused anymore
+func (c *SpeculativeCache) Prune(version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for hash, byVersion := range c.results {
+		for v := range byVersion {
+			if v < version {
+				delete(byVersion, v)
+			}
+		}
+		if len(byVersion) == 0 {
+			delete(c.results, hash)
+		}
+	}
+}
+
+// Len returns the number of results kept
+func (c *SpeculativeCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n := 0
+	for _, byVersion := range c.results {
+		n += len(byVersion)
+	}
+	return n
+}
+
+// PreExecute runs tx alone on a copy of base as ExecWithSpeculation would execute it, base is left unchanged.
+// The values tx wrote are read back from the post-state, and a balance only changed by deltas is kept as a delta,
+// so a result with a nil Err replays exactly what tx does on the state of version
+func PreExecute(tx *types.Transaction, base *ethState.StateDB, version uint64, header *types.Header, chainCtx core.ChainContext) *SpeculativeResult {
+	return speculate(tx, base.Copy(), base.Copy(), version, header, chainCtx)
+}
+
+func speculate(tx *types.Transaction, postState, preState *ethState.StateDB, version uint64, header *types.Header, chainCtx core.ChainContext) *SpeculativeResult {
+	result := &SpeculativeResult{Tx: tx, Version: version, Header: header, RWSet: accesslist.NewRWSet()}
+	fulldb := interactState.NewStateWithRwSets(postState)
+	fulldb.SetRWSet(result.RWSet)
+	// the nonce is checked, a tx ahead of its nonce fails here
+	errs, gasUsed := tracer.ExecuteTxs(fulldb, types.Transactions{tx}, header, chainCtx)
+	result.GasUsed, result.Err = gasUsed[0], errs[0]
+	if result.Err != nil {
+		return result
+	}
+	result.Writes = interactState.NewCacheState()
+	result.Writes.Prefetch(postState, accesslist.RWSetList{{WriteSet: result.RWSet.WriteSet}})
+	for addr, state := range result.RWSet.WriteSet {
+		if _, ok := state[accesslist.ALIVE]; ok && postState.HasSelfDestructed(addr) {
+			result.Writes.SelfDestruct(addr)
+		}
+		_, delta := state[accesslist.BALANCEDELTA]
+		if _, set := state[accesslist.BALANCE]; delta && !set {
+			result.Writes.AddBalanceDelta(addr, new(big.Int).Sub(postState.GetBalance(addr), preState.GetBalance(addr)))
+		}
+	}
+	return result
+}
+
+// Speculator pre-executes the pending txs on the latest state as they arrive and keeps the results in Cache
+type Speculator struct {
+	Cache *SpeculativeCache
+
+	pool     *ants.Pool
+	chainCtx core.ChainContext
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex // the state is only copied under mu, the copies of a StateDB are not concurrent safe
+	base    *ethState.StateDB
+	version uint64
+	header  *types.Header
+}
+
+func NewSpeculator(pool *ants.Pool, chainCtx core.ChainContext) *Speculator {
+	return &Speculator{
+		Cache:    NewSpeculativeCache(),
+		pool:     pool,
+		chainCtx: chainCtx,
+	}
+}
+
+// Advance moves the speculation to the state of version, e.g. after a block import,
+// header is the pending header the txs are run in. The results on older states are pruned
+func (s *Speculator) Advance(statedb *ethState.StateDB, version uint64, header *types.Header) {
+	s.mu.Lock()
+	s.base = statedb.Copy()
+	s.version = version
+	s.header = header
+	s.mu.Unlock()
+	s.Cache.Prune(version)
+}
+
+// Submit pre-executes tx on the latest state in the pool, the txs already speculated on it are skipped
+func (s *Speculator) Submit(tx *types.Transaction) error {
+	s.mu.Lock()
+	if s.base == nil || s.Cache.Get(tx.Hash(), s.version) != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	postState, preState := s.base.Copy(), s.base.Copy()
+	version, header := s.version, s.header
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	err := s.pool.Submit(func() {
+		defer s.wg.Done()
+		s.Cache.Put(speculate(tx, postState, preState, version, header, s.chainCtx))
+	})
+	if err != nil {
+		s.wg.Done()
+	}
+	return err
+}
+
+// Wait waits for the submitted txs to be pre-executed
+func (s *Speculator) Wait() {
+	s.wg.Wait()
+}
+
+// sameContext reports whether the EVM sees the same block context under both headers
+func sameContext(a, b *types.Header) bool {
+	if a == b {
+		return true
+	}
+	if a.Coinbase != b.Coinbase || a.Time != b.Time || a.GasLimit != b.GasLimit || a.MixDigest != b.MixDigest ||
+		a.Number.Cmp(b.Number) != 0 || a.Difficulty.Cmp(b.Difficulty) != 0 {
+		return false
+	}
+	if a.BaseFee == nil || b.BaseFee == nil {
+		return a.BaseFee == b.BaseFee
+	}
+	return a.BaseFee.Cmp(b.BaseFee) == 0
+}
+
+// ExecWithSpeculation executes txs in block order on statedb, the state of version.
+// A tx reuses its speculative result if it ran in the same block context and no earlier tx of the block
+// wrote what it read, its write set is merged instead of executing it again. The rest are executed as usual.
+// It returns the errors and the gas used like tracer.ExecuteTxs, and the number of results reused
+func ExecWithSpeculation(statedb interactState.StateInterface, txs types.Transactions, cache *SpeculativeCache, version uint64,
+	header *types.Header, chainCtx core.ChainContext) ([]error, []uint64, int) {
+	errs := make([]error, txs.Len())
+	gasUsed := make([]uint64, txs.Len())
+	written := accesslist.NewRWSet() // the writes of the txs so far
+	reused := 0
+	for i, tx := range txs {
+		result := cache.Get(tx.Hash(), version)
+		if result != nil && result.Err == nil && sameContext(result.Header, header) &&
+			!(accesslist.RWSet{ReadSet: result.RWSet.ReadSet, WriteSet: accesslist.ALTuple{}}).HasConflict(*written) {
+			// the write set of the result is merged, so a write over an earlier one is fine, only the reads matter
+			if errs[i] = result.Writes.MergeWriteSet(statedb, result.RWSet.WriteSet); errs[i] == nil {
+				gasUsed[i] = result.GasUsed
+				addWrites(written, result.RWSet.WriteSet)
+				reused++
+				continue
+			}
+		}
+		fulldb := interactState.NewStateWithRwSets(statedb)
+		rwSet := accesslist.NewRWSet()
+		fulldb.SetRWSet(rwSet)
+		txErrs, txGas := tracer.ExecuteTxs(fulldb, types.Transactions{tx}, header, chainCtx)
+		errs[i], gasUsed[i] = txErrs[0], txGas[0]
+		addWrites(written, rwSet.WriteSet)
+	}
+	return errs, gasUsed, reused
+}
+
+func addWrites(written *accesslist.RWSet, writeSet accesslist.ALTuple) {
+	for addr, state := range writeSet {
+		for hash := range state {
+			written.AddWriteSet(addr, hash)
+		}
+	}
+}
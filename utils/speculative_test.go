@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"interact/core"
+	"interact/tracer"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// copierCode stores the calldata at slot 0, or copies slot 0 to slot 1 without calldata
+var copierCode = common.FromHex("0x36600b57600054600155005b60003560005500")
+
+func TestExecWithSpeculation(t *testing.T) {
+	defer core.SetTransferMode(core.GetTransferMode())
+	for _, mode := range []core.TransferMode{core.TransferStrict, core.TransferDelta} {
+		core.SetTransferMode(mode)
+		env := newExecEnv(t)
+		env.statedb.SetCode(testContract, copierCode)
+		env.statedb.Finalise(true)
+
+		// tx 1 reads slot 0 that tx 0 writes, tx 2 is apart
+		txs := []*types.Transaction{
+			env.call(0, 0, testContract, 0, common.BigToHash(common.Big3).Bytes()),
+			env.call(1, 0, testContract, 0, nil),
+			env.call(2, 0, common.HexToAddress("0xbeef"), 5, nil),
+		}
+		serial := env.statedb.Copy()
+		serialErrs, serialGas := tracer.ExecuteTxs(serial, txs, env.header, env.chainCtx)
+
+		cache := NewSpeculativeCache()
+		for _, tx := range txs {
+			result := PreExecute(tx, env.statedb, 7, env.header, env.chainCtx)
+			if result.Err != nil {
+				t.Fatalf("mode %v: pre-execute: %v", mode, result.Err)
+			}
+			cache.Put(result)
+		}
+		stale := cache.Get(txs[1].Hash(), 7)
+		if _, ok := stale.RWSet.ReadSet[testContract][slot(0)]; !ok {
+			t.Fatalf("mode %v: the speculated tx 1 didn't read slot 0", mode)
+		}
+		// on the pre-state tx 1 copies a zero, a cheaper store than the serial one
+		if stale.GasUsed == serialGas[1] {
+			t.Fatalf("mode %v: the stale result uses the serial gas %d, the test can't tell them apart", mode, serialGas[1])
+		}
+
+		state := env.statedb.Copy()
+		errs, gasUsed, reused := ExecWithSpeculation(state, txs, cache, 7, env.header, env.chainCtx)
+		// a strict tx reads the balance of the coinbase the earlier txs have paid, the deltas commute
+		if want := map[core.TransferMode]int{core.TransferStrict: 1, core.TransferDelta: 2}[mode]; reused != want {
+			t.Fatalf("mode %v: %d results reused, want %d", mode, reused, want)
+		}
+		for i := range txs {
+			if errs[i] != nil || serialErrs[i] != nil || gasUsed[i] != serialGas[i] {
+				t.Fatalf("mode %v tx %d: err %v gas %d, serial err %v gas %d", mode, i, errs[i], gasUsed[i], serialErrs[i], serialGas[i])
+			}
+		}
+		// tx 1 is executed again and copies the value of tx 0
+		if got := state.GetState(testContract, slot(1)); got != common.BigToHash(common.Big3) {
+			t.Fatalf("mode %v: slot 1 is %v, want 3", mode, got)
+		}
+		if root, want := state.IntermediateRoot(true), serial.IntermediateRoot(true); root != want {
+			t.Fatalf("mode %v: root %v, serial root %v", mode, root, want)
+		}
+
+		// on a later version the results are stale and every tx is executed
+		if _, _, reused := ExecWithSpeculation(env.statedb.Copy(), txs, cache, 8, env.header, env.chainCtx); reused != 0 {
+			t.Fatalf("mode %v: %d results reused on another version", mode, reused)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/utils"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// CompareBlockBuilders takes the txs of block[num] as the mempool and builds a block of half its gas limit
+// with the fee-ordered builder and the parallel one, and compares the parallelism of the two
+func CompareBlockBuilders(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64, workers int) error {
+	txs, predictRWSets, header, fakeChainCtx := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+	block, _ := utils.GetBlockAndHeader(chainDB, num)
+	weights := utils.TxGasWeights(chainDB, block, fakeChainCtx.Config())
+	pending := make([]utils.PendingTx, txs.Len())
+	for i, tx := range txs {
+		pending[i] = utils.PendingTx{Tx: tx, RWSet: predictRWSets[i], Gas: weights[i]}
+	}
+	cfg := utils.BuilderConfig{
+		GasLimit: header.GasLimit / 2,
+		BaseFee:  header.BaseFee,
+		Workers:  workers,
+	}
+	for _, builder := range []struct {
+		name  string
+		build func([]utils.PendingTx, utils.BuilderConfig) (*utils.BuiltBlock, error)
+	}{
+		{"Fee Order", utils.BuildBlockByFee},
+		{"Parallel", utils.BuildParallelBlock},
+	} {
+		built, err := builder.build(pending, cfg)
+		if err != nil {
+			return err
+		}
+		speedup := 0.0
+		if built.Schedule.Bound > 0 {
+			speedup = float64(built.Schedule.Total) / float64(built.Schedule.Bound)
+		}
+		fmt.Println(builder.name, "Txs:", built.Txs.Len(), "Total Gas:", built.Schedule.Total,
+			"Critical Path Gas:", built.Schedule.Bound, "Parallelism Bound:", speedup, "Rounds:", len(built.Rounds))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package testfunc
+
+import (
+	"fmt"
+	conflictgraph "interact/conflictGraph"
+	"interact/mis"
+	"interact/utils"
+	"testing"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// BenchmarkConflictGraphs benchmarks the graph algorithms on the conflict graphs of block[num],
+// the block should have 300+ txs to be meaningful
+func BenchmarkConflictGraphs(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) {
+	txs, predictRWSets, _, _ := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+	undiGraph := utils.ConflictGraph(txs, predictRWSets)
+	edges := 0
+	for _, neighbors := range undiGraph.AdjacencyMap {
+		edges += len(neighbors)
+	}
+	fmt.Println("Block:", num, "Txs:", txs.Len(), "Vertices:", len(undiGraph.Vertices), "Edges:", edges/2)
+
+	for _, bench := range []struct {
+		name string
+		run  func()
+	}{
+		{"NewCSR", func() { conflictgraph.NewCSR(undiGraph) }},
+		{"GetConnectedComponents", func() { undiGraph.GetConnectedComponents() }},
+		{"DegreeZero Groups", func() { utils.GenerateDegreeZeroGroups(txs, predictRWSets) }},
+		{"LinearTime", func() { mis.NewSolution(undiGraph).Solve() }},
+		{"MIS Rounds", func() { utils.GenerateMISGroups(txs, predictRWSets) }},
+	} {
+		result := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bench.run()
+			}
+		})
+		fmt.Println(bench.name, result.String(), result.MemString())
+	}
+}
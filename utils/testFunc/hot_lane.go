@@ -0,0 +1,60 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/core"
+	interactState "interact/state"
+	"interact/utils"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/panjf2000/ants/v2"
+)
+
+// CompareHotLanes executes the blocks in [startNum, endNum] with the txs contending on the hot keys in a serial lane,
+// the hot keys are detected from the current block and the window of blocks before it.
+// It reports how much of each block the lane forced into serial execution, against the critical path of the whole block
+func CompareHotLanes(chainDB ethdb.Database, sdbBackend ethState.Database, startNum, endNum uint64, window int, threshold float64) error {
+	fakeChainCtx := core.NewFakeChainContext(chainDB)
+	manager := utils.NewContentionManager(window, threshold)
+	antsPool, _ := ants.NewPool(16, ants.WithPreAlloc(true))
+	defer antsPool.Release()
+
+	for num := startNum; num <= endNum; num++ {
+		txs, predictRWSets, header, _ := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+		trueLists, err := TrueRWSets(txs, chainDB, sdbBackend, num)
+		if err != nil {
+			return err
+		}
+		block, _ := utils.GetBlockAndHeader(chainDB, num)
+		weights := utils.TxGasWeights(chainDB, block, fakeChainCtx.Config())
+
+		plan, err := utils.PlanHotLane(txs, predictRWSets, manager.HotKeys(predictRWSets), weights)
+		if err != nil {
+			return err
+		}
+		schedule := utils.GenerateCriticalPathSchedule(txs, predictRWSets, weights)
+		fmt.Println("Block:", num, plan)
+		fmt.Println("Critical Path Gas:", schedule.Bound, "Total Gas:", schedule.Total)
+
+		state, err := utils.GetState(chainDB, sdbBackend, num-1)
+		if err != nil {
+			return err
+		}
+		fullcache := utils.PrepareFullCache(state, block, fakeChainCtx, nil, predictRWSets, trueLists)
+
+		meter := utils.NewBlockGasMeter(txs, header)
+		_, _, hotTime, roundsTime, err := utils.ExecWithHotLane(antsPool, plan, txs, fullcache, header, fakeChainCtx, meter)
+		if err != nil {
+			return err
+		}
+		if _, err := utils.FinishBlock(state, interactState.NewConcurrentTxState(fullcache), block, predictRWSets, fakeChainCtx, meter); err != nil {
+			return err
+		}
+		fmt.Println("Hot Lane Time:", hotTime, "Rounds Time:", roundsTime)
+		fmt.Println("Gas Used:", meter.GasUsed(), "Header Gas Used:", header.GasUsed)
+
+		manager.Observe(trueLists)
+	}
+	return nil
+}
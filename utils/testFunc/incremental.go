@@ -0,0 +1,41 @@
+package testfunc
+
+import (
+	"fmt"
+	conflictgraph "interact/conflictGraph"
+	"interact/utils"
+	"time"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// StreamBlockIntoGraph adds the txs of block[num] one at a time as a mempool would,
+// prints the components and layers next to those of the snapshot graphs,
+// then drops the first half of the txs as if they were included in a block
+func StreamBlockIntoGraph(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) {
+	txs, predictRWSets, _, _ := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+	g := conflictgraph.NewIncrementalGraph()
+	ids := make([]uint, 0, txs.Len())
+	st := time.Now()
+	for i, tx := range txs {
+		id, err := g.AddTx(tx.Hash(), predictRWSets[i])
+		if err != nil {
+			// left to the serial barrier round, as in the block executors
+			continue
+		}
+		ids = append(ids, id)
+	}
+	fmt.Println("Add Time:", time.Since(st), "Txs:", g.Len(), "Components:", len(g.Components()), "Layers:", len(g.Layers()))
+
+	st = time.Now()
+	undiGraph := g.UndirectedGraph()
+	diGraph := g.DirectedGraph()
+	fmt.Println("Rebuild Time:", time.Since(st), "Components:", len(undiGraph.GetConnectedComponents()), "Layers:", len(diGraph.GetDegreeZero()))
+
+	st = time.Now()
+	for _, id := range ids[:len(ids)/2] {
+		g.RemoveTx(id)
+	}
+	fmt.Println("Remove Time:", time.Since(st), "Txs:", g.Len(), "Components:", len(g.Components()), "Layers:", len(g.Layers()))
+}
@@ -0,0 +1,50 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/mis"
+	"interact/utils"
+	"time"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// CompareMISWithOptimum measures mis.LinearTime against the exact solvers on the conflict graph of block[num],
+// by the size and the gas of the first round
+func CompareMISWithOptimum(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64, budget time.Duration) {
+	txs, predictRWSets, _, fakeChainCtx := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+	block, _ := utils.GetBlockAndHeader(chainDB, num)
+	weights := make(map[uint]uint64)
+	for id, w := range utils.TxGasWeights(chainDB, block, fakeChainCtx.Config()) {
+		weights[uint(id)] = w
+	}
+	graph := utils.ConflictGraph(txs, predictRWSets)
+	gasOf := func(set []uint) uint64 {
+		gas := uint64(0)
+		for _, id := range set {
+			gas += weights[id]
+		}
+		return gas
+	}
+
+	st := time.Now()
+	heuristic := mis.NewSolution(graph)
+	heuristic.Solve()
+	heuristicSet := heuristic.IndependentSet.ToSlice()
+	fmt.Println("LinearTime Size:", len(heuristicSet), "Gas:", gasOf(heuristicSet), "Time:", time.Since(st))
+
+	st = time.Now()
+	exact := mis.NewExactSolution(graph, budget)
+	exact.Solve()
+	fmt.Println("Exact Size:", exact.Weight, "Gas:", gasOf(exact.IndependentSet.ToSlice()), "Optimal:", exact.Optimal, "Time:", time.Since(st))
+
+	st = time.Now()
+	weighted := mis.NewWeightedSolution(graph, weights, budget)
+	weighted.Solve()
+	fmt.Println("Weighted Size:", weighted.IndependentSet.Cardinality(), "Gas:", weighted.Weight, "Optimal:", weighted.Optimal, "Time:", time.Since(st))
+
+	if exact.Weight > 0 {
+		fmt.Printf("LinearTime / Optimum: %.4f\n", float64(len(heuristicSet))/float64(exact.Weight))
+	}
+}
@@ -0,0 +1,98 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/tracer"
+	"interact/utils"
+	"sync"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/panjf2000/ants/v2"
+)
+
+// CompareScheduleWithSerial is a differential oracle of the MIS schedulers against the block order of block[num]:
+// the rounds are checked against the true rw sets, and the state executed in rounds against the serial one
+func CompareScheduleWithSerial(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) error {
+	txs, predictRWSets, header, fakeChainCtx := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+	block, _ := utils.GetBlockAndHeader(chainDB, num)
+	baseState, err := utils.GetState(chainDB, sdbBackend, num-1)
+	if err != nil {
+		return err
+	}
+	trueLists, err := TrueRWSets(txs, chainDB, sdbBackend, num)
+	if err != nil {
+		return err
+	}
+	deleteEmpty := fakeChainCtx.Config().IsEIP158(header.Number)
+
+	serial := baseState.Copy()
+	utils.PrepareBlock(serial, block, fakeChainCtx)
+	tracer.ExecuteTxs(serial, txs, header, fakeChainCtx)
+	utils.FinalizeBlock(serial, block, fakeChainCtx)
+	serialRoot := serial.IntermediateRoot(deleteEmpty)
+	fmt.Println("Serial Root:", serialRoot, "Header Root:", header.Root)
+
+	antsPool, _ := ants.NewPool(16, ants.WithPreAlloc(true))
+	defer antsPool.Release()
+	var antsWG sync.WaitGroup
+
+	for _, scheduler := range []struct {
+		name     string
+		generate func(types.Transactions, accesslist.RWSetList) ([][]uint, error)
+	}{
+		{"MIS", utils.GenerateMISGroups},
+		{"Ordered MIS", utils.GenerateOrderedMISGroups},
+	} {
+		groups, err := scheduler.generate(txs, predictRWSets)
+		if err != nil {
+			return err
+		}
+		scheduled := 0
+		for _, group := range groups {
+			scheduled += len(group)
+		}
+		fmt.Println(scheduler.name, "Rounds:", len(groups), "Scheduled Txs:", scheduled, "/", txs.Len(), "Barrier Txs:", len(utils.BarrierTxs(txs, predictRWSets)))
+		if err := utils.ValidateConflictOrder(trueLists, groups); err != nil {
+			fmt.Println(scheduler.name, "Block Order:", err)
+		} else {
+			fmt.Println(scheduler.name, "Block Order: preserved")
+		}
+		root := execInRounds(antsPool, &antsWG, baseState, block, txs, predictRWSets, groups, fakeChainCtx).IntermediateRoot(deleteEmpty)
+		fmt.Println(scheduler.name, "Root:", root, "Matches Serial:", root == serialRoot)
+	}
+	return nil
+}
+
+// execInRounds executes the rounds of groups one after another on a copy of baseState, then the barrier round, like ExecWithMIS
+func execInRounds(antsPool *ants.Pool, antsWG *sync.WaitGroup, baseState *ethState.StateDB, block *types.Block,
+	txs types.Transactions, predictRWSets accesslist.RWSetList, groups [][]uint, fakeChainCtx core.ChainContext) *ethState.StateDB {
+	state := baseState.Copy()
+	utils.PrepareBlock(state, block, fakeChainCtx)
+	fullcache := interactState.NewCacheState()
+	for _, group := range groups {
+		for _, txid := range group {
+			fullcache.Prefetch(state, accesslist.RWSetList{predictRWSets[txid]})
+		}
+	}
+	for _, group := range groups {
+		txsToExec := make(types.Transactions, len(group))
+		cacheStates := make(interactState.CacheStateList, len(group))
+		for index, txid := range group {
+			cacheForOneTx := interactState.NewCacheState()
+			cacheForOneTx.Prefetch(fullcache, accesslist.RWSetList{predictRWSets[txid]})
+			txsToExec[index] = txs[txid]
+			cacheStates[index] = cacheForOneTx
+		}
+		tracer.ExecConflictFreeTxs(antsPool, txsToExec, cacheStates, block.Header(), fakeChainCtx, antsWG)
+		utils.MergeToState(cacheStates, fullcache)
+	}
+	utils.ExecBarrierRound(state, fullcache, utils.BarrierTxs(txs, predictRWSets), txs, block.Header(), fakeChainCtx)
+	utils.MergeToState(interactState.CacheStateList{fullcache}, state)
+	utils.FinalizeBlock(state, block, fakeChainCtx)
+	return state
+}
@@ -0,0 +1,44 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/accesslist"
+	"interact/coloring"
+	"interact/utils"
+	"time"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// CompareSchedulers compares the round schedulers on block[num] by round count and build time
+func CompareSchedulers(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) {
+	txs, predictRWSets, _, _ := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+	coloringGroups := func(solve coloring.Coloring) func(types.Transactions, accesslist.RWSetList) ([][]uint, error) {
+		return func(txs types.Transactions, predictRWSets accesslist.RWSetList) ([][]uint, error) {
+			return utils.GenerateColoringGroups(txs, predictRWSets, solve)
+		}
+	}
+	for _, scheduler := range []struct {
+		name     string
+		generate func(types.Transactions, accesslist.RWSetList) ([][]uint, error)
+	}{
+		{"MIS", utils.GenerateMISGroups},
+		{"Ordered MIS", utils.GenerateOrderedMISGroups},
+		{"DegreeZero", func(txs types.Transactions, predictRWSets accesslist.RWSetList) ([][]uint, error) {
+			return utils.GenerateDegreeZeroGroups(txs, predictRWSets)
+		}},
+		{"Greedy Coloring", coloringGroups(coloring.Greedy)},
+		{"DSatur Coloring", coloringGroups(coloring.DSatur)},
+		{"Ordered Coloring", coloringGroups(coloring.Ordered)},
+	} {
+		st := time.Now()
+		groups, err := scheduler.generate(txs, predictRWSets)
+		if err != nil {
+			fmt.Println(scheduler.name, "Error:", err)
+			continue
+		}
+		fmt.Println(scheduler.name, "Rounds:", len(groups), "Build Time:", time.Since(st))
+	}
+}
@@ -0,0 +1,66 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/core"
+	"interact/tracer"
+	"interact/utils"
+	"time"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/panjf2000/ants/v2"
+)
+
+// CompareSpeculativeImport pre-executes the txs of block[num] as pending txs on the parent state,
+// then imports the block reusing the speculative results, and checks the root against the serial execution
+func CompareSpeculativeImport(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) error {
+	block, header := utils.GetBlockAndHeader(chainDB, num)
+	txs := block.Transactions()
+	fakeChainCtx := core.NewFakeChainContext(chainDB)
+	baseState, err := utils.GetState(chainDB, sdbBackend, num-1)
+	if err != nil {
+		return err
+	}
+	deleteEmpty := fakeChainCtx.Config().IsEIP158(header.Number)
+	// the pending state, the txs run after the beacon root system call
+	utils.PrepareBlock(baseState, block, fakeChainCtx)
+
+	serial := baseState.Copy()
+	start := time.Now()
+	tracer.ExecuteTxs(serial, txs, header, fakeChainCtx)
+	serialTime := time.Since(start)
+	utils.FinalizeBlock(serial, block, fakeChainCtx)
+	serialRoot := serial.IntermediateRoot(deleteEmpty)
+	fmt.Println("Serial Root:", serialRoot, "Header Root:", header.Root)
+
+	antsPool, _ := ants.NewPool(16, ants.WithPreAlloc(true))
+	defer antsPool.Release()
+	speculator := utils.NewSpeculator(antsPool, fakeChainCtx)
+	speculator.Advance(baseState, num-1, header)
+	start = time.Now()
+	for _, tx := range txs {
+		if err := speculator.Submit(tx); err != nil {
+			fmt.Println(err)
+		}
+	}
+	speculator.Wait()
+	fmt.Println("Speculation Time:", time.Since(start), "Results:", speculator.Cache.Len())
+
+	state := baseState.Copy()
+	start = time.Now()
+	errs, _, reused := utils.ExecWithSpeculation(state, txs, speculator.Cache, num-1, header, fakeChainCtx)
+	importTime := time.Since(start)
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	utils.FinalizeBlock(state, block, fakeChainCtx)
+	root := state.IntermediateRoot(deleteEmpty)
+	fmt.Println("Reused Txs:", reused, "/", txs.Len(), "Failed Txs:", failed)
+	fmt.Println("Serial Time:", serialTime, "Import Time:", importTime)
+	fmt.Println("Speculative Root:", root, "Matches Serial:", root == serialRoot)
+	return nil
+}
@@ -0,0 +1,143 @@
+package testfunc
+
+import (
+	"errors"
+	"fmt"
+	"interact/accesslist"
+	"interact/utils"
+	"os"
+
+	statedb "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// StalePredictionReport reports how the prediction accuracy and the parallel speedup degrade
+// when block[num] is predicted with the state of block[num-1-k], for k in [0, maxK]
+func StalePredictionReport(chainDB ethdb.Database, sdbBackend statedb.Database, num, maxK uint64) error {
+	file, err := os.Create("stale.txt")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	block, _ := utils.GetBlockAndHeader(chainDB, num)
+	txs := block.Transactions()
+	trueLists, err := TrueRWSets(txs, chainDB, sdbBackend, num)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(file, "Processing Block Height:", num)
+	fmt.Fprintln(file, "Transaction Number", txs.Len())
+	speedup, err := estimateSpeedup(txs, trueLists)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(file, "True Parallel Speedup:", speedup)
+
+	for k := uint64(0); k <= maxK && k < num; k++ {
+		stateLists := make(accesslist.RWSetList, txs.Len())
+		for i, tx := range txs {
+			stateLists[i], err = utils.PredictRWSetsWithStaleState(tx, chainDB, sdbBackend, num, k)
+			if err != nil {
+				break
+			}
+		}
+		var pendingLists accesslist.RWSetList
+		if err == nil {
+			pendingLists, err = utils.PredictRWSetsWithPendingTxs(txs, chainDB, sdbBackend, num, k)
+		}
+		if errors.Is(err, utils.ErrMissingState) {
+			// the older states are not retained either
+			fmt.Fprintf(file, "---------- k = %d ----------\n", k)
+			fmt.Fprintln(file, "Stopped:", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(file, "---------- k = %d ----------\n", k)
+		fmt.Fprintln(file, "[Stale State]")
+		if err := reportStalePrediction(file, txs, stateLists, trueLists); err != nil {
+			return err
+		}
+		fmt.Fprintln(file, "[Stale State With Pending Txs]")
+		if err := reportStalePrediction(file, txs, pendingLists, trueLists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reportStalePrediction(file *os.File, txs types.Transactions, predictLists, trueLists accesslist.RWSetList) error {
+	nilCounter := 0
+	conflictCounter := 0
+	for i, list := range trueLists {
+		if predictLists[i] == nil {
+			nilCounter++
+			continue
+		}
+		if !list.Equal(*predictLists[i]) {
+			conflictCounter++
+		}
+	}
+
+	// a missed conflict is a pair of txs conflicting in fact but not in prediction,
+	// which has to be aborted and re-executed by the executors
+	missedConflictCounter := 0
+	for i := 0; i < txs.Len(); i++ {
+		for j := i + 1; j < txs.Len(); j++ {
+			if !trueLists[i].HasConflict(*trueLists[j]) {
+				continue
+			}
+			if predictLists[i] == nil || predictLists[j] == nil || !predictLists[i].HasConflict(*predictLists[j]) {
+				missedConflictCounter++
+			}
+		}
+	}
+
+	fmt.Fprintln(file, "Nil Prediction Number:", nilCounter)
+	fmt.Fprintln(file, "False Prediction Number:", conflictCounter)
+	fmt.Fprintf(file, "Prediction Accuracy: %.4f\n", float64(txs.Len()-nilCounter-conflictCounter)/float64(txs.Len()))
+	fmt.Fprintln(file, "Missed Conflict Number:", missedConflictCounter)
+	speedup, err := estimateSpeedup(txs, predictLists)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(file, "Predicted Parallel Speedup:", speedup)
+	return nil
+}
+
+// estimateSpeedup returns the theoretical speedup of connected components, degree zero and MIS,
+// i.e. the number of txs divided by the largest group or the number of rounds
+func estimateSpeedup(txs types.Transactions, rwSets accesslist.RWSetList) (string, error) {
+	txGroups, _, err := utils.GenerateTxAndRWSetGroups(txs, rwSets)
+	if err != nil {
+		return "", err
+	}
+	largest := 0
+	for _, group := range txGroups {
+		if len(group) > largest {
+			largest = len(group)
+		}
+	}
+	degreeZeroGroups, err := utils.GenerateDegreeZeroGroups(txs, rwSets)
+	if err != nil {
+		return "", err
+	}
+	misGroups, err := utils.GenerateMISGroups(txs, rwSets)
+	if err != nil {
+		return "", err
+	}
+	degreeZeroRounds, misRounds := len(degreeZeroGroups), len(misGroups)
+
+	speedup := func(n int) float64 {
+		if n == 0 {
+			return 0
+		}
+		return float64(txs.Len()) / float64(n)
+	}
+	return fmt.Sprintf("ConnectedComponents %.2f, DegreeZero %.2f, MIS %.2f",
+		speedup(largest), speedup(degreeZeroRounds), speedup(misRounds)), nil
+}
@@ -0,0 +1,52 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/core"
+	"interact/tracer"
+	"interact/utils"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// CompareStaticAndTrue cross-checks the static analysis predictor against the true rw sets of block[num]
+func CompareStaticAndTrue(chainDB ethdb.Database, sdbBackend ethState.Database, num uint64) error {
+	baseState, err := utils.GetState(chainDB, sdbBackend, num-1)
+	if err != nil {
+		return err
+	}
+	block, header := utils.GetBlockAndHeader(chainDB, num)
+	txs := block.Transactions()
+	trueLists, err := TrueRWSets(txs, chainDB, sdbBackend, num)
+	if err != nil {
+		return err
+	}
+
+	config := core.NewFakeChainContext(chainDB).Config()
+	confidentCounter := 0
+	coverCounter := 0          // the static rw sets cover the true ones
+	falseConfidentCounter := 0 // confident but missing some true accesses
+	for i, tx := range txs {
+		list, confident, err := tracer.PredictWithStaticAnalysis(baseState, tx, header, config)
+		if err != nil {
+			fmt.Println("NIL tx hash:", tx.Hash())
+			continue
+		}
+		covers := list.Covers(*trueLists[i])
+		if covers {
+			coverCounter++
+		}
+		if confident {
+			confidentCounter++
+			if !covers {
+				falseConfidentCounter++
+			}
+		}
+	}
+	fmt.Println("Transaction Number:", txs.Len())
+	fmt.Println("Confident Prediction Number:", confidentCounter)
+	fmt.Println("Covering Prediction Number:", coverCounter)
+	fmt.Println("False Confident Prediction Number:", falseConfidentCounter)
+	return nil
+}
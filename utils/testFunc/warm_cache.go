@@ -0,0 +1,62 @@
+package testfunc
+
+import (
+	"fmt"
+	"interact/accesslist"
+	"interact/core"
+	interactState "interact/state"
+	"interact/utils"
+	"time"
+
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// CompareWarmPrefetch prefetches the blocks in [startNum, endNum] from disk and through a warm cache of capacity bytes
+// kept across the blocks, and reports the prefetch times and the hit rate of each block
+func CompareWarmPrefetch(chainDB ethdb.Database, sdbBackend ethState.Database, startNum, endNum uint64, capacity int) error {
+	fakeChainCtx := core.NewFakeChainContext(chainDB)
+	warm := interactState.NewWarmCache(capacity)
+	for num := startNum; num <= endNum; num++ {
+		txs, predictRWSets, _, _ := utils.GetTxsPredictsAndHeadersForOneBlock(chainDB, sdbBackend, num)
+		trueLists, err := TrueRWSets(txs, chainDB, sdbBackend, num)
+		if err != nil {
+			return err
+		}
+		block, _ := utils.GetBlockAndHeader(chainDB, num)
+
+		// each prefetch starts on a fresh parent state, so the values not cached are read from disk
+		coldState, err := utils.GetState(chainDB, sdbBackend, num-1)
+		if err != nil {
+			return err
+		}
+		blockRWSets := accesslist.RWSetList{utils.PredictPrepareRWSet(coldState, block, fakeChainCtx), utils.PredictFinalizeRWSet(coldState, block, fakeChainCtx)}
+		st := time.Now()
+		cold := interactState.NewFullCacheConcurrent()
+		cold.Prefetch(coldState, predictRWSets)
+		cold.Prefetch(coldState, trueLists)
+		coldTime := time.Since(st)
+
+		warmState, err := utils.GetState(chainDB, sdbBackend, num-1)
+		if err != nil {
+			return err
+		}
+		before := warm.Stats()
+		st = time.Now()
+		fullcache := interactState.NewFullCacheConcurrent()
+		fullcache.SetWarmCache(warm)
+		fullcache.Prefetch(warmState, predictRWSets)
+		fullcache.Prefetch(warmState, trueLists)
+		warmTime := time.Since(st)
+		after := warm.Stats()
+
+		// the next block runs on the state after this one
+		warm.InvalidateRWSets(trueLists)
+		warm.InvalidateRWSets(blockRWSets)
+
+		hits, misses := after.Hits-before.Hits, after.Misses-before.Misses
+		fmt.Println("Block:", num, "Cold Prefetch:", coldTime, "Warm Prefetch:", warmTime, "Hits:", hits, "Misses:", misses)
+	}
+	fmt.Println(warm.Stats())
+	return nil
+}